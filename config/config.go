@@ -18,6 +18,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -51,17 +52,66 @@ const (
 	CLEAN_CONTAINER_VOLUME_ON_MESOS_KILL = "cleanpod.cleanvolumeandcontaineronmesoskill"
 	CLEAN_IMAGE_ON_MESOS_KILL            = "cleanpod.cleanimageonmesoskill"
 	CLEAN_FAIL_TASK                      = "cleanpod.cleanfailtask"
+	CLEAN_POD_UNHEALTHY                  = "cleanpod.unhealthy"
 	DOCKER_COMPOSE_VERBOSE               = "dockercomposeverbose"
 	SKIP_PULL_IMAGES                     = "launchtask.skippull"
 	COMPOSE_TRACE                        = "launchtask.composetrace"
 	DEBUG_MODE                           = "launchtask.debug"
 	COMPOSE_HTTP_TIMEOUT                 = "launchtask.composehttptimeout"
 	HTTP_TIMEOUT                         = "launchtask.httptimeout"
+	CONTAINER_LIMITS                     = "launchtask.containerlimits"
+	PULL_POLICY                          = "launchtask.pullpolicy"
+	PULL_TIMEOUT                         = "launchtask.pulltimeout"
+	PULL_PARALLELISM                     = "launchtask.pullparallelism"
+	PIN_DIGEST                           = "launchtask.pindigest"
 	COMPOSE_STOP_TIMEOUT                 = "cleanpod.timeout"
+	PLUGIN_ORDER                         = "plugins.pluginorder"
+	DOCKER_DUMP                          = "dockerdump.enable"
 	CONFIG_OVERRIDE_PREFIX               = "config."
 	monitorName                          = "podMonitor.monitorName"
+	MONITOR_RECONCILE_INTERVAL           = "podMonitor.reconcileInterval"
+	RESTART_BACKOFF                      = "podMonitor.restartBackoff"
+	MAX_RESTART_BACKOFF                  = "podMonitor.maxRestartBackoff"
+	API_ADDRESS                          = "api.address"
+	EXECUTOR_API                         = "executorapi.version"
+	LAUNCH_REPORT                        = "launchreport.enable"
+	LAUNCH_REPORT_JUNIT                  = "launchreport.junit"
+	CONTAINER_RUNTIME                    = "containerRuntime.runtimeName"
+	DOCKER_SOCKET                        = "containerRuntime.dockerSocket"
+	PODMAN_COMPOSE                       = "containerRuntime.podmanCompose"
+	COMPOSE_BINARY                       = "containerRuntime.composeBinary"
+	SECRETS_BACKEND                      = "secrets.backend"
+	SECRETS_DIR                          = "secrets.dir"
+	SECRETS_VAULT_ADDRESS                = "secrets.vaultaddress"
+	SECRETS_TMPFS_DIR                    = "secrets.tmpfsdir"
+	REDACT_KEYS                          = "redact.keys"
+	REDACT_ALLOWLIST                     = "redact.allowlist"
+	REGISTRY_AUTH_DIR                    = "registryauth.dir"
+	REGISTRY_AUTH_REGISTRIES             = "registryauth.registries"
+	REGISTRY                             = "registry"
+	USERNAME                             = "username"
+	PASSWORD                             = "password"
+	ADMISSION_IMAGE_ALLOWLIST            = "admission.images.allowlist"
+	ADMISSION_REQUIRE_DIGEST             = "admission.images.requiredigest"
+	ADMISSION_PUBLIC_KEYS                = "admission.images.publickeys"
+	ADMISSION_VERIFIER                   = "admission.images.verifier"
+	ADMISSION_PRIVILEGED                 = "admission.compose.privileged"
+	ADMISSION_HOST_NAMESPACES            = "admission.compose.hostnamespaces"
+	ADMISSION_CAPABILITIES               = "admission.compose.capabilities"
+	ADMISSION_CAPABILITY_ALLOWLIST       = "admission.compose.capabilityallowlist"
+	ADMISSION_DEVICES                    = "admission.compose.devices"
+	ADMISSION_HOST_PATHS                 = "admission.compose.hostpaths"
+	ADMISSION_HOST_PATH_ALLOWLIST        = "admission.compose.hostpathallowlist"
+	POLICY_ALLOW                         = "allow"
+	POLICY_DENY                          = "deny"
+	POLICY_STRIP                         = "strip"
+	EXECUTOR_API_V0                      = "v0"
+	EXECUTOR_API_V1                      = "v1"
 )
 
+// defaultRedactKeys are patterns of keys whose values are redacted if redact.keys isn't set
+var defaultRedactKeys = []string{"PASSWORD", "PASSWD", "TOKEN", "SECRET", "CREDENTIAL", "PRIVATE_KEY", "API_?KEY"}
+
 // Read from default configuration file and set config as key/values
 func init() {
 	err := getConfigFromFile(CONFIG_File)
@@ -137,6 +187,25 @@ func setDefaultConfig(conf *viper.Viper) {
 	conf.SetDefault(COMPOSE_STOP_TIMEOUT, "10s")
 	conf.SetDefault(HTTP_TIMEOUT, "20s")
 	conf.SetDefault(monitorName, "default")
+	conf.SetDefault(MONITOR_RECONCILE_INTERVAL, "60s")
+	conf.SetDefault(RESTART_BACKOFF, "10s")
+	conf.SetDefault(MAX_RESTART_BACKOFF, "5m")
+	conf.SetDefault(LAUNCH_REPORT, true)
+	conf.SetDefault(CLEAN_POD_UNHEALTHY, true)
+	conf.SetDefault(CONTAINER_LIMITS, false)
+	conf.SetDefault(PULL_POLICY, "always")
+	conf.SetDefault(PULL_TIMEOUT, "5m")
+	conf.SetDefault(PULL_PARALLELISM, 4)
+	conf.SetDefault(PIN_DIGEST, true)
+	conf.SetDefault(EXECUTOR_API, EXECUTOR_API_V0)
+	conf.SetDefault(CONTAINER_RUNTIME, "cli")
+	conf.SetDefault(DOCKER_SOCKET, "/var/run/docker.sock")
+	conf.SetDefault(PODMAN_COMPOSE, "podman-compose")
+	conf.SetDefault(SECRETS_BACKEND, "file")
+	conf.SetDefault(SECRETS_TMPFS_DIR, "/dev/shm")
+	conf.SetDefault(REGISTRY_AUTH_DIR, "/dev/shm")
+	conf.SetDefault(ADMISSION_VERIFIER, "cosign")
+	conf.SetDefault(REDACT_KEYS, defaultRedactKeys)
 }
 
 func GetAppFolder() string {
@@ -231,6 +300,43 @@ func SkipPullImages() bool {
 	return GetConfig().GetBool(SKIP_PULL_IMAGES)
 }
 
+// GetPullPolicy returns default pull policy of images, which could be overridden by services
+func GetPullPolicy() string {
+	policy := GetConfig().GetString(PULL_POLICY)
+	if policy == "" {
+		return "always"
+	}
+	return policy
+}
+
+// GetPullTimeout returns maximum time to pull a single image
+func GetPullTimeout() time.Duration {
+	timeoutStr := GetConfig().GetString(PULL_TIMEOUT)
+	duration, err := time.ParseDuration(timeoutStr)
+	if err != nil || duration <= 0 {
+		log.Warningf("unable to parse launchtask.pulltimeout %s to duration, using 5m as default value", timeoutStr)
+		return 5 * time.Minute
+	}
+	return duration
+}
+
+// GetPullParallelism returns maximum number of images pulled at the same time
+func GetPullParallelism() int {
+	parallelism := GetConfig().GetInt(PULL_PARALLELISM)
+	if parallelism <= 0 {
+		return 4
+	}
+	return parallelism
+}
+
+// PinImageDigest checks whether images of services are pinned to digests once they're pulled
+func PinImageDigest() bool {
+	if !GetConfig().IsSet(PIN_DIGEST) {
+		return true
+	}
+	return GetConfig().GetBool(PIN_DIGEST)
+}
+
 func EnableComposeTrace() bool {
 	return GetConfig().GetBool(COMPOSE_TRACE)
 }
@@ -246,6 +352,43 @@ func GetPollInterval() time.Duration {
 	return duration
 }
 
+// GetReconcileInterval returns interval of full pod inspection done by event-driven monitor,
+// in case any container event is missed
+func GetReconcileInterval() time.Duration {
+	intervalStr := GetConfig().GetString(MONITOR_RECONCILE_INTERVAL)
+	duration, err := time.ParseDuration(intervalStr)
+	if err != nil {
+		log.Warningf("unable to parse podMonitor.reconcileInterval %s to duration, using 60s as default value",
+			intervalStr)
+		return 60 * time.Second
+	}
+	return duration
+}
+
+// GetRestartBackoff returns the delay before first restart of a service, which doubles for each restart
+func GetRestartBackoff() time.Duration {
+	backoffStr := GetConfig().GetString(RESTART_BACKOFF)
+	duration, err := time.ParseDuration(backoffStr)
+	if err != nil {
+		log.Warningf("unable to parse podMonitor.restartBackoff %s to duration, using 10s as default value",
+			backoffStr)
+		return 10 * time.Second
+	}
+	return duration
+}
+
+// GetMaxRestartBackoff returns the maximum delay before restarting a service
+func GetMaxRestartBackoff() time.Duration {
+	backoffStr := GetConfig().GetString(MAX_RESTART_BACKOFF)
+	duration, err := time.ParseDuration(backoffStr)
+	if err != nil {
+		log.Warningf("unable to parse podMonitor.maxRestartBackoff %s to duration, using 5m as default value",
+			backoffStr)
+		return 5 * time.Minute
+	}
+	return duration
+}
+
 func GetHttpTimeout() time.Duration {
 	timeoutStr := GetConfig().GetString(HTTP_TIMEOUT)
 	duration, err := time.ParseDuration(timeoutStr)
@@ -264,6 +407,72 @@ func EnableDebugMode() bool {
 	return GetConfig().GetBool(DEBUG_MODE)
 }
 
+// EnableLaunchReport checks whether launch report is written into app folder on terminal pod status
+func EnableLaunchReport() bool {
+	return GetConfig().GetBool(LAUNCH_REPORT)
+}
+
+// CleanPodOnUnhealthy checks whether pod is failed once a container becomes unhealthy after launch,
+// otherwise unhealthy container is only reported to mesos as task health
+func CleanPodOnUnhealthy() bool {
+	return GetConfig().GetBool(CLEAN_POD_UNHEALTHY)
+}
+
+// EnableContainerLimits checks whether cpus and mem of task are distributed across services as container limits,
+// otherwise pod is only limited by the parent mesos cgroup
+func EnableContainerLimits() bool {
+	return GetConfig().GetBool(CONTAINER_LIMITS)
+}
+
+// EnableJUnitLaunchReport checks whether launch report is also written as junit xml
+func EnableJUnitLaunchReport() bool {
+	return GetConfig().GetBool(LAUNCH_REPORT_JUNIT)
+}
+
+// GetAPIAddress returns the address local status api listens on, api is disabled if it's empty
+func GetAPIAddress() string {
+	return GetConfig().GetString(API_ADDRESS)
+}
+
+// GetExecutorAPI returns the version of mesos executor api which executor driver is built on,
+// "v0" for libprocess based driver or "v1" for HTTP api
+func GetExecutorAPI() string {
+	version := strings.ToLower(strings.TrimSpace(GetConfig().GetString(EXECUTOR_API)))
+	if version == "" {
+		return EXECUTOR_API_V0
+	}
+	return version
+}
+
+// GetContainerRuntime returns the name of container runtime used to run pods
+func GetContainerRuntime() string {
+	return GetConfig().GetString(CONTAINER_RUNTIME)
+}
+
+// GetDockerSocket returns path of the unix socket which docker engine api is served on
+func GetDockerSocket() string {
+	socket := GetConfig().GetString(DOCKER_SOCKET)
+	if socket == "" {
+		return "/var/run/docker.sock"
+	}
+	return socket
+}
+
+// GetComposeBinary returns the compose command used by cli runtimes, e.g. "docker compose" or "docker-compose",
+// it's detected at launch if empty
+func GetComposeBinary() string {
+	return strings.TrimSpace(GetConfig().GetString(COMPOSE_BINARY))
+}
+
+// GetPodmanCompose returns the compose binary used by podman runtime
+func GetPodmanCompose() string {
+	binary := GetConfig().GetString(PODMAN_COMPOSE)
+	if binary == "" {
+		return "podman-compose"
+	}
+	return binary
+}
+
 func IsService() bool {
 	return GetConfig().GetBool(types.IS_SERVICE)
 }
@@ -278,6 +487,47 @@ func CreateFileAppendMode(filename string) *os.File {
 	return File
 }
 
+// overridableConfigs are keys of config which could be overridden by labels of task. Settings enforced by operators,
+// such as launchtask.containerlimits, launchtask.pindigest, launchtask.pullpolicy, launchtask.skippull, docker dump
+// paths and sections admission, secrets, registryauth, redact, api and containerRuntime, are never overridden.
+var overridableConfigs = []string{
+	TIMEOUT,
+	POD_MONITOR_INTERVAL,
+	PULL_RETRY,
+	PULL_TIMEOUT,
+	MAX_RETRY,
+	RETRY_INTERVAL,
+	COMPOSE_TRACE,
+	DEBUG_MODE,
+	COMPOSE_HTTP_TIMEOUT,
+	HTTP_TIMEOUT,
+	CLEAN_CONTAINER_VOLUME_ON_MESOS_KILL,
+	CLEAN_IMAGE_ON_MESOS_KILL,
+	CLEAN_FAIL_TASK,
+	CLEAN_POD_UNHEALTHY,
+	COMPOSE_STOP_TIMEOUT,
+	monitorName,
+	MONITOR_RECONCILE_INTERVAL,
+	RESTART_BACKOFF,
+	MAX_RESTART_BACKOFF,
+	LAUNCH_REPORT,
+	LAUNCH_REPORT_JUNIT,
+	HEALTH_CHECK,
+	DOCKER_COMPOSE_VERBOSE,
+	PLUGIN_ORDER,
+	DOCKER_DUMP,
+}
+
+// isOverridable checks whether config key could be overridden by labels of task, keys are case insensitive
+func isOverridable(key string) bool {
+	for _, k := range overridableConfigs {
+		if strings.EqualFold(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
 // OverrideConfig gets labels with override prefix "config." and override configs with value of label
 // Checking labels contain key word "config." instead of prefix since different framework will add different prefix for labels
 func OverrideConfig(taskInfo *mesos.TaskInfo) {
@@ -286,10 +536,114 @@ func OverrideConfig(taskInfo *mesos.TaskInfo) {
 	for _, label := range labelsList {
 		if strings.Contains(label.GetKey(), CONFIG_OVERRIDE_PREFIX) {
 			parts := strings.SplitAfterN(label.GetKey(), CONFIG_OVERRIDE_PREFIX, 2)
-			if len(parts) == 2 && GetConfig().IsSet(parts[1]) {
-				GetConfig().Set(parts[1], label.GetValue())
-				log.Infof("override config %s with %s", parts[1], label.GetValue())
+			if len(parts) != 2 || !GetConfig().IsSet(parts[1]) {
+				continue
+			}
+			if !isOverridable(parts[1]) {
+				log.Warnf("config %s can't be overridden by label %s", parts[1], label.GetKey())
+				continue
 			}
+			GetConfig().Set(parts[1], label.GetValue())
+			log.Infof("override config %s with %s", parts[1], label.GetValue())
 		}
 	}
 }
+
+// GetRedactKeys returns patterns of keys whose values are redacted from logs and dumps
+func GetRedactKeys() []string {
+	if !GetConfig().IsSet(REDACT_KEYS) {
+		return defaultRedactKeys
+	}
+	return GetConfig().GetStringSlice(REDACT_KEYS)
+}
+
+// GetRedactAllowlist returns keys, such as label names, whose values are never redacted
+func GetRedactAllowlist() []string {
+	return GetConfig().GetStringSlice(REDACT_ALLOWLIST)
+}
+
+// GetRegistryAuthDir returns the dir on tmpfs where docker config with registry credentials of pod is written
+func GetRegistryAuthDir() string {
+	dir := GetConfig().GetString(REGISTRY_AUTH_DIR)
+	if dir == "" {
+		return "/dev/shm"
+	}
+	return dir
+}
+
+// GetRegistryAuths returns registry credentials in config, each of them has registry, username and password
+func GetRegistryAuths() []map[string]string {
+	var auths []map[string]string
+	registries, ok := GetConfig().Get(REGISTRY_AUTH_REGISTRIES).([]interface{})
+	if !ok {
+		return auths
+	}
+	for _, r := range registries {
+		auth := make(map[string]string)
+		switch m := r.(type) {
+		case map[interface{}]interface{}:
+			for k, v := range m {
+				auth[strings.ToLower(fmt.Sprint(k))] = fmt.Sprint(v)
+			}
+		case map[string]interface{}:
+			for k, v := range m {
+				auth[strings.ToLower(k)] = fmt.Sprint(v)
+			}
+		default:
+			log.Warningf("ignore invalid registry credential in %s", REGISTRY_AUTH_REGISTRIES)
+			continue
+		}
+		auths = append(auths, auth)
+	}
+	return auths
+}
+
+// GetImageAllowlist returns registries and repositories which images of pod are allowed from, any image is allowed
+// if it's empty
+func GetImageAllowlist() []string {
+	return GetConfig().GetStringSlice(ADMISSION_IMAGE_ALLOWLIST)
+}
+
+// RequireImageDigest checks whether images of pod must be pinned to digests
+func RequireImageDigest() bool {
+	return GetConfig().GetBool(ADMISSION_REQUIRE_DIGEST)
+}
+
+// GetImagePublicKeys returns local public keys to verify signatures of images, signatures aren't verified if it's
+// empty
+func GetImagePublicKeys() []string {
+	return GetConfig().GetStringSlice(ADMISSION_PUBLIC_KEYS)
+}
+
+// GetImageVerifier returns the binary verifying signatures of images
+func GetImageVerifier() string {
+	verifier := GetConfig().GetString(ADMISSION_VERIFIER)
+	if verifier == "" {
+		return "cosign"
+	}
+	return verifier
+}
+
+// GetComposePolicy returns the action of a compose policy rule, which is allow, deny or strip.
+// Compose options are allowed if the rule isn't set.
+func GetComposePolicy(rule string) string {
+	action := strings.ToLower(GetConfig().GetString(rule))
+	switch action {
+	case "":
+		return POLICY_ALLOW
+	case POLICY_ALLOW, POLICY_DENY, POLICY_STRIP:
+		return action
+	}
+	log.Warningf("unknown action %s of %s, using deny", action, rule)
+	return POLICY_DENY
+}
+
+// GetCapabilityAllowlist returns capabilities services are allowed to add
+func GetCapabilityAllowlist() []string {
+	return GetConfig().GetStringSlice(ADMISSION_CAPABILITY_ALLOWLIST)
+}
+
+// GetHostPathAllowlist returns host paths, and the paths under them, services are allowed to mount
+func GetHostPathAllowlist() []string {
+	return GetConfig().GetStringSlice(ADMISSION_HOST_PATH_ALLOWLIST)
+}
@@ -96,6 +96,7 @@ func TestOverrideConfig(t *testing.T) {
 		{"config.cleanpod.timeout", "1", "cleanpod.timeout", "1", "should reset config if key is set"},
 		{"config.launchtask.timeout", "1", "launchtask.timeout", "1", "should reset config if key is set"},
 		{"config1.launchtask.timeout", "2", "launchtask.timeout", "1", "shouldn't reset config with invalid prefix"},
+		{"config.podMonitor.restartBackoff", "1s", "podMonitor.restartBackoff", "1s", "should reset config if key is set"},
 	}
 
 	for _, ot := range overrideTests {
@@ -106,3 +107,71 @@ func TestOverrideConfig(t *testing.T) {
 		assert.Equal(t, ot.expectedVal, GetConfig().GetString(ot.expectedKey), ot.msg)
 	}
 }
+
+func TestOverrideConfigAdmission(t *testing.T) {
+	GetConfig().Set(ADMISSION_IMAGE_ALLOWLIST, []string{"registry.example.com"})
+	GetConfig().Set(ADMISSION_PRIVILEGED, POLICY_DENY)
+	defer GetConfig().Set(ADMISSION_IMAGE_ALLOWLIST, nil)
+	defer GetConfig().Set(ADMISSION_PRIVILEGED, nil)
+	GetConfig().Set(ADMISSION_HOST_PATH_ALLOWLIST, []string{"/var/log"})
+	defer GetConfig().Set(ADMISSION_HOST_PATH_ALLOWLIST, nil)
+	runtime := GetConfig().GetString(CONTAINER_RUNTIME)
+
+	var labels []*mesosproto.Label
+	for key, value := range map[string]string{
+		"config." + ADMISSION_IMAGE_ALLOWLIST:     "",
+		"config." + ADMISSION_PRIVILEGED:          POLICY_ALLOW,
+		"config." + CONTAINER_RUNTIME:             "podman",
+		"config." + ADMISSION_HOST_PATH_ALLOWLIST: "/",
+	} {
+		key, value := key, value
+		labels = append(labels, &mesosproto.Label{Key: &key, Value: &value})
+	}
+	OverrideConfig(&mesosproto.TaskInfo{Labels: &mesosproto.Labels{Labels: labels}})
+
+	assert.Equal(t, []string{"registry.example.com"}, GetConfig().GetStringSlice(ADMISSION_IMAGE_ALLOWLIST),
+		"image policy shouldn't be loosened by labels")
+	assert.Equal(t, POLICY_DENY, GetConfig().GetString(ADMISSION_PRIVILEGED),
+		"compose policy shouldn't be loosened by labels")
+	assert.Equal(t, []string{"/var/log"}, GetConfig().GetStringSlice(ADMISSION_HOST_PATH_ALLOWLIST),
+		"host path allowlist shouldn't be loosened by labels")
+	assert.Equal(t, runtime, GetConfig().GetString(CONTAINER_RUNTIME), "runtime shouldn't be overridden by labels")
+}
+
+func TestOverrideConfigExecutor(t *testing.T) {
+	GetConfig().Set(CONTAINER_LIMITS, true)
+	GetConfig().Set(PIN_DIGEST, true)
+	GetConfig().Set(PULL_POLICY, "always")
+	GetConfig().Set(SKIP_PULL_IMAGES, false)
+	GetConfig().Set(PLUGIN_ORDER, "general")
+	GetConfig().Set(DOCKER_DUMP, false)
+	defer func() {
+		GetConfig().Set(CONTAINER_LIMITS, nil)
+		GetConfig().Set(PIN_DIGEST, nil)
+		GetConfig().Set(PULL_POLICY, nil)
+		GetConfig().Set(SKIP_PULL_IMAGES, nil)
+		GetConfig().Set(PLUGIN_ORDER, nil)
+		GetConfig().Set(DOCKER_DUMP, nil)
+	}()
+
+	var labels []*mesosproto.Label
+	for key, value := range map[string]string{
+		"config." + CONTAINER_LIMITS: "false",
+		"config." + PIN_DIGEST:       "false",
+		"config." + PULL_POLICY:      "never",
+		"config." + SKIP_PULL_IMAGES: "true",
+		"config." + PLUGIN_ORDER:     "general,example",
+		"config." + DOCKER_DUMP:      "true",
+	} {
+		key, value := key, value
+		labels = append(labels, &mesosproto.Label{Key: &key, Value: &value})
+	}
+	OverrideConfig(&mesosproto.TaskInfo{Labels: &mesosproto.Labels{Labels: labels}})
+
+	assert.True(t, GetConfig().GetBool(CONTAINER_LIMITS), "container limits shouldn't be overridden by labels")
+	assert.True(t, GetConfig().GetBool(PIN_DIGEST), "digest pinning shouldn't be overridden by labels")
+	assert.Equal(t, "always", GetConfig().GetString(PULL_POLICY), "pull policy shouldn't be overridden by labels")
+	assert.False(t, GetConfig().GetBool(SKIP_PULL_IMAGES), "image pull shouldn't be skipped by labels")
+	assert.Equal(t, "general,example", GetConfig().GetString(PLUGIN_ORDER), "plugin order should be overridden")
+	assert.True(t, GetConfig().GetBool(DOCKER_DUMP), "docker dump should be overridden")
+}
@@ -0,0 +1,204 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package api serves status of the running executor and runtime controls over local http
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const unixPrefix = "unix:"
+
+// sensitiveSections are config sections which aren't served by /config, since they have registry credentials
+// or locations of secrets
+var sensitiveSections = []string{"registryauth", "secrets"}
+
+// PodStatus is the response of /status
+type PodStatus struct {
+	TaskId   string             `json:"taskId"`
+	Status   string             `json:"status"`
+	Launched bool               `json:"launched"`
+	Failure  *types.TaskFailure `json:"failure,omitempty"`
+	// Health is aggregated health of services, only reported when pod is running
+	Health *pod.PodHealth `json:"health,omitempty"`
+}
+
+// Start listens on the address and serves api in background.
+// Address is either tcp address such as "127.0.0.1:8080", or unix socket such as "unix:dce.sock".
+func Start(address string) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	if strings.HasPrefix(address, unixPrefix) {
+		socket := strings.TrimPrefix(address, unixPrefix)
+		// Remove socket left by previous executor
+		os.Remove(socket)
+		l, err = net.Listen("unix", socket)
+	} else {
+		// api isn't authenticated, so it's only served to local processes
+		if err = checkLoopback(address); err != nil {
+			return nil, err
+		}
+		l, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", address)
+	}
+	log.Printf("Status api is listening on %s", l.Addr())
+
+	go func() {
+		if err := http.Serve(l, NewHandler()); err != nil {
+			log.Warnf("Status api is stopped: %v", err)
+		}
+	}()
+	return l, nil
+}
+
+// NewHandler returns the handler serving all the api endpoints
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", get(status))
+	mux.HandleFunc("/containers", get(func() interface{} { return pod.GetMonitorContainers() }))
+	mux.HandleFunc("/healthchecks", get(func() interface{} { return pod.GetHealthCheckList() }))
+	mux.HandleFunc("/steps", get(func() interface{} { return pod.GetStepMetrics() }))
+	mux.HandleFunc("/plugins", get(func() interface{} { return pod.PluginOrder }))
+	mux.HandleFunc("/config", get(settings))
+	mux.HandleFunc("/loglevel", post(logLevel))
+	mux.HandleFunc("/dockerdump", post(dockerDump))
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+func status() interface{} {
+	pod.CurPodStatus.RLock()
+	defer pod.CurPodStatus.RUnlock()
+	s := PodStatus{
+		TaskId:   pod.ComposeTaskInfo.GetTaskId().GetValue(),
+		Status:   pod.CurPodStatus.Status.String(),
+		Launched: pod.CurPodStatus.Launched,
+		Failure:  pod.GetTaskFailure(),
+	}
+	if pod.CurPodStatus.Status == types.POD_RUNNING {
+		health := pod.GetPodHealth()
+		s.Health = &health
+	}
+	return s
+}
+
+// settings returns effective configuration without sensitive sections, and sensitive values are redacted
+func settings() interface{} {
+	all := config.GetConfig().AllSettings()
+	for _, section := range sensitiveSections {
+		delete(all, section)
+	}
+	return redact.Value(all)
+}
+
+// checkLoopback checks whether tcp address is on loopback interface, e.g. 127.0.0.1:8080 or localhost:8080
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid api address %s", address)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.Errorf("api address %s should be on loopback interface or a unix socket", address)
+	}
+	return nil
+}
+
+// POST /loglevel?level=debug sets log level, debug mode is switched if level isn't specified
+func logLevel(r *http.Request) (interface{}, error) {
+	level := r.URL.Query().Get("level")
+	if level == "" {
+		SwitchDebugMode()
+	} else {
+		ll, err := log.ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		config.GetConfig().Set(config.DEBUG_MODE, ll >= log.DebugLevel)
+		log.SetLevel(ll)
+		log.Printf("###Set log level as %s###", ll)
+	}
+	return map[string]string{"level": log.GetLevel().String()}, nil
+}
+
+// POST /dockerdump dumps docker in background, since it could take a while
+func dockerDump(r *http.Request) (interface{}, error) {
+	go pod.DockerDump()
+	return map[string]string{"dockerdump": "started"}, nil
+}
+
+// SwitchDebugMode turns on debug mode if it's off, otherwise turns it off
+func SwitchDebugMode() {
+	if config.EnableDebugMode() {
+		config.GetConfig().Set(config.DEBUG_MODE, false)
+		log.Println("###Turn off debug mode###")
+		log.SetLevel(log.InfoLevel)
+	} else {
+		config.GetConfig().Set(config.DEBUG_MODE, true)
+		log.Println("###Turn on debug mode###")
+		log.SetLevel(log.DebugLevel)
+	}
+}
+
+func get(f func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f())
+	}
+}
+
+func post(f func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		log.Printf("Status api : %s %s", r.Method, r.URL)
+		res, err := f(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Warnf("Status api : error marshalling response: %v", err)
+		code = http.StatusInternalServerError
+		body, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,133 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(NewHandler())
+	defer server.Close()
+
+	pod.SetPodStatus(types.POD_RUNNING)
+	pod.PluginOrder = []string{"general"}
+
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		return resp.StatusCode
+	}
+
+	var status PodStatus
+	assert.Equal(t, http.StatusOK, get("/status", &status))
+	assert.Equal(t, PodStatus{
+		Status: "POD_RUNNING",
+		Health: &pod.PodHealth{Healthy: true, Services: map[string]string{}},
+	}, status)
+
+	var plugins []string
+	assert.Equal(t, http.StatusOK, get("/plugins", &plugins))
+	assert.Equal(t, []string{"general"}, plugins)
+
+	var containers []types.SvcContainer
+	assert.Equal(t, http.StatusOK, get("/containers", &containers))
+	assert.Empty(t, containers)
+
+	config.GetConfig().Set(config.REGISTRY_AUTH_REGISTRIES, []map[string]string{{"registry": "quay.io", "password": "pa55"}})
+	config.GetConfig().Set("launchtask.proxypassword", "pa55")
+	defer config.GetConfig().Set(config.REGISTRY_AUTH_REGISTRIES, nil)
+	defer config.GetConfig().Set("launchtask.proxypassword", nil)
+	var settings map[string]interface{}
+	assert.Equal(t, http.StatusOK, get("/config", &settings))
+	assert.Contains(t, settings, "launchtask")
+	assert.NotContains(t, settings, "registryauth", "registry credentials shouldn't be served")
+	assert.Equal(t, redact.MASK, settings["launchtask"].(map[string]interface{})["proxypassword"],
+		"sensitive values should be redacted")
+
+	var res map[string]string
+	assert.Equal(t, http.StatusMethodNotAllowed, get("/loglevel", &res))
+
+	resp, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), `dce_pod_status_transitions_total{status="POD_RUNNING"}`)
+
+	post := func(path string) int {
+		resp, err := http.Post(server.URL+path, "application/json", nil)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode
+	}
+
+	defer log.SetLevel(log.GetLevel())
+	assert.Equal(t, http.StatusOK, post("/loglevel?level=debug"))
+	assert.Equal(t, "debug", res["level"])
+	assert.True(t, config.EnableDebugMode())
+
+	assert.Equal(t, http.StatusOK, post("/loglevel"))
+	assert.Equal(t, "info", res["level"], "debug mode should be switched off")
+	assert.False(t, config.EnableDebugMode())
+
+	assert.Equal(t, http.StatusBadRequest, post("/loglevel?level=verbose"))
+	assert.Equal(t, http.StatusMethodNotAllowed, post("/status"))
+}
+
+func TestStartOnUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dce.sock")
+	l, err := Start("unix:" + socket)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://dce/status")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+}
+
+func TestStartOnLoopback(t *testing.T) {
+	l, err := Start("127.0.0.1:0")
+	assert.NoError(t, err)
+	l.Close()
+
+	for _, address := range []string{":8080", "0.0.0.0:8080", "10.0.0.1:8080", "example.com:8080", "8080"} {
+		_, err = Start(address)
+		assert.Error(t, err, "api shouldn't be served on %s, since it isn't authenticated", address)
+	}
+}
@@ -0,0 +1,474 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	exec "github.com/mesos/mesos-go/api/v0/executor"
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	mesosv1 "github.com/mesos/mesos-go/api/v1/lib"
+	executorv1 "github.com/mesos/mesos-go/api/v1/lib/executor"
+	"github.com/mesos/mesos-go/api/v1/lib/executor/config"
+	"github.com/mesos/mesos-go/api/v1/lib/recordio"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	executorAPIPath   = "/api/v1/executor"
+	protobufMediaType = "application/x-protobuf"
+	authTokenEnv      = "MESOS_EXECUTOR_AUTHENTICATION_TOKEN"
+	callTimeout       = 10 * time.Second
+	minBackoff        = time.Second
+)
+
+// AckTimeout is how long Stop waits for status updates to be acknowledged by mesos agent
+var AckTimeout = 5 * time.Second
+
+type protoMessage interface {
+	Marshal() ([]byte, error)
+}
+
+type protoUnmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+// HTTPDriver is an ExecutorDriver built on the v1 HTTP executor api of mesos agent, so that the same executor
+// could run without libprocess. Status updates are kept until they're acknowledged by agent, and are sent again
+// along with unacknowledged tasks once executor subscribes again after agent recovery.
+type HTTPDriver struct {
+	sync.Mutex
+	executor       exec.Executor
+	conf           config.Config
+	url            string
+	token          string
+	client         *http.Client
+	status         mesos.Status
+	registered     bool
+	unackedTasks   map[string]mesosv1.TaskInfo
+	unackedUpdates map[string]executorv1.Call_Update
+	acked          chan struct{}
+	ctx            context.Context
+	cancel         context.CancelFunc
+	stopped        chan struct{}
+	stopOnce       sync.Once
+}
+
+// NewHTTPDriver creates a driver of executor from MESOS_xyz environment variables set by mesos agent
+func NewHTTPDriver(executor exec.Executor) (*HTTPDriver, error) {
+	conf, err := config.FromEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load executor config from environment")
+	}
+
+	endpoint := conf.AgentEndpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPDriver{
+		executor:       executor,
+		conf:           conf,
+		url:            endpoint + executorAPIPath,
+		token:          os.Getenv(authTokenEnv),
+		client:         &http.Client{},
+		status:         mesos.Status_DRIVER_NOT_STARTED,
+		unackedTasks:   make(map[string]mesosv1.TaskInfo),
+		unackedUpdates: make(map[string]executorv1.Call_Update),
+		acked:          make(chan struct{}, 1),
+		ctx:            ctx,
+		cancel:         cancel,
+		stopped:        make(chan struct{}),
+	}, nil
+}
+
+func (d *HTTPDriver) setStatus(status mesos.Status) {
+	d.Lock()
+	defer d.Unlock()
+	d.status = status
+}
+
+func (d *HTTPDriver) getStatus() mesos.Status {
+	d.Lock()
+	defer d.Unlock()
+	return d.status
+}
+
+// Start subscribes to mesos agent in background
+func (d *HTTPDriver) Start() (mesos.Status, error) {
+	if status := d.getStatus(); status != mesos.Status_DRIVER_NOT_STARTED {
+		return status, errors.Errorf("unable to start driver, status is %s", status)
+	}
+	d.setStatus(mesos.Status_DRIVER_RUNNING)
+	go d.subscribeLoop()
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *HTTPDriver) stop(status mesos.Status) (mesos.Status, error) {
+	d.stopOnce.Do(func() {
+		d.setStatus(status)
+		d.cancel()
+		close(d.stopped)
+	})
+	return d.getStatus(), nil
+}
+
+// Stop waits for pending status updates to be acknowledged, then closes the subscription
+func (d *HTTPDriver) Stop() (mesos.Status, error) {
+	if !d.waitAcknowledged(AckTimeout) {
+		log.Warnf("Driver : stopping with %d unacknowledged status updates", d.pendingUpdates())
+	}
+	return d.stop(mesos.Status_DRIVER_STOPPED)
+}
+
+func (d *HTTPDriver) Abort() (mesos.Status, error) {
+	return d.stop(mesos.Status_DRIVER_ABORTED)
+}
+
+// Join waits until the driver is stopped or aborted
+func (d *HTTPDriver) Join() (mesos.Status, error) {
+	<-d.stopped
+	return d.getStatus(), nil
+}
+
+func (d *HTTPDriver) Run() (mesos.Status, error) {
+	if status, err := d.Start(); err != nil {
+		return status, err
+	}
+	return d.Join()
+}
+
+// SendStatusUpdate sends an UPDATE call, the update is sent again on resubscription until it's acknowledged
+func (d *HTTPDriver) SendStatusUpdate(status *mesos.TaskStatus) (mesos.Status, error) {
+	if driverStatus := d.getStatus(); driverStatus != mesos.Status_DRIVER_RUNNING {
+		return driverStatus, errors.Errorf("unable to send status update, driver status is %s", driverStatus)
+	}
+	if status.GetState() == mesos.TaskState_TASK_STAGING {
+		return d.getStatus(), errors.New("executor is not allowed to send TASK_STAGING status update")
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return d.getStatus(), err
+	}
+	timestamp := float64(time.Now().UnixNano()) / float64(time.Second)
+	status.Uuid = id
+	status.Source = mesos.TaskStatus_SOURCE_EXECUTOR.Enum()
+	status.ExecutorId = &mesos.ExecutorID{Value: &d.conf.ExecutorID}
+	status.Timestamp = &timestamp
+
+	update := executorv1.Call_Update{}
+	if err = convert(status, &update.Status); err != nil {
+		return d.getStatus(), errors.Wrap(err, "failed to convert status update")
+	}
+	d.Lock()
+	d.unackedUpdates[string(id)] = update
+	d.Unlock()
+
+	err = d.send(&executorv1.Call{Type: executorv1.Call_UPDATE, Update: &update})
+	return d.getStatus(), errors.Wrapf(err, "failed to send status update %s of task %s",
+		status.GetState(), status.GetTaskId().GetValue())
+}
+
+func (d *HTTPDriver) SendFrameworkMessage(msg string) (mesos.Status, error) {
+	if driverStatus := d.getStatus(); driverStatus != mesos.Status_DRIVER_RUNNING {
+		return driverStatus, errors.Errorf("unable to send framework message, driver status is %s", driverStatus)
+	}
+	err := d.send(&executorv1.Call{Type: executorv1.Call_MESSAGE, Message: &executorv1.Call_Message{Data: []byte(msg)}})
+	return d.getStatus(), errors.Wrap(err, "failed to send framework message")
+}
+
+// subscribeLoop subscribes to agent until driver is stopped. Executor is aborted once disconnected from agent,
+// unless framework enables checkpointing, in which case it subscribes again with backoff until recovery timeout.
+func (d *HTTPDriver) subscribeLoop() {
+	var disconnected time.Time
+	backoff := minBackoff
+	for {
+		connected, err := d.subscribe()
+		if d.ctx.Err() != nil {
+			return
+		}
+		log.Warnf("Driver : disconnected from agent %s : %v", d.conf.AgentEndpoint, err)
+		if connected || disconnected.IsZero() {
+			disconnected, backoff = time.Now(), minBackoff
+			if d.isRegistered() {
+				d.executor.Disconnected(d)
+			}
+		}
+
+		if !d.conf.Checkpoint || time.Since(disconnected) > d.conf.RecoveryTimeout {
+			log.Errorf("Driver : unable to subscribe to agent %s, aborting", d.conf.AgentEndpoint)
+			d.Abort()
+			return
+		}
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; d.conf.SubscriptionBackoffMax > 0 && backoff > d.conf.SubscriptionBackoffMax {
+			backoff = d.conf.SubscriptionBackoffMax
+		}
+	}
+}
+
+// subscribe sends a SUBSCRIBE call and handles events streamed in recordio until the stream ends.
+// Whether subscription was established is returned.
+func (d *HTTPDriver) subscribe() (bool, error) {
+	d.Lock()
+	subscribe := &executorv1.Call_Subscribe{}
+	for _, task := range d.unackedTasks {
+		subscribe.UnacknowledgedTasks = append(subscribe.UnacknowledgedTasks, task)
+	}
+	for _, update := range d.unackedUpdates {
+		subscribe.UnacknowledgedUpdates = append(subscribe.UnacknowledgedUpdates, update)
+	}
+	d.Unlock()
+
+	resp, err := d.post(d.ctx, &executorv1.Call{Type: executorv1.Call_SUBSCRIBE, Subscribe: subscribe})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+
+	reader := recordio.NewReader(resp.Body)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			return true, err
+		}
+		event := &executorv1.Event{}
+		if err = event.Unmarshal(frame); err != nil {
+			return true, errors.Wrap(err, "failed to parse event")
+		}
+		if err = d.handle(event); err != nil {
+			log.Errorf("Driver : failed to handle event %s : %v", event.GetType(), err)
+		}
+	}
+}
+
+// handle dispatches an event to executor the same way as libprocess based driver does
+func (d *HTTPDriver) handle(event *executorv1.Event) error {
+	log.Debugf("Driver : received event %s", event.GetType())
+	switch event.GetType() {
+	case executorv1.Event_SUBSCRIBED:
+		subscribed := event.GetSubscribed()
+		slaveInfo := &mesos.SlaveInfo{}
+		if err := convert(&subscribed.AgentInfo, slaveInfo); err != nil {
+			return err
+		}
+		if d.isRegistered() {
+			d.executor.Reregistered(d, slaveInfo)
+			return nil
+		}
+		execInfo, fwInfo := &mesos.ExecutorInfo{}, &mesos.FrameworkInfo{}
+		if err := convert(&subscribed.ExecutorInfo, execInfo); err != nil {
+			return err
+		}
+		if err := convert(&subscribed.FrameworkInfo, fwInfo); err != nil {
+			return err
+		}
+		d.Lock()
+		d.registered = true
+		d.Unlock()
+		d.executor.Registered(d, execInfo, fwInfo, slaveInfo)
+
+	case executorv1.Event_LAUNCH:
+		return d.launch(event.GetLaunch().Task)
+
+	case executorv1.Event_LAUNCH_GROUP:
+		// A pod is launched per executor, so only the first task of group is launched
+		tasks := event.GetLaunchGroup().TaskGroup.Tasks
+		if len(tasks) == 0 {
+			return errors.New("task group is empty")
+		}
+		for _, task := range tasks[1:] {
+			d.fail(task, "only one task is supported in a task group")
+		}
+		return d.launch(tasks[0])
+
+	case executorv1.Event_KILL:
+		taskId := &mesos.TaskID{}
+		if err := convert(&event.GetKill().TaskID, taskId); err != nil {
+			return err
+		}
+		go d.executor.KillTask(d, taskId)
+
+	case executorv1.Event_ACKNOWLEDGED:
+		acknowledged := event.GetAcknowledged()
+		d.Lock()
+		delete(d.unackedTasks, acknowledged.TaskID.GetValue())
+		delete(d.unackedUpdates, string(acknowledged.UUID))
+		d.Unlock()
+		select {
+		case d.acked <- struct{}{}:
+		default:
+		}
+
+	case executorv1.Event_MESSAGE:
+		d.executor.FrameworkMessage(d, string(event.GetMessage().Data))
+
+	case executorv1.Event_SHUTDOWN:
+		go func() {
+			d.executor.Shutdown(d)
+			d.Stop()
+		}()
+
+	case executorv1.Event_ERROR:
+		d.executor.Error(d, event.GetError().Message)
+
+	case executorv1.Event_HEARTBEAT:
+	default:
+		return errors.Errorf("unsupported event %s", event.GetType())
+	}
+	return nil
+}
+
+// launch keeps task until any status update of it is acknowledged, and launches it in background
+// as launching a pod takes a while
+func (d *HTTPDriver) launch(task mesosv1.TaskInfo) error {
+	taskInfo := &mesos.TaskInfo{}
+	if err := convert(&task, taskInfo); err != nil {
+		return err
+	}
+	d.Lock()
+	d.unackedTasks[task.TaskID.GetValue()] = task
+	d.Unlock()
+	go d.executor.LaunchTask(d, taskInfo)
+	return nil
+}
+
+func (d *HTTPDriver) fail(task mesosv1.TaskInfo, message string) {
+	taskId := task.TaskID.GetValue()
+	_, err := d.SendStatusUpdate(&mesos.TaskStatus{
+		TaskId:  &mesos.TaskID{Value: &taskId},
+		State:   mesos.TaskState_TASK_FAILED.Enum(),
+		Message: &message,
+	})
+	if err != nil {
+		log.Errorf("Driver : %v", err)
+	}
+}
+
+func (d *HTTPDriver) isRegistered() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.registered
+}
+
+func (d *HTTPDriver) pendingUpdates() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.unackedUpdates)
+}
+
+// waitAcknowledged waits until all status updates are acknowledged, false is returned once timeout
+func (d *HTTPDriver) waitAcknowledged(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for d.pendingUpdates() > 0 {
+		select {
+		case <-d.acked:
+		case <-d.stopped:
+			return false
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
+
+// send posts a call other than SUBSCRIBE, which is accepted by agent with 202
+func (d *HTTPDriver) send(call *executorv1.Call) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	resp, err := d.post(ctx, call)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (d *HTTPDriver) post(ctx context.Context, call *executorv1.Call) (*http.Response, error) {
+	call.ExecutorID = mesosv1.ExecutorID{Value: d.conf.ExecutorID}
+	call.FrameworkID = mesosv1.FrameworkID{Value: d.conf.FrameworkID}
+	body, err := call.Marshal()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal %s call", call.Type)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", protobufMediaType)
+	req.Header.Set("Accept", protobufMediaType)
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	return d.client.Do(req)
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return errors.Errorf("agent responded %s : %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// requiredNotSet is implemented by the error of protobuf, which is returned once a required field is missing
+type requiredNotSet interface {
+	RequiredNotSet() bool
+}
+
+// convert converts messages between v0 and v1 api, which are compatible on wire. Fields required by v0 api,
+// such as command of executor info, may be optional in v1 api, so the message is still converted without them.
+func convert(from protoMessage, to protoUnmarshaler) error {
+	data, err := from.Marshal()
+	if err != nil {
+		return err
+	}
+	if err = to.Unmarshal(data); err != nil {
+		if _, ok := errors.Cause(err).(requiredNotSet); ok {
+			return nil
+		}
+	}
+	return err
+}
+
+// newUUID returns a random RFC-4122 uuid, which is required for status updates sent through HTTP api
+func newUUID() ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errors.Wrap(err, "failed to generate uuid")
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id, nil
+}
@@ -0,0 +1,232 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	mesosv1 "github.com/mesos/mesos-go/api/v1/lib"
+	executorv1 "github.com/mesos/mesos-go/api/v1/lib/executor"
+	"github.com/mesos/mesos-go/api/v1/lib/recordio"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAgent is a stand-in mesos agent serving v1 executor api, it records calls and streams events to subscription.
+// A nil event closes the subscription.
+type fakeAgent struct {
+	*httptest.Server
+	calls  chan *executorv1.Call
+	events chan *executorv1.Event
+}
+
+func newFakeAgent(t *testing.T) *fakeAgent {
+	agent := &fakeAgent{calls: make(chan *executorv1.Call, 10), events: make(chan *executorv1.Event, 10)}
+	agent.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		call := &executorv1.Call{}
+		if r.URL.Path != executorAPIPath || r.Header.Get("Content-Type") != protobufMediaType || call.Unmarshal(body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		agent.calls <- call
+		if call.Type != executorv1.Call_SUBSCRIBE {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		w.Header().Set("Content-Type", protobufMediaType)
+		w.WriteHeader(http.StatusOK)
+		writer := recordio.NewWriter(w)
+		for {
+			select {
+			case event := <-agent.events:
+				if event == nil {
+					return
+				}
+				frame, _ := event.Marshal()
+				writer.WriteFrame(frame)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	t.Cleanup(agent.Close)
+
+	t.Setenv("MESOS_FRAMEWORK_ID", "framework-1")
+	t.Setenv("MESOS_EXECUTOR_ID", "executor-1")
+	t.Setenv("MESOS_DIRECTORY", t.TempDir())
+	t.Setenv("MESOS_SANDBOX", t.TempDir())
+	t.Setenv("MESOS_AGENT_ENDPOINT", strings.TrimPrefix(agent.URL, "http://"))
+	t.Setenv("MESOS_EXECUTOR_SHUTDOWN_GRACE_PERIOD", "5secs")
+	return agent
+}
+
+func (a *fakeAgent) nextCall(t *testing.T) *executorv1.Call {
+	select {
+	case call := <-a.calls:
+		assert.Equal(t, "executor-1", call.ExecutorID.Value)
+		assert.Equal(t, "framework-1", call.FrameworkID.Value)
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent didn't receive any call")
+		return nil
+	}
+}
+
+func subscribed() *executorv1.Event {
+	return &executorv1.Event{Type: executorv1.Event_SUBSCRIBED, Subscribed: &executorv1.Event_Subscribed{
+		ExecutorInfo:  mesosv1.ExecutorInfo{ExecutorID: mesosv1.ExecutorID{Value: "executor-1"}},
+		FrameworkInfo: mesosv1.FrameworkInfo{User: "root", Name: "framework"},
+		AgentInfo:     mesosv1.AgentInfo{Hostname: "agent-1"},
+	}}
+}
+
+func launch(taskId string) mesosv1.TaskInfo {
+	return mesosv1.TaskInfo{Name: taskId, TaskID: mesosv1.TaskID{Value: taskId}, AgentID: mesosv1.AgentID{Value: "agent-1"}}
+}
+
+func acknowledged(update *executorv1.Call_Update) *executorv1.Event {
+	return &executorv1.Event{Type: executorv1.Event_ACKNOWLEDGED, Acknowledged: &executorv1.Event_Acknowledged{
+		TaskID: update.Status.TaskID, UUID: update.Status.UUID,
+	}}
+}
+
+func TestHTTPDriver(t *testing.T) {
+	agent := newFakeAgent(t)
+	t.Setenv("MESOS_CHECKPOINT", "true")
+	t.Setenv("MESOS_RECOVERY_TIMEOUT", "15mins")
+	t.Setenv("MESOS_SUBSCRIPTION_BACKOFF_MAX", "2secs")
+	t.Setenv(authTokenEnv, "token")
+	executor := &fakeExecutor{calls: make(chan string, 10)}
+	driver, err := NewHTTPDriver(executor)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", driver.token)
+
+	status, err := driver.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, mesos.Status_DRIVER_RUNNING, status)
+	call := agent.nextCall(t)
+	assert.Equal(t, executorv1.Call_SUBSCRIBE, call.Type)
+	assert.Empty(t, call.Subscribe.UnacknowledgedTasks)
+
+	agent.events <- subscribed()
+	assert.Equal(t, "registered", <-executor.calls)
+	agent.events <- &executorv1.Event{Type: executorv1.Event_LAUNCH, Launch: &executorv1.Event_Launch{Task: launch("task-1")}}
+	assert.Equal(t, "launch task-1", <-executor.calls)
+	call = agent.nextCall(t)
+	assert.Equal(t, executorv1.Call_UPDATE, call.Type)
+	running := call.Update
+	assert.Equal(t, "task-1", running.Status.TaskID.Value)
+	assert.Equal(t, mesosv1.TASK_RUNNING, running.Status.GetState())
+	assert.Equal(t, mesosv1.SOURCE_EXECUTOR, running.Status.GetSource())
+	assert.Equal(t, "executor-1", running.Status.GetExecutorID().GetValue())
+	assert.Len(t, running.Status.UUID, 16)
+
+	// Agent restarts before acknowledging the update
+	agent.events <- nil
+	call = agent.nextCall(t)
+	assert.Equal(t, executorv1.Call_SUBSCRIBE, call.Type)
+	assert.Equal(t, []mesosv1.TaskInfo{launch("task-1")}, call.Subscribe.UnacknowledgedTasks,
+		"unacknowledged task should be sent on resubscription")
+	assert.Equal(t, []executorv1.Call_Update{*running}, call.Subscribe.UnacknowledgedUpdates,
+		"unacknowledged update should be sent on resubscription")
+	agent.events <- subscribed()
+	agent.events <- acknowledged(running)
+
+	agent.events <- &executorv1.Event{Type: executorv1.Event_KILL, Kill: &executorv1.Event_Kill{TaskID: mesosv1.TaskID{Value: "task-1"}}}
+	assert.Equal(t, "kill task-1", <-executor.calls)
+	call = agent.nextCall(t)
+	assert.Equal(t, mesosv1.TASK_KILLED, call.Update.Status.GetState())
+	assert.Equal(t, 1, driver.pendingUpdates(), "acknowledged update should be removed")
+
+	joined := make(chan mesos.Status)
+	go func() {
+		status, _ := driver.Join()
+		joined <- status
+	}()
+	select {
+	case <-joined:
+		t.Fatal("driver should wait for acknowledgement before stopping")
+	case <-time.After(100 * time.Millisecond):
+	}
+	agent.events <- acknowledged(call.Update)
+	select {
+	case status := <-joined:
+		assert.Equal(t, mesos.Status_DRIVER_STOPPED, status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("driver isn't stopped once task is killed")
+	}
+	_, err = driver.SendStatusUpdate(&mesos.TaskStatus{TaskId: &mesos.TaskID{Value: ptr("task-1")}})
+	assert.Error(t, err, "status update shouldn't be sent once driver is stopped")
+}
+
+func TestHTTPDriverLaunchGroup(t *testing.T) {
+	agent := newFakeAgent(t)
+	executor := &fakeExecutor{calls: make(chan string, 10)}
+	driver, err := NewHTTPDriver(executor)
+	assert.NoError(t, err)
+	_, err = driver.Start()
+	assert.NoError(t, err)
+	agent.nextCall(t)
+	agent.events <- subscribed()
+	assert.Equal(t, "registered", <-executor.calls)
+
+	agent.events <- &executorv1.Event{Type: executorv1.Event_LAUNCH_GROUP, LaunchGroup: &executorv1.Event_LaunchGroup{
+		TaskGroup: mesosv1.TaskGroupInfo{Tasks: []mesosv1.TaskInfo{launch("task-1"), launch("task-2")}},
+	}}
+	updates := map[string]mesosv1.TaskState{}
+	for i := 0; i < 2; i++ {
+		call := agent.nextCall(t)
+		updates[call.Update.Status.TaskID.Value] = call.Update.Status.GetState()
+	}
+	assert.Equal(t, "launch task-1", <-executor.calls)
+	assert.Equal(t, map[string]mesosv1.TaskState{"task-1": mesosv1.TASK_RUNNING, "task-2": mesosv1.TASK_FAILED}, updates,
+		"only the first task of group should be launched")
+
+	// Shutdown doesn't wait for acknowledgement forever
+	AckTimeout = 100 * time.Millisecond
+	defer func() { AckTimeout = 5 * time.Second }()
+	agent.events <- &executorv1.Event{Type: executorv1.Event_SHUTDOWN}
+	status, err := driver.Join()
+	assert.NoError(t, err)
+	assert.Equal(t, mesos.Status_DRIVER_STOPPED, status)
+}
+
+func TestHTTPDriverDisconnected(t *testing.T) {
+	agent := newFakeAgent(t)
+	driver, err := NewHTTPDriver(&fakeExecutor{calls: make(chan string, 10)})
+	assert.NoError(t, err)
+	_, err = driver.Start()
+	assert.NoError(t, err)
+	agent.nextCall(t)
+
+	agent.events <- nil
+	status, err := driver.Join()
+	assert.NoError(t, err)
+	assert.Equal(t, mesos.Status_DRIVER_ABORTED, status, "driver should be aborted once disconnected without checkpointing")
+
+	_, err = NewHTTPDriver(&fakeExecutor{})
+	assert.NoError(t, err)
+	t.Setenv("MESOS_AGENT_ENDPOINT", "")
+	_, err = NewHTTPDriver(&fakeExecutor{})
+	assert.Error(t, err, "agent endpoint is required")
+}
@@ -0,0 +1,223 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package driver provides executor drivers other than the libprocess based driver of mesos-go,
+// such as the driver on the v1 HTTP executor api of mesos agent, and the in-process driver used to run pods
+// without mesos.
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	exec "github.com/mesos/mesos-go/api/v0/executor"
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/pkg/errors"
+)
+
+const (
+	localExecutorId = "dce-local-executor"
+	localTaskPrefix = "dce-local-"
+)
+
+// LocalDriver is an in-process ExecutorDriver used to run pods without mesos, it launches the task once started
+// and prints status updates instead of sending them to mesos agent
+type LocalDriver struct {
+	sync.Mutex
+	executor exec.Executor
+	taskInfo *mesos.TaskInfo
+	out      io.Writer
+	status   mesos.Status
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLocalDriver creates a driver launching task info by executor
+func NewLocalDriver(executor exec.Executor, taskInfo *mesos.TaskInfo, out io.Writer) *LocalDriver {
+	return &LocalDriver{
+		executor: executor,
+		taskInfo: taskInfo,
+		out:      out,
+		status:   mesos.Status_DRIVER_NOT_STARTED,
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (d *LocalDriver) setStatus(status mesos.Status) {
+	d.Lock()
+	defer d.Unlock()
+	d.status = status
+}
+
+func (d *LocalDriver) getStatus() mesos.Status {
+	d.Lock()
+	defer d.Unlock()
+	return d.status
+}
+
+// Start registers the executor and launches the task
+func (d *LocalDriver) Start() (mesos.Status, error) {
+	if status := d.getStatus(); status != mesos.Status_DRIVER_NOT_STARTED {
+		return status, errors.Errorf("unable to start driver, status is %s", status)
+	}
+	d.setStatus(mesos.Status_DRIVER_RUNNING)
+
+	hostname, _ := os.Hostname()
+	go func() {
+		d.executor.Registered(d, d.taskInfo.GetExecutor(), &mesos.FrameworkInfo{}, &mesos.SlaveInfo{Hostname: &hostname})
+		d.executor.LaunchTask(d, d.taskInfo)
+	}()
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *LocalDriver) stop(status mesos.Status) (mesos.Status, error) {
+	d.stopOnce.Do(func() {
+		d.setStatus(status)
+		close(d.stopped)
+	})
+	return d.getStatus(), nil
+}
+
+func (d *LocalDriver) Stop() (mesos.Status, error) {
+	return d.stop(mesos.Status_DRIVER_STOPPED)
+}
+
+func (d *LocalDriver) Abort() (mesos.Status, error) {
+	return d.stop(mesos.Status_DRIVER_ABORTED)
+}
+
+// Join waits until the driver is stopped or aborted
+func (d *LocalDriver) Join() (mesos.Status, error) {
+	<-d.stopped
+	return d.getStatus(), nil
+}
+
+func (d *LocalDriver) Run() (mesos.Status, error) {
+	if status, err := d.Start(); err != nil {
+		return status, err
+	}
+	return d.Join()
+}
+
+// SendStatusUpdate prints the task status
+func (d *LocalDriver) SendStatusUpdate(status *mesos.TaskStatus) (mesos.Status, error) {
+	line := fmt.Sprintf("%s task %s : %s", time.Now().Format(time.RFC3339), status.GetTaskId().GetValue(), status.GetState())
+	if status.Reason != nil {
+		line += fmt.Sprintf(", reason: %s", status.GetReason())
+	}
+	if status.GetMessage() != "" {
+		line += fmt.Sprintf(", message: %s", status.GetMessage())
+	}
+	fmt.Fprintln(d.out, line)
+	return d.getStatus(), nil
+}
+
+func (d *LocalDriver) SendFrameworkMessage(msg string) (mesos.Status, error) {
+	fmt.Fprintf(d.out, "%s framework message : %s\n", time.Now().Format(time.RFC3339), msg)
+	return d.getStatus(), nil
+}
+
+// Kill kills the task as mesos agent does
+func (d *LocalDriver) Kill() {
+	fmt.Fprintf(d.out, "%s killing task %s\n", time.Now().Format(time.RFC3339), d.taskInfo.GetTaskId().GetValue())
+	d.executor.KillTask(d, d.taskInfo.GetTaskId())
+}
+
+// ReadTaskInfo reads task info from a file in json, e.g. task info logged by executor in debug mode,
+// or in protobuf
+func ReadTaskInfo(file string) (*mesos.TaskInfo, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read task info")
+	}
+	taskInfo := &mesos.TaskInfo{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, taskInfo)
+	} else {
+		err = taskInfo.Unmarshal(data)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse task info %s", file)
+	}
+
+	// Fill in ids which are assigned by framework and mesos agent
+	if taskInfo.GetTaskId().GetValue() == "" {
+		taskId := fmt.Sprintf("%s%d", localTaskPrefix, time.Now().Unix())
+		taskInfo.TaskId = &mesos.TaskID{Value: &taskId}
+	}
+	if taskInfo.Executor == nil {
+		taskInfo.Executor = &mesos.ExecutorInfo{}
+	}
+	if taskInfo.Executor.GetExecutorId().GetValue() == "" {
+		executorId := localExecutorId
+		taskInfo.Executor.ExecutorId = &mesos.ExecutorID{Value: &executorId}
+	}
+	return taskInfo, nil
+}
+
+// PrepareSandbox copies files in dir into sandbox as they're fetched by mesos agent, and changes into sandbox.
+// A temporary sandbox is created if sandbox is empty.
+func PrepareSandbox(dir, sandbox string) (string, error) {
+	var err error
+	if sandbox == "" {
+		sandbox, err = ioutil.TempDir("", localTaskPrefix)
+	} else {
+		err = os.MkdirAll(sandbox, os.ModePerm)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create sandbox")
+	}
+	if sandbox, err = filepath.Abs(sandbox); err != nil {
+		return "", err
+	}
+
+	if dir != "" {
+		err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// sandbox may be dir itself or inside dir
+			if abs, _ := filepath.Abs(path); abs == sandbox {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(sandbox, rel)
+			if info.IsDir() {
+				return os.MkdirAll(target, info.Mode()|0700)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(target, data, info.Mode())
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to copy %s into sandbox", dir)
+		}
+	}
+	return sandbox, os.Chdir(sandbox)
+}
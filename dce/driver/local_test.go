@@ -0,0 +1,152 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	exec "github.com/mesos/mesos-go/api/v0/executor"
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExecutor reports task running once launched, and stops driver once killed
+type fakeExecutor struct {
+	calls chan string
+}
+
+func (e *fakeExecutor) Registered(exec.ExecutorDriver, *mesos.ExecutorInfo, *mesos.FrameworkInfo, *mesos.SlaveInfo) {
+	e.calls <- "registered"
+}
+func (e *fakeExecutor) Reregistered(exec.ExecutorDriver, *mesos.SlaveInfo) {}
+func (e *fakeExecutor) Disconnected(exec.ExecutorDriver)                   {}
+func (e *fakeExecutor) LaunchTask(driver exec.ExecutorDriver, taskInfo *mesos.TaskInfo) {
+	e.calls <- "launch " + taskInfo.GetTaskId().GetValue()
+	driver.SendStatusUpdate(&mesos.TaskStatus{TaskId: taskInfo.TaskId, State: mesos.TaskState_TASK_RUNNING.Enum()})
+}
+func (e *fakeExecutor) KillTask(driver exec.ExecutorDriver, taskId *mesos.TaskID) {
+	e.calls <- "kill " + taskId.GetValue()
+	driver.SendStatusUpdate(&mesos.TaskStatus{TaskId: taskId, State: mesos.TaskState_TASK_KILLED.Enum(),
+		Reason: mesos.TaskStatus_REASON_EXECUTOR_TERMINATED.Enum(), Message: ptr("killed")})
+	driver.Stop()
+}
+func (e *fakeExecutor) FrameworkMessage(exec.ExecutorDriver, string) {}
+func (e *fakeExecutor) Shutdown(exec.ExecutorDriver)                 {}
+func (e *fakeExecutor) Error(exec.ExecutorDriver, string)            {}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestLocalDriver(t *testing.T) {
+	executor := &fakeExecutor{calls: make(chan string, 10)}
+	taskInfo := &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: ptr("task-1")}}
+	var out bytes.Buffer
+	driver := NewLocalDriver(executor, taskInfo, &out)
+
+	status, err := driver.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, mesos.Status_DRIVER_RUNNING, status)
+	_, err = driver.Start()
+	assert.Error(t, err, "driver should be started only once")
+	assert.Equal(t, "registered", <-executor.calls)
+	assert.Equal(t, "launch task-1", <-executor.calls)
+
+	joined := make(chan mesos.Status)
+	go func() {
+		status, _ := driver.Join()
+		joined <- status
+	}()
+	driver.Kill()
+	assert.Equal(t, "kill task-1", <-executor.calls)
+	select {
+	case status = <-joined:
+		assert.Equal(t, mesos.Status_DRIVER_STOPPED, status)
+	case <-time.After(time.Second):
+		t.Fatal("driver should be stopped once task is killed")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "task task-1 : TASK_RUNNING")
+	assert.Contains(t, lines[1], "killing task task-1")
+	assert.Contains(t, lines[2], "task task-1 : TASK_KILLED, reason: REASON_EXECUTOR_TERMINATED, message: killed")
+
+	status, _ = driver.Abort()
+	assert.Equal(t, mesos.Status_DRIVER_STOPPED, status, "stopped driver shouldn't be aborted")
+}
+
+func TestReadTaskInfo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "task.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"name": "app", "task_id": {"value": "task-1"},
+		"labels": {"labels": [{"key": "fileName", "value": "docker-compose.yml"}]}}`), 0644))
+	taskInfo, err := ReadTaskInfo(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", taskInfo.GetTaskId().GetValue())
+	assert.Equal(t, "docker-compose.yml", taskInfo.GetLabels().GetLabels()[0].GetValue())
+	assert.Equal(t, localExecutorId, taskInfo.GetExecutor().GetExecutorId().GetValue())
+
+	data, err := (&mesos.TaskInfo{
+		Name:    ptr("app"),
+		TaskId:  &mesos.TaskID{Value: ptr("task-2")},
+		SlaveId: &mesos.SlaveID{Value: ptr("agent-1")},
+	}).Marshal()
+	assert.NoError(t, err)
+	file = filepath.Join(dir, "task.pb")
+	assert.NoError(t, ioutil.WriteFile(file, data, 0644))
+	taskInfo, err = ReadTaskInfo(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "task-2", taskInfo.GetTaskId().GetValue())
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"name": "app"}`), 0644))
+	taskInfo, err = ReadTaskInfo(file)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(taskInfo.GetTaskId().GetValue(), localTaskPrefix), "task id should be generated")
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"name": 1}`), 0644))
+	_, err = ReadTaskInfo(file)
+	assert.Error(t, err)
+}
+
+func TestPrepareSandbox(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "config"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "config", "app.conf"), []byte("a=b"), 0644))
+
+	sandbox, err := PrepareSandbox(dir, filepath.Join(dir, "sandbox"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "sandbox"), sandbox)
+	cwd, _ := os.Getwd()
+	assert.Equal(t, sandbox, cwd)
+	content, err := ioutil.ReadFile("config/app.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, "a=b", string(content))
+	_, err = os.Stat("docker-compose.yml")
+	assert.NoError(t, err)
+	_, err = os.Stat("sandbox")
+	assert.True(t, os.IsNotExist(err), "sandbox shouldn't be copied into itself")
+}
@@ -30,14 +30,19 @@ import (
 	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
 
 	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/dce/api"
+	"github.com/paypal/dce-go/dce/driver"
 	"github.com/paypal/dce-go/dce/monitor"
 	_ "github.com/paypal/dce-go/dce/monitor/plugin/default"
+	_ "github.com/paypal/dce-go/dce/monitor/plugin/events"
 	"github.com/paypal/dce-go/plugin"
 	_ "github.com/paypal/dce-go/pluginimpl/example"
 	_ "github.com/paypal/dce-go/pluginimpl/general"
+	_ "github.com/paypal/dce-go/pluginimpl/secrets"
 	"github.com/paypal/dce-go/types"
 	fileUtils "github.com/paypal/dce-go/utils/file"
 	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
 	"github.com/paypal/dce-go/utils/wait"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -96,9 +101,13 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 		log.Println("Error marshalling taskInfo", err.Error())
 	}
 	buf := new(bytes.Buffer)
-	json.Indent(buf, task, "", " ")
+	json.Indent(buf, redact.JSON(task), "", " ")
 	logger.Debugln("taskInfo : ", buf)
 
+	// Launch report is written once launch returns if pod fails or finishes during launch, otherwise it's written
+	// once pod is stopped by monitor or KillTask
+	defer writeLaunchReport()
+
 	isService := pod.IsService(taskInfo)
 	log.Printf("task is service: %v", isService)
 	config.GetConfig().Set(types.IS_SERVICE, isService)
@@ -124,6 +133,12 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 	// Override config
 	config.OverrideConfig(taskInfo)
 
+	// Detect compose cli of runtime once config is overridden by task labels
+	runtime := pod.GetRuntime()
+	if compose := pod.DetectRuntimeCompose(runtime); compose != nil {
+		logger.Printf("Compose : %s runtime using %s", runtime.Name(), compose)
+	}
+
 	// Create context with timeout
 	// Wait for pod launching until timeout
 
@@ -133,52 +148,41 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 	go pod.WaitOnPod(ctx)
 
 	// Get order of plugins from config or mesos labels
-	pluginOrder, err := fileUtils.GetPluginOrder(taskInfo)
-	if err != nil {
-		logger.Println("Plugin order missing in mesos label, trying to get it from config")
-		pluginOrder = strings.Split(config.GetConfigSection("plugins")[types.PLUGIN_ORDER], ",")
-	}
+	pluginOrder := getPluginOrder(taskInfo)
 	pod.PluginOrder = pluginOrder
-	logger.Println("PluginOrder : ", pluginOrder)
 
 	// Select plugin extension points from plugin pools
 	extpoints = plugin.GetOrderedExtpoints(pluginOrder)
 
 	// Executing LaunchTaskPreImagePull in order
-	if _, err := pod.PluginPanicHandler(pod.ConditionFunc(func() (string, error) {
-		for i, ext := range extpoints {
-
-			if ext == nil {
-				logger.Errorln("Error getting plugins from plugin registration pools")
-				return "", errors.New("plugin is nil")
-			}
-			granularMetricStepName := fmt.Sprintf("%s_LaunchTaskPreImagePull", ext.Name())
-			pod.StartStep(pod.StepMetrics, granularMetricStepName)
-
-			err = ext.LaunchTaskPreImagePull(ctx, &pod.ComposeFiles, executorId, taskInfo)
-			if err != nil {
-				logger.Errorf("Error executing LaunchTaskPreImagePull of plugin : %v", err)
-				pod.EndStep(pod.StepMetrics, granularMetricStepName, nil, err)
-				return "", err
-			}
-			pod.EndStep(pod.StepMetrics, granularMetricStepName, nil, nil)
-
-			if config.EnableComposeTrace() {
-				fileUtils.DumpPluginModifiedComposeFiles(pluginOrder[i], "LaunchTaskPreImagePull", i)
-			}
-		}
-		return "", err
-	})); err != nil {
+	if err := launchTaskPreImagePull(ctx, pluginOrder, executorId, taskInfo); err != nil {
 		logger.Errorf("error while executing task pre image pull: %s", err)
+		pod.SetTaskFailure(pluginFailure("", "LaunchTaskPreImagePull", err))
 		pod.SetPodStatus(types.POD_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
 		return
 	}
+
+	// Admit compose files edited by plugins by compose policy
+	pod.StartStep(pod.StepMetrics, pod.COMPOSE_ADMISSION_STEP)
+	if failure := pod.AdmitCompose(pod.ComposeFiles); failure != nil {
+		pod.EndStep(pod.StepMetrics, pod.COMPOSE_ADMISSION_STEP, nil, errors.New(failure.Message))
+		pod.SetTaskFailure(*failure)
+		pod.SetPodStatus(types.POD_ADMISSION_DENIED)
+		cancel()
+		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
+		return
+	}
+	pod.EndStep(pod.StepMetrics, pod.COMPOSE_ADMISSION_STEP, nil, nil)
 	// Write updated compose files into pod folder
 	err = fileUtils.WriteChangeToFiles()
 	if err != nil {
 		logger.Errorf("Failure writing updated compose files : %v", err)
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_COMPOSE_WRITE,
+			Message: fmt.Sprintf("failed to write compose files: %v", err),
+		})
 		pod.SetPodStatus(types.POD_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
@@ -186,15 +190,50 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 
 	//Validate Compose files
 	if err := validateComposeFiles(); err != nil {
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_COMPOSE_CHECK,
+			Message: err.Error(),
+		})
 		pod.SetPodStatus(types.POD_COMPOSE_CHECK_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
 		return
 	}
 
+	// Admit images of pod by image policy as they are written, before they're pulled and pinned
+	pod.StartStep(pod.StepMetrics, pod.IMAGE_ADMISSION_STEP)
+	if failure := pod.AdmitImages(pod.ComposeFiles); failure != nil {
+		pod.EndStep(pod.StepMetrics, pod.IMAGE_ADMISSION_STEP, nil, errors.New(failure.Message))
+		pod.SetTaskFailure(*failure)
+		pod.SetPodStatus(types.POD_ADMISSION_DENIED)
+		cancel()
+		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
+		return
+	}
+	pod.EndStep(pod.StepMetrics, pod.IMAGE_ADMISSION_STEP, nil, nil)
+
+	// Write registry credentials of pod, which are used by both pull and compose up
+	if err = pod.WriteDockerConfig(taskInfo); err != nil {
+		logger.Errorf("Failure writing docker config : %v", err)
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_IMAGE_PULL,
+			Message: fmt.Sprintf("failed to write registry credentials: %v", err),
+			Step:    "Image_Pull",
+		})
+		pod.SetPodStatus(types.POD_PULL_FAILED)
+		cancel()
+		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
+		return
+	}
+
 	// Pull image
 	err = pullImage()
 	if err != nil {
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_IMAGE_PULL,
+			Message: err.Error(),
+			Step:    "Image_Pull",
+		})
 		pod.SetPodStatus(types.POD_PULL_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
@@ -217,6 +256,7 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 			err = ext.LaunchTaskPostImagePull(ctx, &pod.ComposeFiles, executorId, taskInfo)
 			if err != nil {
 				logger.Errorf("Error executing LaunchTaskPreImagePull of plugin : %v", err)
+				pod.SetTaskFailure(pluginFailure(ext.Name(), granularMetricStepName, err))
 				pod.EndStep(pod.StepMetrics, granularMetricStepName, nil, err)
 				return "", err
 			}
@@ -229,12 +269,25 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 		}
 		return "", err
 	})); err != nil {
+		pod.SetTaskFailure(pluginFailure("", "LaunchTaskPostImagePull", err))
 		pod.SetPodStatus(types.POD_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
 		return
 	}
 
+	// Verify signatures of images which containers run
+	pod.StartStep(pod.StepMetrics, pod.IMAGE_SIGNATURE_STEP)
+	if failure := pod.VerifyImages(pod.ComposeFiles); failure != nil {
+		pod.EndStep(pod.StepMetrics, pod.IMAGE_SIGNATURE_STEP, nil, errors.New(failure.Message))
+		pod.SetTaskFailure(*failure)
+		pod.SetPodStatus(types.POD_ADMISSION_DENIED)
+		cancel()
+		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
+		return
+	}
+	pod.EndStep(pod.StepMetrics, pod.IMAGE_SIGNATURE_STEP, nil, nil)
+
 	// Service list from all compose files
 	podServices := getServices()
 	logger.Printf("pod service list: %v", podServices)
@@ -243,6 +296,10 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 	err = fileUtils.WriteChangeToFiles()
 	if err != nil {
 		logger.Errorf("Failure writing updated compose files : %v", err)
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_COMPOSE_WRITE,
+			Message: fmt.Sprintf("failed to write compose files: %v", err),
+		})
 		pod.SetPodStatus(types.POD_FAILED)
 		cancel()
 		pod.SendMesosStatus(ctx, driver, taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
@@ -259,12 +316,23 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 	// Take an action depends on different status
 	switch replyPodStatus {
 	case types.POD_FAILED:
+		pod.SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_LAUNCH,
+			Message: fmt.Sprintf("failed to launch pod: %v", err),
+			Step:    "Launch_Pod",
+		})
 		cancel()
 		pod.SendPodStatus(ctx, types.POD_FAILED)
 
 	case types.POD_STARTING:
 		// Initial health check
 		res, err := initHealthCheck(podServices)
+		if err != nil {
+			pod.SetTaskFailure(types.TaskFailure{
+				Reason:  types.FAILURE_HEALTH_CHECK_TIMEOUT,
+				Message: fmt.Sprintf("pod isn't healthy in %v: %v", config.GetLaunchTimeout(), err),
+			})
+		}
 		if err != nil || res == types.POD_FAILED {
 			cancel()
 			pod.SendPodStatus(ctx, types.POD_FAILED)
@@ -287,6 +355,7 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 				logger.Printf("Get pod status : %s returned by PostLaunchTask", tempStatus)
 
 				if tempStatus == types.POD_FAILED.String() {
+					pod.SetTaskFailure(pluginFailure(ext.Name(), granularMetricStepName, err))
 					return tempStatus, nil
 				}
 			}
@@ -305,11 +374,18 @@ func (exec *dockerComposeExecutor) LaunchTask(driver exec.ExecutorDriver, taskIn
 			if pod.GetPodStatus() != types.POD_RUNNING {
 				pod.SendPodStatus(ctx, types.POD_RUNNING)
 				go func() {
-					status, err := monitor.MonitorPoller(ctx)
+					// ctx of launch is done already, monitor runs until it's stopped by KillTask
+					monitorCtx := pod.NewMonitorContext(context.Background())
+					status, err := monitor.MonitorPoller(monitorCtx)
+					if monitorCtx.Err() != nil {
+						log.Println("Pod monitor is stopped")
+						return
+					}
 					if err != nil {
 						log.Errorf("failure from monitor: %s", err)
 					}
 					pod.SendPodStatus(ctx, status)
+					writeLaunchReport()
 				}()
 			}
 		}
@@ -331,6 +407,7 @@ func (exec *dockerComposeExecutor) KillTask(driver exec.ExecutorDriver, taskId *
 	log.Println("====================Mesos KillTask====================")
 
 	defer func() {
+		pod.RemoveDockerConfig()
 		log.Println("====================Stop ExecutorDriver====================")
 		time.Sleep(5 * time.Second)
 		driver.Stop()
@@ -348,6 +425,7 @@ func (exec *dockerComposeExecutor) KillTask(driver exec.ExecutorDriver, taskId *
 	case types.POD_RUNNING:
 		logKill.Printf("Mesos Kill Task : Current task status is %s , continue killTask", status)
 		pod.SetPodStatus(types.POD_KILLED)
+		pod.StopMonitor()
 
 		err := pod.StopPod(ctx, pod.ComposeFiles)
 		if err != nil {
@@ -358,6 +436,7 @@ func (exec *dockerComposeExecutor) KillTask(driver exec.ExecutorDriver, taskId *
 		if err != nil {
 			logKill.Errorf("Error during kill Task : %v", err.Error())
 		}
+		writeLaunchReport()
 
 	default:
 		log.Infof("current pod status %s, stop driver", status)
@@ -376,6 +455,7 @@ func (exec *dockerComposeExecutor) Shutdown(driver exec.ExecutorDriver) {
 	for _, ext := range extpoints {
 		ext.Shutdown(pod.ComposeTaskInfo, pod.ComposeExecutorDriver)
 	}
+	pod.RemoveDockerConfig()
 	log.Println("====================Stop ExecutorDriver====================")
 	driver.Stop()
 }
@@ -384,6 +464,75 @@ func (exec *dockerComposeExecutor) Error(driver exec.ExecutorDriver, err string)
 	log.Printf("Got error message : %s", err)
 }
 
+// getPluginOrder gets order of plugins from mesos labels, or from config if it's missing in labels
+func getPluginOrder(taskInfo *mesos.TaskInfo) []string {
+	pluginOrder, err := fileUtils.GetPluginOrder(taskInfo)
+	if err != nil {
+		logger.Println("Plugin order missing in mesos label, trying to get it from config")
+		pluginOrder = strings.Split(config.GetConfigSection("plugins")[types.PLUGIN_ORDER], ",")
+	}
+	logger.Println("PluginOrder : ", pluginOrder)
+	return pluginOrder
+}
+
+// launchTaskPreImagePull executes LaunchTaskPreImagePull of plugins in order, which edit compose files
+func launchTaskPreImagePull(ctx context.Context, pluginOrder []string, executorId string, taskInfo *mesos.TaskInfo) error {
+	_, err := pod.PluginPanicHandler(pod.ConditionFunc(func() (string, error) {
+		for i, ext := range extpoints {
+
+			if ext == nil {
+				logger.Errorln("Error getting plugins from plugin registration pools")
+				return "", errors.New("plugin is nil")
+			}
+			granularMetricStepName := fmt.Sprintf("%s_LaunchTaskPreImagePull", ext.Name())
+			pod.StartStep(pod.StepMetrics, granularMetricStepName)
+
+			err := ext.LaunchTaskPreImagePull(ctx, &pod.ComposeFiles, executorId, taskInfo)
+			if err != nil {
+				logger.Errorf("Error executing LaunchTaskPreImagePull of plugin : %v", err)
+				pod.SetTaskFailure(pluginFailure(ext.Name(), granularMetricStepName, err))
+				pod.EndStep(pod.StepMetrics, granularMetricStepName, nil, err)
+				return "", err
+			}
+			pod.EndStep(pod.StepMetrics, granularMetricStepName, nil, nil)
+
+			if config.EnableComposeTrace() {
+				fileUtils.DumpPluginModifiedComposeFiles(pluginOrder[i], "LaunchTaskPreImagePull", i)
+			}
+		}
+		return "", nil
+	}))
+	return err
+}
+
+// pluginFailure describes failure of a plugin at a step
+func pluginFailure(name, step string, err error) types.TaskFailure {
+	message := "plugin"
+	if name != "" {
+		message += " " + name
+	}
+	message += " failed at " + step
+	if err != nil {
+		message += ": " + err.Error()
+	}
+	return types.TaskFailure{
+		Reason:  types.FAILURE_PLUGIN,
+		Message: message,
+		Step:    step,
+	}
+}
+
+// writeLaunchReport writes launch report if pod has reached a terminal status
+func writeLaunchReport() {
+	status := pod.GetPodStatus()
+	if !pod.IsTerminal(status) {
+		return
+	}
+	if err := pod.WriteLaunchReport(status); err != nil {
+		log.Errorf("Error writing launch report : %v", err)
+	}
+}
+
 func validateComposeFiles() error {
 	logger.Println("====================Validating Compose Files====================")
 
@@ -398,14 +547,28 @@ func validateComposeFiles() error {
 func pullImage() error {
 	logger.Println("====================Pulling Image====================")
 
-	if !config.SkipPullImages() {
+	if config.SkipPullImages() {
+		return nil
+	}
+
+	// Images are pulled one by one if runtime supports it, which all built-in runtimes "cli", "docker-api" and
+	// "podman" do
+	if puller, ok := pod.GetRuntime().(plugin.ImagePuller); ok {
+		pod.StartStep(pod.StepMetrics, "Image_Pull")
+		err := pod.PullImages(puller, pod.ComposeFiles)
+		pod.EndStep(pod.StepMetrics, "Image_Pull", nil, err)
+		if err != nil {
+			logger.Errorf("POD_IMAGE_PULL_FAILED -- %v", err)
+			return errors.Wrap(err, "image pull failed")
+		}
+	} else {
+		// Runtimes registered by plugins without ImagePuller have images pulled by compose all together
 		err := wait.PollRetry(config.GetPullRetryCount(), config.GetPollInterval(), func() (string, error) {
 			pod.StartStep(pod.StepMetrics, "Image_Pull")
 			err := pod.PullImage(pod.ComposeFiles)
 			pod.EndStep(pod.StepMetrics, "Image_Pull", nil, err)
 			return "", err
 		})
-
 		if err != nil {
 			logger.Errorf("POD_IMAGE_PULL_FAILED -- %v", err)
 			return errors.Wrap(err, "image pull failed")
@@ -456,6 +619,18 @@ func init() {
 }
 
 func main() {
+	// Launch a pod from task info without mesos in run mode, or render its compose files
+	if len(os.Args) > 1 {
+		commands := map[string]func([]string) error{RUN_COMMAND: run, RENDER_COMMAND: render}
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	log.SetOutput(config.CreateFileAppendMode(types.DCE_OUT))
 
 	log.Println("====================Genesis Executor (Go)====================")
@@ -467,43 +642,48 @@ func main() {
 			sig := <-sig
 			log.Printf("Received signal %s", sig.String())
 			if sig == syscall.SIGUSR1 {
-				switchDebugMode()
+				api.SwitchDebugMode()
 			}
 		}
 	}()
 
-	dConfig := exec.DriverConfig{
-		Executor: newDockerComposeExecutor(),
+	// Start local status api if it's enabled
+	if address := config.GetAPIAddress(); address != "" {
+		if _, err := api.Start(address); err != nil {
+			log.Errorf("Unable to start status api : %v", err)
+		}
 	}
 
-	driver, err := exec.NewMesosExecutorDriver(dConfig)
+	execDriver, err := newExecutorDriver(newDockerComposeExecutor())
 	if err != nil {
 		log.Errorf("Unable to create a ExecutorDriver : %v", err)
+		return
 	}
 
-	_, err = driver.Start()
+	_, err = execDriver.Start()
 	if err != nil {
 		log.Errorf("Got error: %v", err)
 		return
 	}
 
 	log.Println("Executor : Executor process has started and running.")
-	status, err := driver.Join()
+	status, err := execDriver.Join()
 	if err != nil {
 		log.Errorf("error from driver.Join(): %v", err)
 	}
 	log.Printf("driver.Join() exits with status %s", status.String())
 }
 
-func switchDebugMode() {
-	if config.EnableDebugMode() {
-		config.GetConfig().Set(config.DEBUG_MODE, false)
-		log.Println("###Turn off debug mode###")
-		log.SetLevel(log.InfoLevel)
-	} else {
-		config.GetConfig().Set(config.DEBUG_MODE, true)
-		log.Println("###Turn on debug mode###")
-		log.SetLevel(log.DebugLevel)
+// newExecutorDriver creates the driver per executor api version in config, the libprocess based driver by default
+func newExecutorDriver(executor exec.Executor) (exec.ExecutorDriver, error) {
+	switch version := config.GetExecutorAPI(); version {
+	case config.EXECUTOR_API_V0:
+		return exec.NewMesosExecutorDriver(exec.DriverConfig{Executor: executor})
+	case config.EXECUTOR_API_V1:
+		log.Println("Executor : using mesos v1 HTTP executor api")
+		return driver.NewHTTPDriver(executor)
+	default:
+		return nil, errors.Errorf("unsupported executor api %s", version)
 	}
 }
 
@@ -8,7 +8,6 @@ import (
 	"github.com/paypal/dce-go/types"
 	"github.com/paypal/dce-go/utils/pod"
 	"github.com/paypal/dce-go/utils/wait"
-	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,73 +27,26 @@ func (m *monitor) Start(ctx context.Context) (types.PodStatus, error) {
 		"monitor": name,
 	})
 	// Get infra container ID
-	var infraContainerId string
-	var err error
-	if !config.GetConfig().GetBool(types.RM_INFRA_CONTAINER) {
-		infraContainerId, err = pod.GetContainerIdByService(pod.ComposeFiles, types.INFRA_CONTAINER)
-		if err != nil {
-			return types.POD_FAILED, errors.Wrap(err, "fail to get infra container ID")
-		}
-		logger.Debugf("Infra container ID: %s", infraContainerId)
+	infraContainerId, err := pod.GetInfraContainerId()
+	if err != nil {
+		return types.POD_FAILED, err
 	}
-
-	run := func() (types.PodStatus, error) {
-		for i := 0; i < len(pod.MonitorContainerList); i++ {
-			hc, ok := pod.HealthCheckListId[pod.MonitorContainerList[i].ContainerId]
-			healthy, running, exitCode, err := pod.CheckContainer(pod.MonitorContainerList[i].ContainerId, ok && hc)
-			if err != nil {
-				return types.POD_FAILED, err
-			}
-			logger.Debugf("container %s has health check, health status: %s, exitCode: %d, err : %v",
-				pod.MonitorContainerList[i], healthy.String(), exitCode, err)
-
-			if exitCode != 0 {
-				return types.POD_FAILED, nil
-			}
-
-			if exitCode == 0 && !running {
-				logger.Infof("Removed finished(exit with 0) container %s from monitor list",
-					pod.MonitorContainerList[i])
-				pod.MonitorContainerList = append(pod.MonitorContainerList[:i], pod.MonitorContainerList[i+1:]...)
-				i--
-				continue
-			}
-
-			if healthy == types.UNHEALTHY {
-				err = pod.PrintInspectDetail(pod.MonitorContainerList[i].ContainerId)
-				if err != nil {
-					log.Warnf("failed to get container detail: %s ", err)
-				}
-				return types.POD_FAILED, nil
-			}
-		}
-
-		// Send finished to mesos IF no container running or ONLY system proxy is running in the pod
-		switch config.IsService() {
-		case true:
-			if len(pod.MonitorContainerList) == 0 {
-				logger.Error("Task is SERVICE. All containers in the pod exit with code 0, sending FAILED")
-				return types.POD_FAILED, nil
-			}
-			if len(pod.MonitorContainerList) == 1 && pod.MonitorContainerList[0].ContainerId == infraContainerId {
-				logger.Error("Task is SERVICE. Only infra container is running in the pod, sending FAILED")
-				return types.POD_FAILED, nil
-			}
-		case false:
-			if len(pod.MonitorContainerList) == 0 {
-				logger.Info("Task is ADHOC job. All containers in the pod exit with code 0, sending FINISHED")
-				return types.POD_FINISHED, nil
-			}
-			if len(pod.MonitorContainerList) == 1 && pod.MonitorContainerList[0].ContainerId == infraContainerId {
-				logger.Info("Task is ADHOC job. Only infra container is running in the pod, sending FINISHED")
-				return types.POD_FINISHED, nil
-			}
+	logger.Debugf("Infra container ID: %s", infraContainerId)
+
+	// Monitor is stopped once ctx is done, e.g. pod is being killed
+	done := make(chan string, 1)
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			done <- pod.GetPodStatus().String()
+		case <-finished:
 		}
-		return types.POD_EMPTY, nil
-	}
+	}()
 
-	res, err := wait.PollForever(config.GetPollInterval(), nil, func() (string, error) {
-		status, err := run()
+	res, err := wait.PollForever(config.GetPollInterval(), done, func() (string, error) {
+		status, err := pod.CheckPodStatus(infraContainerId)
 		if err != nil {
 			// Error won't be considered as pod failure unless pod status is failed
 			log.Warnf("error from monitor periodical check: %s", err)
@@ -0,0 +1,192 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package events implements an event-driven pod monitor. Pod status is decided as soon as
+// a container in the pod dies or becomes unhealthy, instead of waiting for the next poll.
+// A periodic reconcile inspects the whole pod in case any event is missed.
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/paypal/dce-go/utils/pod"
+	log "github.com/sirupsen/logrus"
+)
+
+const name = "events"
+
+type monitor struct{}
+
+func init() {
+	// Register events monitor plugin
+	log.SetOutput(config.CreateFileAppendMode(types.DCE_OUT))
+	plugin.Monitors.Register(&monitor{}, name)
+	log.Infof("Registered monitor plugin %s", name)
+}
+
+func (m *monitor) Start(ctx context.Context) (types.PodStatus, error) {
+	logger := log.WithFields(log.Fields{
+		"monitor": name,
+	})
+	// Get infra container ID
+	infraContainerId, err := pod.GetInfraContainerId()
+	if err != nil {
+		return types.POD_FAILED, err
+	}
+	logger.Debugf("Infra container ID: %s", infraContainerId)
+
+	// Containers are filtered by the taskId label stamped by general plugin
+	labels := make(map[string]string)
+	if taskId := pod.ComposeTaskInfo.GetTaskId().GetValue(); taskId != "" {
+		labels[types.TASK_ID_LABEL] = taskId
+	}
+
+	// Event stream is kept open until pod status is decided,
+	// it isn't bound to ctx which could be done once pod is launched
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events <-chan types.ContainerEvent
+	var errs <-chan error
+	var resubscribe <-chan time.Time
+	source, ok := pod.GetRuntime().(plugin.ContainerEventSource)
+	subscribe := func() {
+		events, errs = source.Events(streamCtx, labels, []string{types.CONTAINER_START, types.CONTAINER_DIE,
+			types.CONTAINER_HEALTH_STATUS})
+	}
+	if ok {
+		subscribe()
+	} else {
+		logger.Warnf("container runtime %s doesn't support events, pod status is only checked every %v",
+			pod.GetRuntime().Name(), config.GetReconcileInterval())
+	}
+
+	reconcile := func() types.PodStatus {
+		status, err := pod.CheckPodStatus(infraContainerId)
+		if err != nil {
+			// Error won't be considered as pod failure unless pod status is failed
+			logger.Warnf("error from monitor reconcile: %s", err)
+		}
+		return status
+	}
+
+	// Containers may have exited before subscription
+	if status := reconcile(); status != types.POD_EMPTY {
+		return status, nil
+	}
+
+	ticker := time.NewTicker(config.GetReconcileInterval())
+	defer ticker.Stop()
+
+	for {
+		var status types.PodStatus
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			status = handleEvent(event, infraContainerId)
+		case err := <-errs:
+			logger.Warnf("container event stream is closed: %v, resubscribe in %v", err, config.GetRetryInterval())
+			events, errs = nil, nil
+			resubscribe = time.After(config.GetRetryInterval())
+			status = reconcile()
+		case <-resubscribe:
+			resubscribe = nil
+			subscribe()
+			status = reconcile()
+		case <-ticker.C:
+			status = reconcile()
+		case <-ctx.Done():
+			// Monitor is stopped, e.g. pod is being killed
+			return pod.GetPodStatus(), nil
+		}
+		if status != types.POD_EMPTY {
+			return status, nil
+		}
+	}
+}
+
+// handleEvent decides pod status from a container event, POD_EMPTY is returned if pod is still running
+func handleEvent(event types.ContainerEvent, infraContainerId string) types.PodStatus {
+	logger := log.WithFields(log.Fields{
+		"monitor":   name,
+		"container": event.ContainerId,
+	})
+
+	// Containers are being stopped once pod is killed
+	if status := pod.GetPodStatus(); status == types.POD_KILLED {
+		return status
+	}
+
+	svcContainer, ok := pod.GetMonitoredContainer(event.ContainerId)
+	if !ok {
+		return types.POD_EMPTY
+	}
+
+	hc, ok := pod.GetHealthCheckList()[event.ContainerId]
+	hc = ok && hc
+
+	switch event.Action {
+	case types.CONTAINER_START:
+		// Restarted container is healthy once it's started unless it has health check
+		if hc {
+			pod.SetServiceHealth(svcContainer.ServiceName, types.STARTING.String())
+		} else {
+			pod.SetServiceHealth(svcContainer.ServiceName, types.HEALTHY.String())
+		}
+		pod.ReportPodHealth()
+	case types.CONTAINER_DIE:
+		// Exited container is restarted if it's allowed by restart policy of its service
+		if pod.RestartOnExit(svcContainer, event.ExitCode) {
+			pod.SetServiceHealth(svcContainer.ServiceName, pod.SERVICE_RESTARTING)
+			pod.ReportPodHealth()
+			return types.POD_EMPTY
+		}
+		if event.ExitCode != 0 {
+			logger.Errorf("container exited with code %d", event.ExitCode)
+			pod.SetTaskFailure(pod.NewContainerFailure(pod.MONITOR_STEP, svcContainer, event.ExitCode))
+			return types.POD_FAILED
+		}
+		logger.Info("Removed finished(exit with 0) container from monitor list")
+		pod.RemoveFromMonitorList(event.ContainerId)
+		pod.SetServiceHealth(svcContainer.ServiceName, "")
+		return pod.MonitorListStatus(infraContainerId)
+	case types.CONTAINER_HEALTH_STATUS:
+		if !hc {
+			return types.POD_EMPTY
+		}
+		if event.HealthStatus == types.UNHEALTHY.String() {
+			logger.Error("container becomes unhealthy")
+			metrics.HealthCheckFailures.WithLabelValues(svcContainer.ServiceName).Inc()
+		}
+		if event.HealthStatus != types.UNHEALTHY.String() || !config.CleanPodOnUnhealthy() {
+			pod.SetServiceHealth(svcContainer.ServiceName, event.HealthStatus)
+			pod.ReportPodHealth()
+			return types.POD_EMPTY
+		}
+		pod.SetTaskFailure(pod.NewContainerFailure(pod.MONITOR_STEP, svcContainer, 0))
+		if err := pod.PrintInspectDetail(event.ContainerId); err != nil {
+			logger.Warnf("failed to get container detail: %s ", err)
+		}
+		return types.POD_FAILED
+	}
+	return types.POD_EMPTY
+}
@@ -0,0 +1,97 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/dce/driver"
+	"github.com/paypal/dce-go/plugin"
+	fileUtils "github.com/paypal/dce-go/utils/file"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const RENDER_COMMAND = "render"
+
+// render writes compose files generated by LaunchTaskPreImagePull of plugins for task info into a folder,
+// along with a diff against the original files, without touching docker,
+// e.g. dce render -task task.json -dir ./manifest -out ./rendered
+func render(args []string) error {
+	fs := flag.NewFlagSet(RENDER_COMMAND, flag.ExitOnError)
+	task := fs.String("task", "", "task info file in json or protobuf (required)")
+	dir := fs.String("dir", ".", "directory of compose files in fileName label")
+	out := fs.String("out", "rendered", "directory to write generated compose files and "+fileUtils.RENDER_DIFF+" into")
+	fs.Parse(args)
+	if *task == "" {
+		fs.Usage()
+		return errors.New("task info file is required")
+	}
+
+	// Executor logs are kept out of stdout, which lists the rendered files
+	log.SetOutput(os.Stderr)
+	taskInfo, err := driver.ReadTaskInfo(*task)
+	if err != nil {
+		return err
+	}
+	outDir, err := filepath.Abs(*out)
+	if err != nil {
+		return err
+	}
+	sandbox, err := driver.PrepareSandbox(*dir, "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(sandbox)
+
+	logger = log.WithField("taskId", taskInfo.GetTaskId().GetValue())
+	pod.ComposeTaskInfo = taskInfo
+	config.OverrideConfig(taskInfo)
+	if pod.ComposeFiles, err = fileUtils.GetFiles(taskInfo); err != nil {
+		return err
+	}
+	if err = fileUtils.GenerateAppFolder(); err != nil {
+		return errors.Wrap(err, "failed to create app folder")
+	}
+
+	pluginOrder := getPluginOrder(taskInfo)
+	pod.PluginOrder = pluginOrder
+	extpoints = plugin.GetOrderedExtpoints(pluginOrder)
+	defer func() {
+		// Plugins clean up what they created for the task, such as resolved secrets
+		for _, ext := range extpoints {
+			if ext != nil {
+				ext.Shutdown(taskInfo, nil)
+			}
+		}
+	}()
+
+	executorId := taskInfo.GetExecutor().GetExecutorId().GetValue()
+	if err = launchTaskPreImagePull(context.Background(), pluginOrder, executorId, taskInfo); err != nil {
+		return errors.Wrap(err, "failed to render compose files")
+	}
+
+	files, err := fileUtils.WriteRenderedFiles(outDir)
+	for _, file := range files {
+		fmt.Println(file)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/dce/driver"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const RUN_COMMAND = "run"
+
+// run launches a pod from task info without mesos, Ctrl-C kills the task,
+// e.g. dce run -task task.json -dir ./manifest
+func run(args []string) error {
+	fs := flag.NewFlagSet(RUN_COMMAND, flag.ExitOnError)
+	task := fs.String("task", "", "task info file in json or protobuf (required)")
+	dir := fs.String("dir", ".", "directory of compose files in fileName label, which is copied into sandbox")
+	sandbox := fs.String("sandbox", "", "sandbox directory to run pod in, a temporary directory is created if it's empty")
+	fs.Parse(args)
+	if *task == "" {
+		fs.Usage()
+		return errors.New("task info file is required")
+	}
+
+	taskInfo, err := driver.ReadTaskInfo(*task)
+	if err != nil {
+		return err
+	}
+	path, err := driver.PrepareSandbox(*dir, *sandbox)
+	if err != nil {
+		return err
+	}
+	// log was opened in the dir executor is started by init of packages, reopen it in sandbox
+	log.SetOutput(config.CreateFileAppendMode(types.DCE_OUT))
+	fmt.Printf("Running task %s in sandbox %s, executor log is written into %s\n",
+		taskInfo.GetTaskId().GetValue(), path, filepath.Join(path, types.DCE_OUT))
+
+	local := driver.NewLocalDriver(newDockerComposeExecutor(), taskInfo, os.Stdout)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		go local.Kill()
+		<-sig
+		fmt.Println("Interrupted again, exiting without waiting for the task to be killed")
+		os.Exit(1)
+	}()
+
+	status, err := local.Run()
+	fmt.Printf("Driver exits with status %s\n", status)
+	return err
+}
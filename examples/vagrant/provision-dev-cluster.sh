@@ -122,7 +122,7 @@ function build_docker_compose_executor {
   sudo chmod 777 $GOPATH/src/github.com/paypal/dce-go
   cd $GOPATH/src/github.com/paypal/dce-go
   glide install --strip-vendor
-  go build -o executor $GOPATH/src/github.com/paypal/dce-go/dce/main.go
+  go build -o executor $GOPATH/src/github.com/paypal/dce-go/dce
   mv executor /home/vagrant
   sed -i.bkp '$a export GOROOT=/usr/local/go;export GOPATH=/home/vagrant/go;export PATH=$PATH:$GOPATH/bin:$GOROOT/bin' /home/vagrant/.bashrc
   . /home/vagrant/.bashrc
@@ -39,6 +39,10 @@ using process::Future;
 class ComposePodCleanupHook : public Hook
 {
 public:
+  // containerBinary is the cli managing containers, e.g. docker or podman.
+  explicit ComposePodCleanupHook(const std::string& containerBinary)
+    : containerBinary(containerBinary) {}
+
   // This hook is called when the executor is being removed.
   virtual Try<Nothing> slaveRemoveExecutorHook(
       const FrameworkInfo& frameworkInfo,
@@ -47,7 +51,7 @@ public:
     LOG(INFO) << "Executing 'slaveRemoveExecutorHook'";
     
     std::string executorId = executorInfo.executor_id().value();
-    std::string containerIdCommand = "docker ps -a --filter=\"label=executorId="+executorId+"\" -q 2>&1";
+    std::string containerIdCommand = containerBinary + " ps -a --filter=\"label=executorId="+executorId+"\" -q 2>&1";
     std::list<std::string> result = exec(containerIdCommand);
     
     if(result.empty()) {
@@ -61,7 +65,7 @@ public:
     std::list<std::string>::iterator it;
     std::string parentId;
     for(it = result.begin();it != result.end();++it) {
-        std::string cmd = "docker inspect --format {{.HostConfig.CgroupParent}} " + *it;
+        std::string cmd = containerBinary + " inspect --format {{.HostConfig.CgroupParent}} " + *it;
         std::list<std::string> cgParent = exec(cmd);
         if (!cgParent.empty()) {
           parentId = join(cgParent);
@@ -87,12 +91,12 @@ public:
   }
 
   std::list<std::string> stopContainer(std::string containerId) {
-    std::string command = "docker stop "+containerId;
+    std::string command = containerBinary + " stop "+containerId;
     return exec(command);
   }
 
   std::list<std::string> removeContainer(std::string containerId) {
-     std::string command = "docker rm -v "+containerId;
+     std::string command = containerBinary + " rm -v "+containerId;
      return exec(command);
   }
 
@@ -137,12 +141,22 @@ public:
      return result;
   }
 
+private:
+  const std::string containerBinary;
 };
 
 
 static Hook* createHook(const Parameters& parameters)
 {
-  return new ComposePodCleanupHook();
+  // Containers are managed by docker unless container_binary is set, e.g. podman
+  std::string containerBinary = "docker";
+  foreach (const Parameter& parameter, parameters.parameter()) {
+    if (parameter.key() == "container_binary") {
+      containerBinary = parameter.value();
+    }
+  }
+  LOG(INFO) << "ComposePodCleanupHook: using " << containerBinary;
+  return new ComposePodCleanupHook(containerBinary);
 }
 
 
@@ -275,3 +275,53 @@ func (ep *monitorExt) Names() []string {
 	}
 	return names
 }
+
+// ContainerRuntime
+
+var ContainerRuntimes = &containerRuntimeExt{
+	newExtensionPoint(new(ContainerRuntime)),
+}
+
+type containerRuntimeExt struct {
+	*extensionPoint
+}
+
+func (ep *containerRuntimeExt) Unregister(name string) bool {
+	return ep.unregister(name)
+}
+
+func (ep *containerRuntimeExt) Register(extension ContainerRuntime, name string) bool {
+	return ep.register(extension, name)
+}
+
+func (ep *containerRuntimeExt) Lookup(name string) ContainerRuntime {
+	ext := ep.lookup(name)
+	if ext == nil {
+		return nil
+	}
+	return ext.(ContainerRuntime)
+}
+
+func (ep *containerRuntimeExt) Select(names []string) []ContainerRuntime {
+	var selected []ContainerRuntime
+	for _, name := range names {
+		selected = append(selected, ep.Lookup(name))
+	}
+	return selected
+}
+
+func (ep *containerRuntimeExt) All() map[string]ContainerRuntime {
+	all := make(map[string]ContainerRuntime)
+	for k, v := range ep.all() {
+		all[k] = v.(ContainerRuntime)
+	}
+	return all
+}
+
+func (ep *containerRuntimeExt) Names() []string {
+	var names []string
+	for k := range ep.all() {
+		names = append(names, k)
+	}
+	return names
+}
@@ -12,7 +12,7 @@
  * limitations under the License.
  */
 
-//go:generate go-extpoints . ComposePlugin PodStatusHook Monitor
+//go:generate go-extpoints . ComposePlugin PodStatusHook Monitor ContainerRuntime
 package plugin
 
 import (
@@ -67,3 +67,79 @@ type PodStatusHook interface {
 type Monitor interface {
 	Start(ctx context.Context) (types.PodStatus, error)
 }
+
+// ContainerRuntime abstracts the container engine used to run and inspect the containers of a pod.
+// Runtime name presents in config `containerRuntime.runtimeName` will be used, otherwise, docker-compose cli runtime
+// will be used.
+type ContainerRuntime interface {
+	// Name gets the name of the runtime
+	Name() string
+
+	// Up launches all the services defined in compose files in detached mode
+	Up(files []string) error
+
+	// Stop stops the services, or all the services defined in compose files if no service is given,
+	// waiting timeout seconds before killing them
+	Stop(files []string, timeout int, services ...string) error
+
+	// Restart restarts containers of a single service defined in compose files
+	Restart(files []string, service string) error
+
+	// Down removes containers of compose files, with their volumes and images if required
+	Down(files []string, removeVolumes bool, removeImages bool) error
+
+	// Pull pulls images of all the services defined in compose files
+	Pull(files []string) error
+
+	// Validate validates compose files
+	Validate(files []string) error
+
+	// Ps returns container ids of a service, or of all the services if service is empty
+	Ps(files []string, service string) ([]string, error)
+
+	// Status returns a human readable summary of containers in compose files
+	Status(files []string) (string, error)
+
+	// Inspect returns status details of a container
+	Inspect(containerId string, healthcheck bool) (types.ContainerStatusDetails, error)
+
+	// InspectRaw returns the complete inspect output of a container
+	InspectRaw(containerId string) ([]byte, error)
+
+	// HasHealthCheck checks if health check is configured for a container
+	HasHealthCheck(containerId string) (bool, error)
+
+	// Kill sends a signal to a container, runtime default signal is sent if sig is empty
+	Kill(containerId string, sig string) error
+
+	// Logs follows logs of containers in compose files until they stop, and keeps retrying if retry is true
+	Logs(files []string, retry bool) error
+
+	// Port returns the host port which a container port is published to
+	Port(containerId string, privatePort string) (string, error)
+
+	// ContainerNetwork returns the network mode of a container
+	ContainerNetwork(containerId string) (string, error)
+
+	// RemoveNetwork removes a network
+	RemoveNetwork(name string) error
+}
+
+// ImagePuller can be optionally implemented by a ContainerRuntime to manage images one by one,
+// so that images of a pod are pulled in parallel and retried individually.
+type ImagePuller interface {
+	// PullImage pulls an image until it's done or ctx is done
+	PullImage(ctx context.Context, image string) error
+
+	// ImageDigest returns repo digest of a local image such as sha256:..., exists is false if image isn't present.
+	// Digest is empty if image isn't pulled from a registry.
+	ImageDigest(image string) (digest string, exists bool, err error)
+}
+
+// ContainerEventSource can be optionally implemented by a ContainerRuntime to stream container events,
+// so that monitors are able to react on container changes without polling.
+type ContainerEventSource interface {
+	// Events streams events of containers with all the labels and one of the actions until ctx is done.
+	// Events channel is closed when the stream ends, and the error which ends the stream is sent to error channel.
+	Events(ctx context.Context, labels map[string]string, actions []string) (<-chan types.ContainerEvent, <-chan error)
+}
@@ -17,7 +17,6 @@ package general
 import (
 	"container/list"
 	"context"
-	"errors"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -27,15 +26,20 @@ import (
 	"github.com/paypal/dce-go/types"
 	utils "github.com/paypal/dce-go/utils/file"
 	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	PORT_DELIMITER  = ":"
 	PATH_DELIMITER  = "/"
-	TASK_ID         = "taskId"
-	EXECUTOR_ID     = "executorId"
+	TASK_ID         = types.TASK_ID_LABEL
+	EXECUTOR_ID     = types.EXECUTOR_ID_LABEL
 	DEFAULT_VERSION = "2.1"
+	// keys of long port syntax
+	TARGET    = "target"
+	PUBLISHED = "published"
+	PROTOCOL  = "protocol"
 )
 
 func editComposeFile(file string, executorId string, taskId string, ports *list.Element,
@@ -54,15 +58,25 @@ func editComposeFile(file string, executorId string, taskId string, ports *list.
 		return "", ports, nil
 	}
 
+	// All the files in pod share the same compose version
+	version := getVersion(filesMap)
+
 	for serviceName := range servMap {
-		ports, err = updateServiceSessions(serviceName.(string), file, executorId, taskId, filesMap, ports, extraHosts)
+		ports, err = updateServiceSessions(serviceName.(string), file, executorId, taskId, version, filesMap, ports,
+			extraHosts)
 		if err != nil {
 			log.Printf("Failed updating services: %v \n", err)
 			return file, ports, err
 		}
 	}
 
-	filesMap[file][types.VERSION] = getVersion(filesMap, file)
+	resolveFileSources(filesMap[file], file)
+
+	if version != "" {
+		filesMap[file][types.VERSION] = version
+	} else {
+		delete(filesMap[file], types.VERSION)
+	}
 
 	if !strings.Contains(file, utils.FILE_POSTFIX) {
 		filesMap[file+utils.FILE_POSTFIX] = filesMap[file]
@@ -71,30 +85,88 @@ func editComposeFile(file string, executorId string, taskId string, ports *list.
 	}
 	pod.SetServiceDetail(filesMap)
 
-	logger.Debugf("Updated compose files, current context: %v", filesMap)
+	logger.Debugf("Updated compose files, current context: %v", redact.Value(filesMap))
 	return file, ports, err
 }
 
-func getVersion(filesMap types.ServiceDetail, file string) string {
-	currentVersion, ok := filesMap[file][types.VERSION].(string)
-	if !ok {
-		log.Errorf("Error find version or cast version to string. Defaulting it to %s", DEFAULT_VERSION)
+// getVersion returns compose version of generated files, which must be the same across all the files in pod.
+// The highest version of compose files is used if it's 2.1 or above, including 3.x, otherwise it's upgraded to 2.1.
+// Empty version is returned if none of the files has version, since compose-spec files don't require it.
+func getVersion(filesMap types.ServiceDetail) string {
+	if len(filesMap) == 0 {
 		return DEFAULT_VERSION
 	}
-	currentVersionFloat, err := strconv.ParseFloat(currentVersion, 64)
-	if err != nil {
-		log.Errorf("Error trying to change version from str to float. Defaulting it to %s", DEFAULT_VERSION)
+
+	var version string
+	var maxVersion float64
+	for file, composeMap := range filesMap {
+		v, ok := composeMap[types.VERSION]
+		if !ok || v == nil {
+			continue
+		}
+		currentVersion := fmt.Sprint(v)
+		currentVersionFloat, err := strconv.ParseFloat(currentVersion, 64)
+		if err != nil {
+			log.Errorf("Error trying to change version %s of %s from str to float. Defaulting it to %s",
+				currentVersion, file, DEFAULT_VERSION)
+			currentVersion, currentVersionFloat = DEFAULT_VERSION, 2.1
+		}
+		if version == "" || currentVersionFloat > maxVersion {
+			version, maxVersion = currentVersion, currentVersionFloat
+		}
+	}
+
+	if version != "" && maxVersion < 2.1 {
 		return DEFAULT_VERSION
 	}
-	if currentVersionFloat > 2.1 && currentVersionFloat < 3.0 {
-		return fmt.Sprintf("%.1f", currentVersionFloat)
+	return version
+}
+
+// isVersionAtLeast checks whether compose version is at least the minimum version, compose-spec files without
+// version support all the features
+func isVersionAtLeast(version string, minVersion float64) bool {
+	if version == "" {
+		return true
+	}
+	v, err := strconv.ParseFloat(version, 64)
+	return err == nil && v >= minVersion
+}
+
+// resolveFileSources resolves relative file of top-level configs and secrets against the original compose file,
+// since generated compose file is written into pod folder
+func resolveFileSources(composeMap map[string]interface{}, file string) {
+	if !config.GetConfig().GetBool(types.NO_FOLDER) {
+		file = strings.TrimPrefix(file, strings.TrimSpace(config.GetAppFolder())+PATH_DELIMITER)
 	}
+	dir := filepath.Dir(file)
 
-	return DEFAULT_VERSION
+	for _, section := range []string{types.CONFIGS, types.SECRETS} {
+		sources, ok := composeMap[section].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, source := range sources {
+			sourceMap, ok := source.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			path, ok := sourceMap[types.FILE].(string)
+			if !ok || filepath.IsAbs(path) {
+				continue
+			}
+			absPath, err := filepath.Abs(filepath.Join(dir, path))
+			if err != nil {
+				log.Warnf("Error resolving file %s of %s %v: %v", path, section, name, err)
+				continue
+			}
+			sourceMap[types.FILE] = absPath
+			logger.Printf("Edit Compose File : Resolved file of %s %v as %s", section, name, absPath)
+		}
+	}
 }
 
-func updateServiceSessions(serviceName, file, executorId, taskId string, filesMap types.ServiceDetail, ports *list.Element,
-	extraHosts map[interface{}]bool) (*list.Element, error) {
+func updateServiceSessions(serviceName, file, executorId, taskId, version string, filesMap types.ServiceDetail,
+	ports *list.Element, extraHosts map[interface{}]bool) (*list.Element, error) {
 	containerDetails, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})[serviceName].(map[interface{}]interface{})
 	if !ok {
 		log.Println("POD_UPDATE_YAML_FAIL")
@@ -104,10 +176,37 @@ func updateServiceSessions(serviceName, file, executorId, taskId string, filesMa
 		"taskId":      taskId,
 	})
 
-	// Remove restart session
-	if _, ok := containerDetails[types.RESTART].(string); ok {
+	if deploy, ok := containerDetails[types.DEPLOY].(map[interface{}]interface{}); ok {
+		// Remove restart policy of deploy session, it's honoured by executor the same as restart session
+		if restart, ok := deploy[types.RESTART_POLICY]; ok {
+			policy, err := pod.ParseRestartPolicy(restart)
+			if err != nil {
+				logger.Errorf("Edit Compose File : %v", err)
+				return nil, err
+			}
+			pod.SetRestartPolicy(serviceName, policy)
+			delete(deploy, types.RESTART_POLICY)
+			logger.Printf("Edit Compose File : Remove deploy restart_policy, restart policy %+v", policy)
+		}
+
+		// Resources of deploy session are only applied by docker-compose in compatibility mode for compose v3,
+		// compose-spec files are supported by docker compose natively
+		if _, ok := deploy[types.RESOURCES]; ok && strings.HasPrefix(version, "3") {
+			config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, true)
+			logger.Println("Edit Compose File : Enable compatibility mode for deploy resources")
+		}
+	}
+
+	// Remove restart session, restart policy is honoured by executor instead of docker
+	if restart, ok := containerDetails[types.RESTART]; ok {
+		policy, err := pod.ParseRestartPolicy(restart)
+		if err != nil {
+			logger.Errorf("Edit Compose File : %v", err)
+			return nil, err
+		}
+		pod.SetRestartPolicy(serviceName, policy)
 		delete(containerDetails, types.RESTART)
-		log.Println("Edit Compose File : Remove restart")
+		logger.Printf("Edit Compose File : Remove restart, restart policy %+v", policy)
 	}
 
 	// save extra host section of all services for moving them to infra container later
@@ -117,11 +216,11 @@ func updateServiceSessions(serviceName, file, executorId, taskId string, filesMa
 	var envIsArray bool
 	envMap, ok := containerDetails[types.ENVIRONMENT].(map[interface{}]interface{})
 	if ok {
-		logger.Printf("ENV is an array %v of %s : %v", envIsArray, serviceName, envMap)
+		logger.Printf("ENV is an array %v of %s : %v", envIsArray, serviceName, redact.Value(envMap))
 	}
 	envList, ok := containerDetails[types.ENVIRONMENT].([]interface{})
 	if ok {
-		logger.Printf("ENV is an array %v of %s : %v", envIsArray, serviceName, envList)
+		logger.Printf("ENV is an array %v of %s : %v", envIsArray, serviceName, redact.Value(envList))
 		envIsArray = true
 	}
 	if envMap == nil && envList == nil {
@@ -195,19 +294,23 @@ func updateServiceSessions(serviceName, file, executorId, taskId string, filesMa
 
 			if portList, ok := containerDetails[types.PORTS].([]interface{}); ok {
 
-				for i, p := range portList {
-					portMap := strings.Split(p.(string), PORT_DELIMITER)
-					if len(portMap) > 1 {
-						if ports == nil {
-							return nil, errors.New("no ports available")
-						}
-						p = strconv.FormatUint(ports.Value.(uint64), 10) + PORT_DELIMITER + portMap[1]
-						portList[i] = p.(string)
-						ports = ports.Next()
-					} else {
+				var allocated []servicePort
+				var err error
+				portList, ports, allocated, err = editPorts(serviceName, portList, ports)
+				if err != nil {
+					logger.Errorf("Edit Compose File : %v", err)
+					return nil, err
+				}
+				for i := range allocated {
+					allocated[i].PublishedBy = serviceName
+					if strings.Contains(networkMode, "service:") {
+						allocated[i].PublishedBy = types.INFRA_CONTAINER
+					}
+					if allocated[i].Published == 0 {
 						pod.SinglePort = true
 					}
 				}
+				addServicePorts(allocated)
 
 				if strings.Contains(networkMode, "service:") {
 					config_port := config.GetConfig().Get(types.PORTS)
@@ -254,6 +357,8 @@ func postEditComposeFile(file string) error {
 			return err
 		}
 	}
+	// Dynamic ports are only visible to containers created after compose files are updated
+	injectPortEnv(filesMap)
 	pod.SetServiceDetail(filesMap)
 	err = utils.WriteChangeToFiles()
 	if err != nil {
@@ -272,15 +377,39 @@ func updateDynamicPorts(serviceName, file string, filesMap *types.ServiceDetail)
 	}
 	if portList, ok := containerDetails[types.PORTS].([]interface{}); ok {
 		for i, p := range portList {
-			portMap := strings.Split(p.(string), PORT_DELIMITER)
-			if len(portMap) == 1 {
-				dynamicPort, err := pod.GetDockerPorts(ids[0], portMap[0])
+			port, err := parsePort(p)
+			if err != nil {
+				log.Errorf("Error parsing port %v : %v", p, err)
+				continue
+			}
+			if !port.IsDynamic() {
+				continue
+			}
+
+			var published []uint64
+			for _, target := range port.Targets() {
+				dynamicPort, err := pod.GetDockerPorts(ids[0], port.PrivatePort(target))
 				if err != nil {
 					log.Errorf("Error retrieving docker dynamic port : %v", err)
 				}
-				p = dynamicPort + PORT_DELIMITER + portMap[0]
-				portList[i] = p.(string)
+				hostPort, err := strconv.ParseUint(dynamicPort, 10, 16)
+				if err != nil {
+					log.Errorf("Error parsing docker dynamic port %s of %s : %v", dynamicPort, port.PrivatePort(target), err)
+					break
+				}
+				published = append(published, hostPort)
+			}
+			if len(published) != len(port.Targets()) {
+				continue
+			}
+			// Host ports allocated by docker for a port range could only be written back if they're contiguous
+			if published[len(published)-1]-published[0] != uint64(len(published)-1) {
+				log.Warnf("Docker dynamic ports %v of %v aren't contiguous", published, p)
+				continue
 			}
+			port.SetPublished(published[0], published[len(published)-1])
+			portList[i] = port.Value()
+			setDynamicPorts(serviceName, port, published)
 		}
 
 		containerDetails[types.PORTS] = portList
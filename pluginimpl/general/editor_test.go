@@ -17,6 +17,7 @@ package general
 import (
 	"container/list"
 	"context"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/paypal/dce-go/config"
 	"github.com/paypal/dce-go/types"
 	"github.com/paypal/dce-go/utils/file"
+	"github.com/paypal/dce-go/utils/pod"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -160,3 +162,87 @@ func Test_addExtraHostsSection(t *testing.T) {
 	addExtraHostsSection(ctx, "testdata/docker-extra-host.yml", "fake", extraHosts)
 	assert.Equal(t, preCtx, ctx, "Adding extra host to non exist service")
 }
+
+func Test_getVersion(t *testing.T) {
+	testCases := []struct {
+		versions []interface{}
+		expected string
+	}{
+		{nil, DEFAULT_VERSION},
+		{[]interface{}{"2"}, DEFAULT_VERSION},
+		{[]interface{}{"2.1", "2.4"}, "2.4"},
+		{[]interface{}{"3.8", nil}, "3.8"},
+		{[]interface{}{3.2, "3"}, "3.2"},
+		{[]interface{}{nil, nil}, ""},
+		{[]interface{}{"x"}, DEFAULT_VERSION},
+	}
+	for _, tc := range testCases {
+		filesMap := make(types.ServiceDetail)
+		for i, v := range tc.versions {
+			composeMap := make(map[string]interface{})
+			if v != nil {
+				composeMap[types.VERSION] = v
+			}
+			filesMap[strconv.Itoa(i)] = composeMap
+		}
+		assert.Equal(t, tc.expected, getVersion(filesMap), "versions %v", tc.versions)
+	}
+
+	assert.True(t, isVersionAtLeast("", 3.5), "compose-spec supports all the features")
+	assert.True(t, isVersionAtLeast("3.8", 3.5))
+	assert.False(t, isVersionAtLeast("2.1", 3.5))
+}
+
+func Test_editComposeFileV3(t *testing.T) {
+	config.GetConfig().Set(types.NO_FOLDER, true)
+	defer config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, false)
+	defer pod.SetRestartPolicy("web", types.RestartPolicy{Condition: types.RESTART_NO})
+
+	servDetail, err := file.ParseYamls(&[]string{"testdata/docker-compose-v3.yml"})
+	assert.NoError(t, err)
+	pod.SetServiceDetail(servDetail)
+	defer pod.SetServiceDetail(make(types.ServiceDetail))
+
+	var ports list.List
+	ports.PushBack(uint64(1000))
+	ports.PushBack(uint64(2000))
+	ports.PushBack(uint64(3000))
+
+	editedFile, curPort, err := editComposeFile("testdata/docker-compose-v3.yml", "executorId", "taskId", ports.Front(),
+		make(map[interface{}]bool))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3000), curPort.Value, "two published ports should be allocated")
+
+	composeMap := pod.GetServiceDetail()[editedFile]
+	assert.Equal(t, "3.8", composeMap[types.VERSION], "compose v3 version should be kept")
+	assert.True(t, config.GetConfig().GetBool(types.COMPOSE_COMPATIBILITY),
+		"compatibility mode should be enabled for deploy resources")
+
+	web := composeMap[types.SERVICES].(map[interface{}]interface{})["web"].(map[interface{}]interface{})
+	deploy := web[types.DEPLOY].(map[interface{}]interface{})
+	assert.NotContains(t, deploy, types.RESTART_POLICY)
+	assert.Contains(t, deploy, types.RESOURCES)
+	_, policy, _ := pod.GetRestartCount("web")
+	assert.Equal(t, types.RestartPolicy{Condition: types.RESTART_ON_FAILURE, MaxRetries: 3}, policy)
+
+	assert.Equal(t, []interface{}{
+		map[interface{}]interface{}{TARGET: 80, PUBLISHED: uint64(1000), PROTOCOL: "tcp"},
+		map[interface{}]interface{}{TARGET: 443},
+		"2000:9090",
+	}, config.GetConfig().Get(types.PORTS), "ports should be moved to infra container")
+
+	token, _ := filepath.Abs("testdata/token.txt")
+	secrets := composeMap[types.SECRETS].(map[interface{}]interface{})
+	assert.Equal(t, token, secrets["token"].(map[interface{}]interface{})[types.FILE])
+	configs := composeMap[types.CONFIGS].(map[interface{}]interface{})
+	assert.Equal(t, "/etc/nginx/nginx.conf", configs["nginx"].(map[interface{}]interface{})[types.FILE])
+	config.GetConfig().Set(types.PORTS, nil)
+
+	// compose-spec file without version
+	pod.SetServiceDetail(types.ServiceDetail{"spec.yml": {
+		types.SERVICES: map[interface{}]interface{}{"app": map[interface{}]interface{}{types.IMAGE: "app"}},
+	}})
+	editedFile, _, err = editComposeFile("spec.yml", "executorId", "taskId", nil, make(map[interface{}]bool))
+	assert.NoError(t, err)
+	assert.NotContains(t, pod.GetServiceDetail()[editedFile], types.VERSION, "compose-spec file should be versionless")
+}
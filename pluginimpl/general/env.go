@@ -0,0 +1,158 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/paypal/dce-go/types"
+)
+
+const (
+	PORT_ENV_PREFIX = "PORT"
+	ENV_DELIMITER   = "="
+)
+
+// servicePort is a container port of service and the host port it's published on
+type servicePort struct {
+	Service  string
+	Target   uint64
+	Protocol string
+	// Published is 0 until the host port allocated by docker is known
+	Published uint64
+	// PublishedBy is the service whose port mapping publishes the port, which is infra container if service
+	// joins its network
+	PublishedBy string
+}
+
+// servicePorts are ports of all the services in pod, in the order they are defined
+var servicePorts []servicePort
+
+// addServicePorts records ports of a service, which are exposed to all the services in pod as env vars
+func addServicePorts(ports []servicePort) {
+	servicePorts = append(servicePorts, ports...)
+}
+
+// setDynamicPorts records host ports allocated by docker for a port mapping of service
+func setDynamicPorts(service string, port *composePort, published []uint64) {
+	for k, target := range port.Targets() {
+		for i := range servicePorts {
+			sp := &servicePorts[i]
+			if sp.Published == 0 && sp.PublishedBy == service && sp.Target == target &&
+				sp.Protocol == port.protocol() {
+				sp.Published = published[k]
+				break
+			}
+		}
+	}
+}
+
+// portEnv returns env vars of allocated host ports. PORT_<SERVICE>_<TARGET> is the host port of a container port,
+// suffixed with protocol if it isn't tcp. PORT0..N are host ports of all the container ports ordered by service
+// name and the order they are defined in service.
+func portEnv() map[string]string {
+	ordered := make([]servicePort, len(servicePorts))
+	copy(ordered, servicePorts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Service < ordered[j].Service
+	})
+
+	env := make(map[string]string)
+	for i, sp := range ordered {
+		if sp.Published == 0 {
+			continue
+		}
+		published := strconv.FormatUint(sp.Published, 10)
+		name := fmt.Sprintf("%s_%s_%d", PORT_ENV_PREFIX, envName(sp.Service), sp.Target)
+		if sp.Protocol != DEFAULT_PORT_PROTOCOL {
+			name += "_" + envName(sp.Protocol)
+		}
+		env[name] = published
+		env[fmt.Sprintf("%s%d", PORT_ENV_PREFIX, i)] = published
+	}
+	return env
+}
+
+// envName converts name to upper case and replaces characters not allowed in env var name with underscore
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// injectPortEnv adds env vars of allocated host ports to every service in pod
+func injectPortEnv(filesMap types.ServiceDetail) {
+	env := portEnv()
+	if len(env) == 0 {
+		return
+	}
+	for file, composeMap := range filesMap {
+		servMap, ok := composeMap[types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for serviceName, detail := range servMap {
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			addServiceEnv(containerDetails, env)
+			logger.Printf("Edit Compose File : Add port env to service %v in %s", serviceName, file)
+		}
+	}
+}
+
+// addServiceEnv adds env vars to environment of service, which is either a map or a list of key=value.
+// Env vars defined in compose file aren't overridden.
+func addServiceEnv(containerDetails map[interface{}]interface{}, env map[string]string) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	switch environment := containerDetails[types.ENVIRONMENT].(type) {
+	case []interface{}:
+		defined := make(map[string]bool)
+		for _, e := range environment {
+			defined[strings.SplitN(fmt.Sprint(e), ENV_DELIMITER, 2)[0]] = true
+		}
+		for _, key := range keys {
+			if !defined[key] {
+				environment = append(environment, key+ENV_DELIMITER+env[key])
+			}
+		}
+		containerDetails[types.ENVIRONMENT] = environment
+	case map[interface{}]interface{}:
+		for _, key := range keys {
+			if _, ok := environment[key]; !ok {
+				environment[key] = env[key]
+			}
+		}
+	default:
+		envMap := make(map[interface{}]interface{})
+		for _, key := range keys {
+			envMap[key] = env[key]
+		}
+		containerDetails[types.ENVIRONMENT] = envMap
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"testing"
+
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func Test_injectPortEnv(t *testing.T) {
+	servicePorts = nil
+	defer func() { servicePorts = nil }()
+
+	addServicePorts([]servicePort{
+		{Service: "web-app", Target: 8080, Protocol: "tcp", Published: 31001, PublishedBy: types.INFRA_CONTAINER},
+		{Service: "web-app", Target: 53, Protocol: "udp", PublishedBy: types.INFRA_CONTAINER},
+	})
+	addServicePorts([]servicePort{{Service: "db", Target: 5432, Protocol: "tcp", Published: 31000,
+		PublishedBy: types.INFRA_CONTAINER}})
+	assert.Equal(t, map[string]string{
+		"PORT_DB_5432":      "31000",
+		"PORT_WEB_APP_8080": "31001",
+		"PORT0":             "31000",
+		"PORT1":             "31001",
+	}, portEnv(), "dynamic port should be skipped until it's allocated")
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web-app:
+    image: web
+    environment:
+      - PORT0=80
+      - DEBUG
+  db:
+    image: postgres
+    environment:
+      POSTGRES_DB: app
+  cache:
+    image: redis
+`), &compose))
+	filesMap := types.ServiceDetail{"docker-compose.yml": compose}
+	injectPortEnv(filesMap)
+
+	services := compose[types.SERVICES].(map[interface{}]interface{})
+	env := func(service string) interface{} {
+		return services[service].(map[interface{}]interface{})[types.ENVIRONMENT]
+	}
+	assert.Equal(t, []interface{}{"PORT0=80", "DEBUG", "PORT1=31001", "PORT_DB_5432=31000",
+		"PORT_WEB_APP_8080=31001"}, env("web-app"), "env defined in compose file shouldn't be overridden")
+	assert.Equal(t, map[interface{}]interface{}{"POSTGRES_DB": "app", "PORT0": "31000", "PORT1": "31001",
+		"PORT_DB_5432": "31000", "PORT_WEB_APP_8080": "31001"}, env("db"))
+	assert.Equal(t, map[interface{}]interface{}{"PORT0": "31000", "PORT1": "31001", "PORT_DB_5432": "31000",
+		"PORT_WEB_APP_8080": "31001"}, env("cache"))
+
+	port, err := parsePort("53/udp")
+	assert.NoError(t, err)
+	setDynamicPorts(types.INFRA_CONTAINER, port, []uint64{32768})
+	injectPortEnv(filesMap)
+	assert.Equal(t, "32768", env("cache").(map[interface{}]interface{})["PORT_WEB_APP_53_UDP"])
+	assert.Equal(t, "32768", env("cache").(map[interface{}]interface{})["PORT2"],
+		"dynamic port should be ordered by the service it's defined in")
+	assert.Contains(t, env("web-app"), "PORT_WEB_APP_53_UDP=32768")
+}
+
+func Test_setDynamicPorts(t *testing.T) {
+	servicePorts = nil
+	defer func() { servicePorts = nil }()
+
+	addServicePorts([]servicePort{{Service: "web", Target: 8080, Protocol: "tcp", PublishedBy: "web"}})
+	addServicePorts([]servicePort{{Service: "admin", Target: 8080, Protocol: "tcp", PublishedBy: "admin"}})
+
+	port, err := parsePort("8080")
+	assert.NoError(t, err)
+	setDynamicPorts("admin", port, []uint64{32768})
+	setDynamicPorts("web", port, []uint64{32769})
+	assert.Equal(t, map[string]string{
+		"PORT_ADMIN_8080": "32768",
+		"PORT_WEB_8080":   "32769",
+		"PORT0":           "32768",
+		"PORT1":           "32769",
+	}, portEnv(), "host port should be recorded for the service publishing the port")
+}
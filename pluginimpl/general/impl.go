@@ -27,6 +27,7 @@ import (
 	"github.com/paypal/dce-go/types"
 	utils "github.com/paypal/dce-go/utils/file"
 	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -84,6 +85,7 @@ func (ge *generalExt) LaunchTaskPreImagePull(ctx context.Context, composeFiles *
 	}
 
 	currentPort := pod.GetPorts(taskInfo)
+	servicePorts = nil
 
 	// Create infra container yml file
 	infrayml, err := CreateInfraContainer(ctx, types.INFRA_CONTAINER_YML)
@@ -131,8 +133,18 @@ func (ge *generalExt) LaunchTaskPreImagePull(ctx context.Context, composeFiles *
 		addExtraHostsSection(ctx, infraYmlPath, types.INFRA_CONTAINER, extraHosts)
 	}
 
+	// Expose host ports allocated from mesos to all the services
+	injectPortEnv(pod.GetServiceDetail())
+
+	// Apply cpus and mem of task as container limits of services
+	err = applyResourceLimits(pod.GetServiceDetail(), taskInfo)
+	if err != nil {
+		logger.Errorln("Error applying resource limits : ", err.Error())
+		return err
+	}
+
 	logger.Println("====================context out====================")
-	logger.Debugf("SERVICE_DETAIL: %+v", pod.GetServiceDetail())
+	logger.Debugf("SERVICE_DETAIL: %+v", redact.Value(pod.GetServiceDetail()))
 
 	*composeFiles = editedFiles
 
@@ -240,6 +252,9 @@ func CreateInfraContainer(ctx context.Context, path string) (string, error) {
 	containerDetail[types.CONTAINER_NAME] = config.GetConfigSection(config.INFRA_CONTAINER)[types.CONTAINER_NAME]
 	containerDetail[types.IMAGE] = config.GetConfigSection(config.INFRA_CONTAINER)[types.IMAGE]
 
+	// Infra container file has the same version as compose files in pod
+	version := getVersion(pod.GetServiceDetail())
+
 	if network, ok := config.GetNetwork(); ok {
 		if network.PreExist {
 			serviceNetworks := make(map[string]interface{})
@@ -249,9 +264,17 @@ func CreateInfraContainer(ctx context.Context, path string) (string, error) {
 				log.Warningln("Error in configuration file! Network Name is required if PreExist is true")
 				return "", errors.New("NetworkName missing in general.yaml")
 			}
-			name[types.NAME] = network.Name
-			external[types.NETWORK_EXTERNAL] = name
-			serviceNetworks[types.NETWORK_DEFAULT_NAME] = external
+			// external.name is deprecated since compose 3.5 in favor of name
+			if isVersionAtLeast(version, 3.5) {
+				serviceNetworks[types.NETWORK_DEFAULT_NAME] = map[string]interface{}{
+					types.NAME:             network.Name,
+					types.NETWORK_EXTERNAL: true,
+				}
+			} else {
+				name[types.NAME] = network.Name
+				external[types.NETWORK_EXTERNAL] = name
+				serviceNetworks[types.NETWORK_DEFAULT_NAME] = external
+			}
 			_yaml[types.NETWORKS] = serviceNetworks
 
 		} else {
@@ -273,7 +296,9 @@ func CreateInfraContainer(ctx context.Context, path string) (string, error) {
 
 	service[types.INFRA_CONTAINER] = containerDetail
 	_yaml[types.SERVICES] = service
-	_yaml[types.VERSION] = "2.1"
+	if version != "" {
+		_yaml[types.VERSION] = version
+	}
 	log.Println(_yaml)
 
 	content, _ := yaml.Marshal(_yaml)
@@ -16,6 +16,7 @@ package general
 
 import (
 	"context"
+	"os"
 	"os/exec"
 	"strconv"
 	"testing"
@@ -23,6 +24,7 @@ import (
 	"github.com/mesos/mesos-go/api/v0/mesosproto"
 	"github.com/paypal/dce-go/config"
 	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,6 +37,28 @@ func TestCreateInfraContainer(t *testing.T) {
 	}
 }
 
+func TestCreateInfraContainerV3(t *testing.T) {
+	config.GetConfig().SetDefault(types.NO_FOLDER, true)
+	pod.SetServiceDetail(types.ServiceDetail{"docker-compose.yml": {types.VERSION: "3.8"}})
+	defer pod.SetServiceDetail(make(types.ServiceDetail))
+
+	file, err := CreateInfraContainer(context.Background(), "testdata/docker-infra-container-v3.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file)
+
+	infra := pod.GetServiceDetail()[file]
+	assert.Equal(t, "3.8", infra[types.VERSION], "infra container should have the same version as compose files")
+	assert.Equal(t, map[string]interface{}{
+		types.NETWORK_DEFAULT_NAME: map[string]interface{}{types.NAME: "net", types.NETWORK_EXTERNAL: true},
+	}, infra[types.NETWORKS])
+
+	pod.SetServiceDetail(types.ServiceDetail{"docker-compose.yml": {}})
+	file, err = CreateInfraContainer(context.Background(), "testdata/docker-infra-container-v3.yml")
+	assert.NoError(t, err)
+	defer os.Remove(file)
+	assert.NotContains(t, pod.GetServiceDetail()[file], types.VERSION, "compose-spec infra container is versionless")
+}
+
 func TestGeneralExt_LaunchTaskPreImagePull(t *testing.T) {
 	config.GetConfig().SetDefault(types.NO_FOLDER, true)
 	g := new(generalExt)
@@ -0,0 +1,273 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PORT_RANGE_DELIMITER  = "-"
+	PROTOCOL_DELIMITER    = "/"
+	IPV6_ADDRESS_END      = "]:"
+	HOST_IP               = "host_ip"
+	DEFAULT_PORT_PROTOCOL = "tcp"
+)
+
+// composePort is a port mapping of service in compose file, in either short syntax such as
+// "127.0.0.1:8000-8010:8000-8010/udp" or long syntax such as {target: 80, published: 8080, protocol: tcp}
+type composePort struct {
+	HostIP string
+	// Published is host port or port range, it's empty if host port is allocated by docker
+	Published string
+	// Target is container port or port range
+	Target   string
+	Protocol string
+	// long is the original long syntax mapping, other keys such as mode are kept when it's updated
+	long map[interface{}]interface{}
+}
+
+// parsePort parses a port mapping of service in compose file
+func parsePort(p interface{}) (*composePort, error) {
+	switch v := p.(type) {
+	case map[interface{}]interface{}:
+		port := &composePort{long: v}
+		if target, ok := v[TARGET]; ok && target != nil {
+			port.Target = fmt.Sprint(target)
+		}
+		if published, ok := v[PUBLISHED]; ok && published != nil {
+			port.Published = fmt.Sprint(published)
+		}
+		if hostIP, ok := v[HOST_IP].(string); ok {
+			port.HostIP = hostIP
+		}
+		if protocol, ok := v[PROTOCOL].(string); ok {
+			port.Protocol = protocol
+		}
+		return port, port.validate(p)
+	case string, int, uint64:
+		return parseShortPort(fmt.Sprint(v))
+	}
+	return nil, errors.Errorf("invalid port %v", p)
+}
+
+// parseShortPort parses short port syntax [[ip:][published]:]target[/protocol]
+func parseShortPort(s string) (*composePort, error) {
+	port := &composePort{}
+	value := strings.TrimSpace(s)
+	if i := strings.LastIndex(value, PROTOCOL_DELIMITER); i >= 0 {
+		value, port.Protocol = value[:i], value[i+1:]
+	}
+
+	// IPv6 host ip is enclosed in brackets, e.g. [::1]:8080:80
+	if strings.HasPrefix(value, "[") {
+		i := strings.Index(value, IPV6_ADDRESS_END)
+		if i < 0 {
+			return nil, errors.Errorf("invalid port %s", s)
+		}
+		port.HostIP, value = value[:i+1], value[i+len(IPV6_ADDRESS_END):]
+		parts := strings.Split(value, PORT_DELIMITER)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid port %s", s)
+		}
+		port.Published, port.Target = parts[0], parts[1]
+		return port, port.validate(s)
+	}
+
+	parts := strings.Split(value, PORT_DELIMITER)
+	switch len(parts) {
+	case 1:
+		port.Target = parts[0]
+	case 2:
+		port.Published, port.Target = parts[0], parts[1]
+	case 3:
+		port.HostIP, port.Published, port.Target = parts[0], parts[1], parts[2]
+	default:
+		return nil, errors.Errorf("invalid port %s", s)
+	}
+	return port, port.validate(s)
+}
+
+func (p *composePort) validate(original interface{}) error {
+	targetSize, err := portRangeSize(p.Target)
+	if err != nil {
+		return errors.Wrapf(err, "invalid target of port %v", original)
+	}
+	if p.Published == "" {
+		return nil
+	}
+	publishedSize, err := portRangeSize(p.Published)
+	if err != nil {
+		return errors.Wrapf(err, "invalid published port of %v", original)
+	}
+	// a single container port could be published on any port in a range
+	if targetSize != 1 && targetSize != publishedSize {
+		return errors.Errorf("port range of %v doesn't match: %d published ports for %d target ports",
+			original, publishedSize, targetSize)
+	}
+	return nil
+}
+
+// portRange parses port or port range such as 8000-8010
+func portRange(s string) (uint64, uint64, error) {
+	parts := strings.SplitN(s, PORT_RANGE_DELIMITER, 2)
+	begin, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid port %s", s)
+	}
+	end := begin
+	if len(parts) == 2 {
+		end, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16)
+		if err != nil || end < begin {
+			return 0, 0, errors.Errorf("invalid port range %s", s)
+		}
+	}
+	return begin, end, nil
+}
+
+func portRangeSize(s string) (uint64, error) {
+	begin, end, err := portRange(s)
+	if err != nil {
+		return 0, err
+	}
+	return end - begin + 1, nil
+}
+
+// Targets returns container ports of the mapping
+func (p *composePort) Targets() []uint64 {
+	begin, end, _ := portRange(p.Target)
+	var targets []uint64
+	for i := begin; i <= end; i++ {
+		targets = append(targets, i)
+	}
+	return targets
+}
+
+// IsDynamic checks whether host port is allocated by docker
+func (p *composePort) IsDynamic() bool {
+	return p.Published == ""
+}
+
+// SetPublished updates host port of the mapping, to a port range if there are more than one port
+func (p *composePort) SetPublished(begin, end uint64) {
+	if begin == end {
+		p.Published = strconv.FormatUint(begin, 10)
+	} else {
+		p.Published = fmt.Sprintf("%d%s%d", begin, PORT_RANGE_DELIMITER, end)
+	}
+	if p.long != nil {
+		if begin == end {
+			p.long[PUBLISHED] = begin
+		} else {
+			p.long[PUBLISHED] = p.Published
+		}
+	}
+}
+
+// Value returns the mapping in the syntax it's defined in compose file
+func (p *composePort) Value() interface{} {
+	if p.long != nil {
+		return p.long
+	}
+	s := p.Target
+	if p.Published != "" || p.HostIP != "" {
+		s = p.Published + PORT_DELIMITER + s
+	}
+	if p.HostIP != "" {
+		s = p.HostIP + PORT_DELIMITER + s
+	}
+	if p.Protocol != "" {
+		s += PROTOCOL_DELIMITER + p.Protocol
+	}
+	return s
+}
+
+// PrivatePort returns container port with protocol, e.g. 80/tcp
+func (p *composePort) PrivatePort(target uint64) string {
+	return fmt.Sprintf("%d%s%s", target, PROTOCOL_DELIMITER, p.protocol())
+}
+
+func (p *composePort) protocol() string {
+	if p.Protocol == "" {
+		return DEFAULT_PORT_PROTOCOL
+	}
+	return strings.ToLower(p.Protocol)
+}
+
+// allocatePorts allocates n contiguous ports from mesos port resources starting from the current port.
+// Ports skipped for a contiguous range aren't allocated any more.
+func allocatePorts(ports *list.Element, n uint64) (uint64, uint64, *list.Element, error) {
+	var available uint64
+	for e := ports; e != nil; e = e.Next() {
+		available++
+	}
+
+	for start := ports; start != nil; {
+		begin := start.Value.(uint64)
+		count := uint64(1)
+		e := start.Next()
+		for ; count < n && e != nil && e.Value.(uint64) == begin+count; e = e.Next() {
+			count++
+		}
+		if count == n {
+			return begin, begin + n - 1, e, nil
+		}
+		// current run of ports is too short, continue from the next run
+		start = e
+	}
+	return 0, 0, ports, errors.Errorf("not enough ports in mesos resources: %d contiguous ports are required, "+
+		"%d ports are left", n, available)
+}
+
+// editPorts allocates host ports from mesos port resources for port mappings of a service.
+// Ports allocated by docker are kept as is, their published ports are 0 in the returned service ports.
+func editPorts(service string, portList []interface{}, ports *list.Element) ([]interface{}, *list.Element,
+	[]servicePort, error) {
+	var allocated []servicePort
+	edited := make([]interface{}, 0, len(portList))
+	for _, p := range portList {
+		port, err := parsePort(p)
+		if err != nil {
+			return nil, ports, nil, err
+		}
+		if port.IsDynamic() {
+			for _, target := range port.Targets() {
+				allocated = append(allocated, servicePort{Service: service, Target: target, Protocol: port.protocol()})
+			}
+			edited = append(edited, port.Value())
+			continue
+		}
+
+		// a single container port published on a port range only needs one port
+		n := uint64(len(port.Targets()))
+		begin, end, next, err := allocatePorts(ports, n)
+		if err != nil {
+			return nil, ports, nil, errors.Wrapf(err, "failed to allocate host port for %v", p)
+		}
+		port.SetPublished(begin, end)
+		for k, target := range port.Targets() {
+			allocated = append(allocated, servicePort{Service: service, Target: target, Protocol: port.protocol(),
+				Published: begin + uint64(k)})
+		}
+		edited = append(edited, port.Value())
+		ports = next
+	}
+	return edited, ports, allocated, nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parsePort(t *testing.T) {
+	testCases := []struct {
+		port     interface{}
+		expected composePort
+		err      bool
+	}{
+		{"80", composePort{Target: "80"}, false},
+		{8080, composePort{Target: "8080"}, false},
+		{"3000-3005", composePort{Target: "3000-3005"}, false},
+		{"8000:80", composePort{Published: "8000", Target: "80"}, false},
+		{"9090-9091:8080-8081", composePort{Published: "9090-9091", Target: "8080-8081"}, false},
+		{"9090-9099:80", composePort{Published: "9090-9099", Target: "80"}, false},
+		{"127.0.0.1:8001:8001", composePort{HostIP: "127.0.0.1", Published: "8001", Target: "8001"}, false},
+		{"127.0.0.1::5000", composePort{HostIP: "127.0.0.1", Target: "5000"}, false},
+		{"6060:6060/udp", composePort{Published: "6060", Target: "6060", Protocol: "udp"}, false},
+		{"[::1]:6001:6001", composePort{HostIP: "[::1]", Published: "6001", Target: "6001"}, false},
+		{"8000-8001:80-82", composePort{}, true},
+		{"80-70", composePort{}, true},
+		{"http", composePort{}, true},
+		{"1:2:3:4", composePort{}, true},
+		{[]interface{}{80}, composePort{}, true},
+	}
+	for _, tc := range testCases {
+		port, err := parsePort(tc.port)
+		if tc.err {
+			assert.Error(t, err, "port %v", tc.port)
+			continue
+		}
+		assert.NoError(t, err, "port %v", tc.port)
+		assert.Equal(t, tc.expected, *port, "port %v", tc.port)
+		assert.Equal(t, tc.port != 8080, port.Value() == tc.port, "port %v should be kept in short syntax", tc.port)
+	}
+
+	long := map[interface{}]interface{}{TARGET: 80, PUBLISHED: "8080", PROTOCOL: "udp", "mode": "host"}
+	port, err := parsePort(long)
+	assert.NoError(t, err)
+	assert.Equal(t, "8080", port.Published)
+	assert.Equal(t, "80/udp", port.PrivatePort(80))
+	port.SetPublished(1000, 1000)
+	assert.Equal(t, map[interface{}]interface{}{TARGET: 80, PUBLISHED: uint64(1000), PROTOCOL: "udp", "mode": "host"},
+		port.Value(), "other keys of long syntax should be kept")
+}
+
+func Test_editPorts(t *testing.T) {
+	var ports list.List
+	for _, p := range []uint64{1000, 1001, 2000, 2001, 2002, 2003, 2004} {
+		ports.PushBack(p)
+	}
+
+	edited, next, allocated, err := editPorts("web", []interface{}{
+		"81:3306",
+		"127.0.0.1:8000-8002:8000-8002/udp",
+		map[interface{}]interface{}{TARGET: "9000-9001", PUBLISHED: "9000-9001"},
+		"9999",
+	}, ports.Front())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"1000:3306",
+		"127.0.0.1:2000-2002:8000-8002/udp",
+		map[interface{}]interface{}{TARGET: "9000-9001", PUBLISHED: "2003-2004"},
+		"9999",
+	}, edited, "port 1001 is skipped since ports of range must be contiguous")
+	assert.Nil(t, next)
+	assert.Equal(t, []servicePort{
+		{Service: "web", Target: 3306, Protocol: "tcp", Published: 1000},
+		{Service: "web", Target: 8000, Protocol: "udp", Published: 2000},
+		{Service: "web", Target: 8001, Protocol: "udp", Published: 2001},
+		{Service: "web", Target: 8002, Protocol: "udp", Published: 2002},
+		{Service: "web", Target: 9000, Protocol: "tcp", Published: 2003},
+		{Service: "web", Target: 9001, Protocol: "tcp", Published: 2004},
+		{Service: "web", Target: 9999, Protocol: "tcp"},
+	}, allocated, "host port of dynamic port should be unknown")
+
+	_, _, _, err = editPorts("web", []interface{}{"8000-8001:8000-8001"}, nil)
+	assert.EqualError(t, err, "failed to allocate host port for 8000-8001:8000-8001: not enough ports in mesos "+
+		"resources: 2 contiguous ports are required, 0 ports are left")
+
+	_, _, _, err = editPorts("web", []interface{}{"8000-8005:8000-8005"}, ports.Front())
+	assert.Error(t, err, "offer without 6 contiguous ports should fail")
+}
@@ -0,0 +1,316 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/pkg/errors"
+)
+
+const (
+	CPU_PERIOD = 100000
+	MIN_SHARES = 2
+	MB         = 1024 * 1024
+	// tolerance of float rounding when shares of services are added up
+	RESOURCE_EPSILON = 1e-6
+)
+
+// resourceLabels are labels of explicit share of task resources for a service, cpus and mem are applied as
+// container limits while disk is only checked against task resources
+var resourceLabels = []struct {
+	resource string
+	label    string
+}{
+	{types.CPUS, types.CPUS_LABEL},
+	{types.MEM, types.MEM_LABEL},
+	{types.DISK, types.DISK_LABEL},
+}
+
+// applyResourceLimits distributes cpus and mem of task across services in pod and writes them as container limits
+func applyResourceLimits(filesMap types.ServiceDetail, taskInfo *mesos.TaskInfo) error {
+	if !config.EnableContainerLimits() {
+		return nil
+	}
+
+	total := make(map[string]float64)
+	for _, r := range resourceLabels {
+		total[r.resource] = pod.GetScalarResource(taskInfo, r.resource)
+	}
+	shares, err := distributeResources(filesMap, total)
+	if err != nil {
+		return err
+	}
+
+	version := getVersion(filesMap)
+	for file, composeMap := range filesMap {
+		servMap, ok := composeMap[types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range servMap {
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok || name == types.INFRA_CONTAINER {
+				continue
+			}
+			share := shares[fmt.Sprint(name)]
+			setResourceLimits(containerDetails, share, version)
+			logger.Printf("Edit Compose File : Set resource limits of service %v in %s as cpus %.3f, mem %.2fMB",
+				name, file, share[types.CPUS], share[types.MEM])
+		}
+	}
+	return nil
+}
+
+// distributeResources returns share of task resources to apply as container limits for each service. Services
+// with explicit share in labels get it, and limits declared in compose files are kept as the share of the service.
+// The rest of task resources are divided equally among the other services. It fails if the explicit shares and
+// declared limits of services exceed task resources.
+func distributeResources(filesMap types.ServiceDetail, total map[string]float64) (map[string]map[string]float64, error) {
+	explicit := make(map[string]map[string]float64)
+	declared := make(map[string]map[string]float64)
+	for file, composeMap := range filesMap {
+		servMap, ok := composeMap[types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range servMap {
+			service := fmt.Sprint(name)
+			if service == types.INFRA_CONTAINER {
+				continue
+			}
+			if _, ok := explicit[service]; !ok {
+				explicit[service] = make(map[string]float64)
+				declared[service] = make(map[string]float64)
+			}
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			labels := pod.ServiceLabels(containerDetails)
+			for _, r := range resourceLabels {
+				value, ok := labels[r.label]
+				if !ok {
+					continue
+				}
+				share, err := strconv.ParseFloat(value, 64)
+				if err != nil || share <= 0 {
+					return nil, errors.Errorf("invalid label %s=%s of service %s in %s", r.label, value, service, file)
+				}
+				explicit[service][r.resource] = share
+			}
+			limits, err := declaredLimits(containerDetails)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid limits of service %s in %s", service, file)
+			}
+			for resource, limit := range limits {
+				declared[service][resource] = limit
+			}
+		}
+	}
+
+	services := make([]string, 0, len(explicit))
+	for service := range explicit {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	shares := make(map[string]map[string]float64)
+	for _, service := range services {
+		shares[service] = make(map[string]float64)
+	}
+	for _, r := range resourceLabels {
+		var committed float64
+		var withLimits bool
+		var rest []string
+		for _, service := range services {
+			if share, ok := explicit[service][r.resource]; ok {
+				committed += share
+				shares[service][r.resource] = share
+			} else if limit, ok := declared[service][r.resource]; ok {
+				// declared limit is kept as it is
+				committed += limit
+				withLimits = true
+			} else {
+				rest = append(rest, service)
+			}
+		}
+		if committed > total[r.resource]+RESOURCE_EPSILON {
+			source := "labels " + r.label
+			if withLimits {
+				source += " and limits of services"
+			}
+			return nil, errors.Errorf("services over-commit task resources: %g %s is required by %s, "+
+				"but task only has %g", committed, r.resource, source, total[r.resource])
+		}
+		// resources not in task aren't limited, disk is never applied as container limit
+		if total[r.resource] == 0 || len(rest) == 0 || r.resource == types.DISK {
+			continue
+		}
+		left := total[r.resource] - committed
+		if left < RESOURCE_EPSILON {
+			return nil, errors.Errorf("services over-commit task resources: no %s is left for services %v",
+				r.resource, rest)
+		}
+		for _, service := range rest {
+			shares[service][r.resource] = left / float64(len(rest))
+		}
+	}
+	return shares, nil
+}
+
+// declaredLimits returns cpus and mem(MB) limits declared in compose file for a service, which are cpus, cpu_quota
+// and mem_limit of compose v2, or deploy.resources.limits. cpu_shares is a relative weight rather than a limit.
+func declaredLimits(containerDetails map[interface{}]interface{}) (map[string]float64, error) {
+	limits := make(map[string]float64)
+	if value, ok := containerDetails[types.CPUS]; ok {
+		cpus, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid %s %v", types.CPUS, value)
+		}
+		limits[types.CPUS] = cpus
+	}
+	if value, ok := containerDetails[types.CPU_QUOTA]; ok {
+		quota, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid %s %v", types.CPU_QUOTA, value)
+		}
+		period := float64(CPU_PERIOD)
+		if value, ok := containerDetails[types.CPU_PERIOD]; ok {
+			if period, err = strconv.ParseFloat(fmt.Sprint(value), 64); err != nil || period <= 0 {
+				return nil, errors.Errorf("invalid %s %v", types.CPU_PERIOD, value)
+			}
+		}
+		if quota > 0 {
+			limits[types.CPUS] = quota / period
+		}
+	}
+	if value, ok := containerDetails[types.MEM_LIMIT]; ok {
+		mem, err := parseMemory(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", types.MEM_LIMIT)
+		}
+		limits[types.MEM] = mem
+	}
+
+	deploy, _ := containerDetails[types.DEPLOY].(map[interface{}]interface{})
+	resources, _ := deploy[types.RESOURCES].(map[interface{}]interface{})
+	deployLimits, _ := resources[types.LIMITS].(map[interface{}]interface{})
+	if value, ok := deployLimits[types.CPUS]; ok {
+		cpus, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid %s.%s.%s.%s %v", types.DEPLOY, types.RESOURCES, types.LIMITS,
+				types.CPUS, value)
+		}
+		limits[types.CPUS] = cpus
+	}
+	if value, ok := deployLimits[types.MEMORY]; ok {
+		mem, err := parseMemory(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s.%s.%s.%s", types.DEPLOY, types.RESOURCES, types.LIMITS,
+				types.MEMORY)
+		}
+		limits[types.MEM] = mem
+	}
+	return limits, nil
+}
+
+// parseMemory parses memory in bytes or with unit b, k, m or g, such as 512m or 1gb, and returns it in MB
+func parseMemory(value interface{}) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+	units := []struct {
+		suffix string
+		bytes  float64
+	}{
+		{"kb", 1024}, {"mb", MB}, {"gb", 1024 * MB},
+		{"k", 1024}, {"m", MB}, {"g", 1024 * MB}, {"b", 1},
+	}
+	unit := float64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			unit = u.bytes
+			break
+		}
+	}
+	bytes, err := strconv.ParseFloat(s, 64)
+	if err != nil || bytes <= 0 {
+		return 0, errors.Errorf("invalid memory %v", value)
+	}
+	return bytes * unit / MB, nil
+}
+
+// setResourceLimits writes share of task resources as container limits, limits declared in compose file aren't
+// overwritten. Compose v3 doesn't support limits of compose v2, so they are written into deploy section which is
+// applied by docker-compose in compatibility mode.
+func setResourceLimits(containerDetails map[interface{}]interface{}, share map[string]float64, version string) {
+	cpus, hasCpus := share[types.CPUS]
+	mem, hasMem := share[types.MEM]
+	if !hasCpus && !hasMem {
+		return
+	}
+
+	if strings.HasPrefix(version, "3") {
+		deploy, ok := containerDetails[types.DEPLOY].(map[interface{}]interface{})
+		if !ok {
+			deploy = make(map[interface{}]interface{})
+			containerDetails[types.DEPLOY] = deploy
+		}
+		resources, ok := deploy[types.RESOURCES].(map[interface{}]interface{})
+		if !ok {
+			resources = make(map[interface{}]interface{})
+			deploy[types.RESOURCES] = resources
+		}
+		limits, ok := resources[types.LIMITS].(map[interface{}]interface{})
+		if !ok {
+			limits = make(map[interface{}]interface{})
+			resources[types.LIMITS] = limits
+		}
+		if _, ok := limits[types.CPUS]; hasCpus && !ok {
+			limits[types.CPUS] = strconv.FormatFloat(cpus, 'f', 3, 64)
+		}
+		if _, ok := limits[types.MEMORY]; hasMem && !ok {
+			limits[types.MEMORY] = fmt.Sprintf("%db", int64(mem*MB))
+		}
+		config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, true)
+		return
+	}
+
+	setDefault := func(key string, value interface{}) {
+		if _, ok := containerDetails[key]; !ok {
+			containerDetails[key] = value
+		}
+	}
+	if hasCpus {
+		shares := int64(cpus * 1024)
+		if shares < MIN_SHARES {
+			shares = MIN_SHARES
+		}
+		setDefault(types.CPU_SHARES, shares)
+		setDefault(types.CPU_QUOTA, int64(cpus*CPU_PERIOD))
+	}
+	if hasMem {
+		// memory of service can't be swapped, the same as mesos containers
+		setDefault(types.MEM_LIMIT, int64(mem*MB))
+		setDefault(types.MEMSWAP_LIMIT, int64(mem*MB))
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package general
+
+import (
+	"testing"
+
+	"github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func scalarResource(name string, value float64) *mesosproto.Resource {
+	return &mesosproto.Resource{
+		Name:   &name,
+		Type:   mesosproto.Value_SCALAR.Enum(),
+		Scalar: &mesosproto.Value_Scalar{Value: &value},
+	}
+}
+
+func Test_applyResourceLimits(t *testing.T) {
+	config.GetConfig().Set(config.CONTAINER_LIMITS, true)
+	defer config.GetConfig().Set(config.CONTAINER_LIMITS, false)
+	taskInfo := &mesosproto.TaskInfo{Resources: []*mesosproto.Resource{
+		scalarResource(types.CPUS, 1.5), scalarResource(types.MEM, 1024), scalarResource(types.DISK, 2048),
+	}}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+version: "2.1"
+services:
+  networkproxy:
+    image: dcego/networkproxy
+  db:
+    image: postgres
+    labels:
+      dce.resources.cpus: 1
+      dce.resources.mem: 512
+      dce.resources.disk: 1024
+  web:
+    image: web
+  worker:
+    image: worker
+    labels:
+      - dce.resources.mem=256
+`), &compose))
+	filesMap := types.ServiceDetail{"docker-compose.yml": compose}
+	assert.NoError(t, applyResourceLimits(filesMap, taskInfo))
+
+	services := compose[types.SERVICES].(map[interface{}]interface{})
+	limits := func(service string) map[interface{}]interface{} {
+		limits := make(map[interface{}]interface{})
+		for _, key := range []string{types.CPU_SHARES, types.CPU_QUOTA, types.MEM_LIMIT, types.MEMSWAP_LIMIT} {
+			if value, ok := services[service].(map[interface{}]interface{})[key]; ok {
+				limits[key] = value
+			}
+		}
+		return limits
+	}
+	assert.Equal(t, map[interface{}]interface{}{types.CPU_SHARES: int64(1024), types.CPU_QUOTA: int64(100000),
+		types.MEM_LIMIT: int64(512 * MB), types.MEMSWAP_LIMIT: int64(512 * MB)}, limits("db"))
+	assert.Equal(t, map[interface{}]interface{}{types.CPU_SHARES: int64(256), types.CPU_QUOTA: int64(25000),
+		types.MEM_LIMIT: int64(256 * MB), types.MEMSWAP_LIMIT: int64(256 * MB)}, limits("web"),
+		"resources left should be divided equally")
+	assert.Equal(t, limits("web"), limits("worker"))
+	assert.Empty(t, limits(types.INFRA_CONTAINER), "infra container shouldn't be limited")
+
+	config.GetConfig().Set(config.CONTAINER_LIMITS, false)
+	delete(services["web"].(map[interface{}]interface{}), types.MEM_LIMIT)
+	assert.NoError(t, applyResourceLimits(filesMap, taskInfo))
+	assert.NotContains(t, limits("web"), types.MEM_LIMIT)
+}
+
+func Test_applyResourceLimitsV3(t *testing.T) {
+	config.GetConfig().Set(config.CONTAINER_LIMITS, true)
+	defer config.GetConfig().Set(config.CONTAINER_LIMITS, false)
+	defer config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, false)
+	taskInfo := &mesosproto.TaskInfo{Resources: []*mesosproto.Resource{
+		scalarResource(types.CPUS, 0.5), scalarResource(types.MEM, 128),
+	}}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+version: "3.8"
+services:
+  web:
+    image: web
+    deploy:
+      resources:
+        reservations:
+          memory: 64M
+`), &compose))
+	assert.NoError(t, applyResourceLimits(types.ServiceDetail{"docker-compose.yml": compose}, taskInfo))
+
+	web := compose[types.SERVICES].(map[interface{}]interface{})["web"].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{
+		"reservations": map[interface{}]interface{}{"memory": "64M"},
+		types.LIMITS:   map[interface{}]interface{}{types.CPUS: "0.500", types.MEMORY: "134217728b"},
+	}, web[types.DEPLOY].(map[interface{}]interface{})[types.RESOURCES])
+	assert.NotContains(t, web, types.MEM_LIMIT, "compose v3 doesn't support mem_limit")
+	assert.True(t, config.GetConfig().GetBool(types.COMPOSE_COMPATIBILITY))
+}
+
+func Test_applyResourceLimitsDeclared(t *testing.T) {
+	config.GetConfig().Set(config.CONTAINER_LIMITS, true)
+	defer config.GetConfig().Set(config.CONTAINER_LIMITS, false)
+	defer config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, false)
+	taskInfo := &mesosproto.TaskInfo{Resources: []*mesosproto.Resource{
+		scalarResource(types.CPUS, 1.5), scalarResource(types.MEM, 1024),
+	}}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+version: "2.2"
+services:
+  db:
+    image: postgres
+    cpus: 1
+    mem_limit: 768m
+  web:
+    image: web
+    cpu_shares: 512
+`), &compose))
+	assert.NoError(t, applyResourceLimits(types.ServiceDetail{"docker-compose.yml": compose}, taskInfo))
+
+	services := compose[types.SERVICES].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{"image": "postgres", types.CPUS: 1, types.MEM_LIMIT: "768m"},
+		services["db"], "declared limits shouldn't be overwritten")
+	assert.Equal(t, map[interface{}]interface{}{"image": "web", types.CPU_SHARES: 512, types.CPU_QUOTA: int64(50000),
+		types.MEM_LIMIT: int64(256 * MB), types.MEMSWAP_LIMIT: int64(256 * MB)}, services["web"],
+		"resources left by declared limits should be given to the other services")
+
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+version: "3.8"
+services:
+  web:
+    image: web
+    deploy:
+      resources:
+        limits:
+          memory: 1g
+`), &compose))
+	assert.NoError(t, applyResourceLimits(types.ServiceDetail{"docker-compose.yml": compose}, taskInfo))
+	web := compose[types.SERVICES].(map[interface{}]interface{})["web"].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{types.CPUS: "1.500", types.MEMORY: "1g"},
+		web[types.DEPLOY].(map[interface{}]interface{})[types.RESOURCES].(map[interface{}]interface{})[types.LIMITS])
+
+	web[types.DEPLOY].(map[interface{}]interface{})[types.RESOURCES].(map[interface{}]interface{})[types.LIMITS] =
+		map[interface{}]interface{}{types.MEMORY: "2g"}
+	_, err := distributeResources(types.ServiceDetail{"docker-compose.yml": compose},
+		map[string]float64{types.MEM: 1024})
+	assert.EqualError(t, err, "services over-commit task resources: 2048 mem is required by labels "+
+		"dce.resources.mem and limits of services, but task only has 1024")
+}
+
+func Test_distributeResources(t *testing.T) {
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  db:
+    labels:
+      dce.resources.mem: 768
+  web:
+    labels:
+      dce.resources.mem: 512
+  worker:
+    image: worker
+`), &compose))
+	filesMap := types.ServiceDetail{"docker-compose.yml": compose}
+
+	_, err := distributeResources(filesMap, map[string]float64{types.MEM: 1024})
+	assert.EqualError(t, err, "services over-commit task resources: 1280 mem is required by labels "+
+		"dce.resources.mem, but task only has 1024")
+
+	_, err = distributeResources(filesMap, map[string]float64{types.MEM: 1280})
+	assert.EqualError(t, err, "services over-commit task resources: no mem is left for services [worker]")
+
+	shares, err := distributeResources(filesMap, map[string]float64{types.MEM: 2048})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{types.MEM: 768}, shares["worker"])
+
+	_, err = distributeResources(types.ServiceDetail{"docker-compose.yml": compose,
+		"override.yml": {types.SERVICES: map[interface{}]interface{}{"worker": map[interface{}]interface{}{
+			types.LABELS: []interface{}{"dce.resources.disk=10"}}}}}, map[string]float64{types.MEM: 2048})
+	assert.Error(t, err, "disk is over-committed if task doesn't have disk resources")
+}
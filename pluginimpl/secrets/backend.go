@@ -0,0 +1,161 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paypal/dce-go/config"
+	utilhttp "github.com/paypal/dce-go/utils/http"
+	"github.com/pkg/errors"
+)
+
+const (
+	FILE_BACKEND     = "file"
+	VAULT_BACKEND    = "vault"
+	VAULT_TOKEN_ENV  = "VAULT_TOKEN"
+	VAULT_TOKEN      = "X-Vault-Token"
+	VAULT_API_PREFIX = "/v1/"
+)
+
+// Backend resolves secrets from a secret store
+type Backend interface {
+	// Get returns value of a key of secret in path
+	Get(ctx context.Context, path, key string) (string, error)
+}
+
+// BackendFactory creates a backend from config
+type BackendFactory func() (Backend, error)
+
+var backends = map[string]BackendFactory{
+	FILE_BACKEND:  newFileBackend,
+	VAULT_BACKEND: newVaultBackend,
+}
+
+// RegisterBackend registers a secret store, which could be selected by config secrets.backend
+func RegisterBackend(name string, factory BackendFactory) {
+	backends[name] = factory
+}
+
+// GetBackend creates the secret store in config secrets.backend
+func GetBackend() (Backend, error) {
+	name := config.GetConfig().GetString(config.SECRETS_BACKEND)
+	factory, ok := backends[name]
+	if !ok {
+		return nil, errors.Errorf("unknown secrets backend %s", name)
+	}
+	return factory()
+}
+
+// fileBackend reads secrets from a directory, where key of secret in path is the file <dir>/<path>/<key>
+type fileBackend struct {
+	dir string
+}
+
+func newFileBackend() (Backend, error) {
+	dir := config.GetConfig().GetString(config.SECRETS_DIR)
+	if dir == "" {
+		return nil, errors.Errorf("%s is required by %s secrets backend", config.SECRETS_DIR, FILE_BACKEND)
+	}
+	return &fileBackend{dir: dir}, nil
+}
+
+func (b *fileBackend) Get(ctx context.Context, path, key string) (string, error) {
+	file := filepath.Join(b.dir, path, key)
+	if rel, err := filepath.Rel(b.dir, file); err != nil || strings.HasPrefix(rel, "..") {
+		return "", errors.Errorf("secret %s/%s is out of secrets dir", path, key)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.Errorf("secret %s/%s isn't found", path, key)
+		}
+		return "", errors.Wrapf(err, "failed to read secret %s/%s", path, key)
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// vaultBackend reads secrets from a Vault compatible http endpoint, such as a local vault agent.
+// Both kv version 1 and version 2 responses are supported.
+type vaultBackend struct {
+	address   string
+	transport http.RoundTripper
+}
+
+func newVaultBackend() (Backend, error) {
+	address := config.GetConfig().GetString(config.SECRETS_VAULT_ADDRESS)
+	if address == "" {
+		return nil, errors.Errorf("%s is required by %s secrets backend", config.SECRETS_VAULT_ADDRESS, VAULT_BACKEND)
+	}
+	var transport http.RoundTripper = utilhttp.DefaultPooledTransport()
+	// A local vault agent authenticates requests by itself, token is only required by vault server
+	if token := os.Getenv(VAULT_TOKEN_ENV); token != "" {
+		transport = &tokenTransport{token: token, base: transport}
+	}
+	return &vaultBackend{address: strings.TrimSuffix(address, "/"), transport: transport}, nil
+}
+
+func (b *vaultBackend) Get(ctx context.Context, path, key string) (string, error) {
+	url := b.address + VAULT_API_PREFIX + strings.TrimPrefix(path, "/")
+	status, body, err := utilhttp.DoRequest(ctx, b.transport, http.MethodGet, url, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read secret %s", path)
+	}
+	if status == http.StatusNotFound {
+		return "", errors.Errorf("secret %s isn't found", path)
+	}
+	if status != http.StatusOK {
+		return "", errors.Errorf("failed to read secret %s: status code %d", path, status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = json.Unmarshal(body, &secret); err != nil {
+		return "", errors.Wrapf(err, "failed to decode secret %s", path)
+	}
+	data := secret.Data
+	// kv version 2 wraps secret data along with its metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = inner
+	}
+	value, ok := data[key]
+	if !ok || value == nil {
+		return "", errors.Errorf("key %s of secret %s isn't found", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// tokenTransport adds vault token to requests
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(VAULT_TOKEN, t.token)
+	return t.base.RoundTrip(req)
+}
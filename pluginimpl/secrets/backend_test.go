@@ -0,0 +1,88 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "db"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "db", "password"), []byte("s3cr3t\n"), 0600))
+
+	config.GetConfig().Set(config.SECRETS_BACKEND, FILE_BACKEND)
+	config.GetConfig().Set(config.SECRETS_DIR, dir)
+	defer config.GetConfig().Set(config.SECRETS_DIR, "")
+
+	backend, err := GetBackend()
+	assert.NoError(t, err)
+	value, err := backend.Get(context.Background(), "db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = backend.Get(context.Background(), "db", "user")
+	assert.EqualError(t, err, "secret db/user isn't found")
+	_, err = backend.Get(context.Background(), "../etc", "passwd")
+	assert.Error(t, err, "secret out of secrets dir shouldn't be read")
+}
+
+func TestVaultBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get(VAULT_TOKEN))
+		switch r.URL.Path {
+		case "/v1/secret/db":
+			w.Write([]byte(`{"data": {"password": "s3cr3t"}}`))
+		case "/v1/kv/data/db":
+			w.Write([]byte(`{"data": {"data": {"password": "v2"}, "metadata": {"version": 1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	os.Setenv(VAULT_TOKEN_ENV, "token")
+	defer os.Unsetenv(VAULT_TOKEN_ENV)
+	config.GetConfig().Set(config.SECRETS_BACKEND, VAULT_BACKEND)
+	config.GetConfig().Set(config.SECRETS_VAULT_ADDRESS, server.URL+"/")
+	defer func() {
+		config.GetConfig().Set(config.SECRETS_BACKEND, FILE_BACKEND)
+		config.GetConfig().Set(config.SECRETS_VAULT_ADDRESS, "")
+	}()
+
+	backend, err := GetBackend()
+	assert.NoError(t, err)
+	value, err := backend.Get(context.Background(), "secret/db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	value, err = backend.Get(context.Background(), "kv/data/db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", value, "data of kv version 2 should be unwrapped")
+
+	_, err = backend.Get(context.Background(), "secret/db", "user")
+	assert.EqualError(t, err, "key user of secret secret/db isn't found")
+	_, err = backend.Get(context.Background(), "secret/app", "password")
+	assert.EqualError(t, err, "secret secret/app isn't found")
+}
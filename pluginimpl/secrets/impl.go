@@ -0,0 +1,125 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mesos/mesos-go/api/v0/executor"
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	utils "github.com/paypal/dce-go/utils/file"
+	"github.com/paypal/dce-go/utils/pod"
+	log "github.com/sirupsen/logrus"
+)
+
+const SECRETS_DIR_PREFIX = "dce-secrets-"
+
+var logger *log.Entry
+
+type secretsExt struct {
+}
+
+// secretsDir keeps resolved secrets of the task
+var secretsDir string
+
+func init() {
+	log.SetOutput(config.CreateFileAppendMode(types.DCE_OUT))
+
+	logger = log.WithFields(log.Fields{
+		"plugin": "secrets",
+	})
+	logger.Println("Plugin Registering")
+
+	plugin.ComposePlugins.Register(new(secretsExt), "secrets")
+
+	// Merge plugin config file if it's shipped with executor
+	if file := utils.SearchFile(".", "secrets.yaml"); file != "" {
+		config.ConfigInit(file)
+	}
+}
+
+func (p *secretsExt) Name() string {
+	return "secrets"
+}
+
+// LaunchTaskPreImagePull resolves placeholders of secrets in compose files
+func (p *secretsExt) LaunchTaskPreImagePull(ctx context.Context, composeFiles *[]string, executorId string, taskInfo *mesos.TaskInfo) error {
+	logger.Println("LaunchTaskPreImagePull begin")
+
+	secretsDir = filepath.Join(config.GetConfig().GetString(config.SECRETS_TMPFS_DIR),
+		SECRETS_DIR_PREFIX+taskInfo.GetTaskId().GetValue())
+	r := newResolver(ctx, secretsDir)
+
+	filesMap := pod.GetServiceDetail()
+	for _, file := range *composeFiles {
+		composeMap, ok := filesMap[file]
+		if !ok {
+			continue
+		}
+		if err := r.resolveFile(file, composeMap); err != nil {
+			logger.Errorf("Error resolving secrets : %v", err)
+			return err
+		}
+	}
+	pod.SetServiceDetail(filesMap)
+
+	if err := r.resolveRegistryAuth(taskInfo); err != nil {
+		logger.Errorf("Error resolving registry credentials : %v", err)
+		return err
+	}
+	return nil
+}
+
+func (p *secretsExt) LaunchTaskPostImagePull(ctx context.Context, composeFiles *[]string, executorId string, taskInfo *mesos.TaskInfo) error {
+	logger.Println("LaunchTaskPostImagePull begin")
+	return nil
+}
+
+func (p *secretsExt) PostLaunchTask(ctx context.Context, composeFiles []string, taskInfo *mesos.TaskInfo) (string, error) {
+	logger.Println("PostLaunchTask begin")
+	return "", nil
+}
+
+func (p *secretsExt) PreKillTask(ctx context.Context, taskInfo *mesos.TaskInfo) error {
+	logger.Println("PreKillTask begin")
+	return nil
+}
+
+// PostKillTask removes resolved secrets once pod is stopped
+func (p *secretsExt) PostKillTask(ctx context.Context, taskInfo *mesos.TaskInfo) error {
+	logger.Println("PostKillTask begin")
+	removeSecrets()
+	return nil
+}
+
+func (p *secretsExt) Shutdown(taskInfo *mesos.TaskInfo, ed executor.ExecutorDriver) error {
+	logger.Println("Shutdown begin")
+	removeSecrets()
+	return nil
+}
+
+func removeSecrets() {
+	if secretsDir == "" {
+		return
+	}
+	if err := os.RemoveAll(secretsDir); err != nil {
+		logger.Errorf("Error removing secrets dir %s : %v", secretsDir, err)
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+)
+
+const (
+	ENV_FILE         = "env_file"
+	CONTENT          = "content"
+	ENV_DELIMITER    = "="
+	SECRET_DELIMITER = "/"
+)
+
+// placeholder references key of a secret in path, such as ${secret:db/credentials/password}
+var placeholder = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// resolver resolves placeholders in compose files and writes resolved secrets into files in dir,
+// which is supposed to be on tmpfs so that secrets never hit the disk
+type resolver struct {
+	ctx context.Context
+	dir string
+	// backend is only created once a placeholder is found
+	backend Backend
+	cache   map[string]string
+}
+
+func newResolver(ctx context.Context, dir string) *resolver {
+	return &resolver{ctx: ctx, dir: dir, cache: make(map[string]string)}
+}
+
+// resolve replaces all the placeholders in s, it returns false if there isn't any
+func (r *resolver) resolve(s string) (string, bool, error) {
+	matches := placeholder.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return s, false, nil
+	}
+	for _, m := range matches {
+		value, err := r.get(m[1])
+		if err != nil {
+			return "", true, err
+		}
+		s = strings.Replace(s, m[0], value, 1)
+	}
+	return s, true, nil
+}
+
+func (r *resolver) get(ref string) (string, error) {
+	if value, ok := r.cache[ref]; ok {
+		return value, nil
+	}
+	i := strings.LastIndex(ref, SECRET_DELIMITER)
+	if i <= 0 || i == len(ref)-1 {
+		return "", errors.Errorf("invalid secret reference %s, it should be path/key", ref)
+	}
+	if r.backend == nil {
+		backend, err := GetBackend()
+		if err != nil {
+			return "", err
+		}
+		r.backend = backend
+	}
+	value, err := r.backend.Get(r.ctx, ref[:i], ref[i+1:])
+	if err != nil {
+		return "", err
+	}
+	r.cache[ref] = value
+	redact.AddValue(value)
+	return value, nil
+}
+
+// resolveFile resolves placeholders in environment of services and in content of top-level configs and secrets.
+// Environment with secrets is moved into an env file, and content is moved into a file mounted by compose.
+func (r *resolver) resolveFile(file string, composeMap map[string]interface{}) error {
+	if servMap, ok := composeMap[types.SERVICES].(map[interface{}]interface{}); ok {
+		for name, detail := range servMap {
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			if err := r.resolveEnvironment(file, fmt.Sprint(name), containerDetails); err != nil {
+				return errors.Wrapf(err, "failed to resolve secrets of service %v in %s", name, file)
+			}
+		}
+	}
+
+	for _, section := range []string{types.CONFIGS, types.SECRETS} {
+		sources, ok := composeMap[section].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, source := range sources {
+			sourceMap, ok := source.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			content, ok := sourceMap[CONTENT].(string)
+			if !ok {
+				continue
+			}
+			resolved, found, err := r.resolve(content)
+			if err != nil {
+				return errors.Wrapf(err, "failed to resolve secrets of %s %v in %s", section, name, file)
+			}
+			if !found {
+				continue
+			}
+			path, err := r.write(fmt.Sprintf("%s-%s-%v", filepath.Base(file), section, name), resolved, 0444)
+			if err != nil {
+				return err
+			}
+			delete(sourceMap, CONTENT)
+			sourceMap[types.FILE] = path
+			logger.Printf("Resolved secrets of %s %v in %s into %s", section, name, file, path)
+		}
+	}
+	return nil
+}
+
+func (r *resolver) resolveEnvironment(file, service string, containerDetails map[interface{}]interface{}) error {
+	secretEnv := make(map[string]string)
+	switch env := containerDetails[types.ENVIRONMENT].(type) {
+	case map[interface{}]interface{}:
+		for k, v := range env {
+			value, ok := v.(string)
+			if !ok {
+				continue
+			}
+			resolved, found, err := r.resolve(value)
+			if err != nil {
+				return err
+			}
+			if found {
+				secretEnv[fmt.Sprint(k)] = resolved
+				delete(env, k)
+			}
+		}
+	case []interface{}:
+		var kept []interface{}
+		for _, e := range env {
+			kv := strings.SplitN(fmt.Sprint(e), ENV_DELIMITER, 2)
+			if len(kv) == 2 {
+				resolved, found, err := r.resolve(kv[1])
+				if err != nil {
+					return err
+				}
+				if found {
+					secretEnv[kv[0]] = resolved
+					continue
+				}
+			}
+			kept = append(kept, e)
+		}
+		containerDetails[types.ENVIRONMENT] = kept
+	}
+	if len(secretEnv) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(secretEnv))
+	for key := range secretEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var content strings.Builder
+	for _, key := range keys {
+		if strings.ContainsAny(secretEnv[key], "\r\n") {
+			return errors.Errorf("secret of env %s has multiple lines, which isn't supported by env file", key)
+		}
+		content.WriteString(key + ENV_DELIMITER + secretEnv[key] + "\n")
+	}
+	path, err := r.write(fmt.Sprintf("%s-%s.env", filepath.Base(file), service), content.String(), 0400)
+	if err != nil {
+		return err
+	}
+
+	// env file is loaded before environment, so secrets don't override the other env vars
+	switch envFile := containerDetails[ENV_FILE].(type) {
+	case string:
+		containerDetails[ENV_FILE] = []interface{}{envFile, path}
+	case []interface{}:
+		containerDetails[ENV_FILE] = append(envFile, path)
+	default:
+		containerDetails[ENV_FILE] = []interface{}{path}
+	}
+	logger.Printf("Resolved secrets of env %v of service %s in %s into %s", keys, service, file, path)
+	return nil
+}
+
+// write writes resolved secrets into a file in dir
+func (r *resolver) write(name, content string, mode os.FileMode) (string, error) {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return "", errors.Wrap(err, "failed to create secrets dir")
+	}
+	path := filepath.Join(r.dir, name)
+	// file of previous attempt is read only
+	os.Remove(path)
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		return "", errors.Wrapf(err, "failed to write secrets file %s", path)
+	}
+	return path, nil
+}
+
+// resolveRegistryAuth adds the docker config in secret referenced by label dce.registry.auth.secret into registry
+// credentials of pod, the reference is either path/key or ${secret:path/key}
+func (r *resolver) resolveRegistryAuth(taskInfo *mesos.TaskInfo) error {
+	ref := pod.GetLabel(types.REGISTRY_SECRET_LABEL, taskInfo)
+	if ref == "" {
+		return nil
+	}
+	if m := placeholder.FindStringSubmatch(ref); m != nil {
+		ref = m[1]
+	}
+	value, err := r.get(ref)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve label %s", types.REGISTRY_SECRET_LABEL)
+	}
+	return errors.Wrapf(pod.AddDockerConfig([]byte(value)), "invalid docker config in secret %s", ref)
+}
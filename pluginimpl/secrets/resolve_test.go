@@ -0,0 +1,135 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// fakeBackend serves secrets from a map keyed by path/key
+type fakeBackend map[string]string
+
+func (b fakeBackend) Get(ctx context.Context, path, key string) (string, error) {
+	value, ok := b[path+"/"+key]
+	if !ok {
+		return "", errors.Errorf("secret %s/%s isn't found", path, key)
+	}
+	return value, nil
+}
+
+func Test_resolveFile(t *testing.T) {
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  db:
+    image: postgres
+    environment:
+      POSTGRES_USER: app
+      POSTGRES_PASSWORD: ${secret:db/password}
+  web:
+    image: web
+    env_file: web.env
+    environment:
+      - DEBUG=true
+      - DB_URL=postgres://app:${secret:db/password}@localhost/app
+configs:
+  app:
+    content: |
+      token: ${secret:app/token}
+  plain:
+    content: debug
+`), &compose))
+
+	dir := t.TempDir()
+	r := newResolver(context.Background(), dir)
+	r.backend = fakeBackend{"db/password": "pa55", "app/token": "t0ken"}
+	assert.NoError(t, r.resolveFile("poddata/docker-compose.yml-generated.yml", compose))
+
+	services := compose[types.SERVICES].(map[interface{}]interface{})
+	db := services["db"].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{"POSTGRES_USER": "app"}, db[types.ENVIRONMENT])
+	envFile := filepath.Join(dir, "docker-compose.yml-generated.yml-db.env")
+	assert.Equal(t, []interface{}{envFile}, db[ENV_FILE])
+	content, err := ioutil.ReadFile(envFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "POSTGRES_PASSWORD=pa55\n", string(content))
+
+	web := services["web"].(map[interface{}]interface{})
+	assert.Equal(t, []interface{}{"DEBUG=true"}, web[types.ENVIRONMENT])
+	assert.Equal(t, []interface{}{"web.env", filepath.Join(dir, "docker-compose.yml-generated.yml-web.env")},
+		web[ENV_FILE], "env file of service should be kept")
+
+	configs := compose[types.CONFIGS].(map[interface{}]interface{})
+	configFile := filepath.Join(dir, "docker-compose.yml-generated.yml-configs-app")
+	assert.Equal(t, map[interface{}]interface{}{types.FILE: configFile}, configs["app"])
+	content, err = ioutil.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "token: t0ken\n", string(content))
+	assert.Equal(t, map[interface{}]interface{}{CONTENT: "debug"}, configs["plain"])
+
+	assert.Equal(t, "db: "+redact.MASK, redact.Text("db: pa55"),
+		"resolved secrets should be redacted wherever they are found")
+}
+
+func Test_resolve(t *testing.T) {
+	r := newResolver(context.Background(), t.TempDir())
+	r.backend = fakeBackend{"db/password": "pa55"}
+
+	value, found, err := r.resolve("plain")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, "plain", value)
+
+	_, _, err = r.resolve("${secret:password}")
+	assert.EqualError(t, err, "invalid secret reference password, it should be path/key")
+	_, _, err = r.resolve("${secret:db/user}")
+	assert.EqualError(t, err, "secret db/user isn't found")
+}
+
+func Test_resolveRegistryAuth(t *testing.T) {
+	r := newResolver(context.Background(), t.TempDir())
+	r.backend = fakeBackend{"team/registry/config.json": `{"auths":{"quay.io":{"auth":"cXVheTpwYXNz"}}}`,
+		"team/registry/invalid": "quay:pass"}
+	assert.NoError(t, r.resolveRegistryAuth(&mesos.TaskInfo{}), "registry credential is optional")
+
+	key, value := types.REGISTRY_SECRET_LABEL, "${secret:team/registry/config.json}"
+	taskInfo := &mesos.TaskInfo{Labels: &mesos.Labels{Labels: []*mesos.Label{{Key: &key, Value: &value}}}}
+	assert.NoError(t, r.resolveRegistryAuth(taskInfo))
+
+	config.GetConfig().Set(config.REGISTRY_AUTH_DIR, t.TempDir())
+	defer config.GetConfig().Set(config.REGISTRY_AUTH_DIR, "/dev/shm")
+	assert.NoError(t, pod.WriteDockerConfig(&mesos.TaskInfo{}))
+	defer pod.RemoveDockerConfig()
+	content, err := ioutil.ReadFile(filepath.Join(pod.GetDockerConfig(), pod.DOCKER_CONFIG_FILE))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "cXVheTpwYXNz")
+	assert.Equal(t, redact.MASK, redact.Text(`{"auths":{"quay.io":{"auth":"cXVheTpwYXNz"}}}`),
+		"docker config in secret should be redacted")
+
+	value = "team/registry/invalid"
+	assert.Error(t, r.resolveRegistryAuth(taskInfo), "secret should be a docker config")
+}
@@ -33,6 +33,7 @@ const (
 	POD_PULL_FAILED
 	POD_COMPOSE_CHECK_FAILED
 	POD_EMPTY
+	POD_ADMISSION_DENIED
 )
 
 func (status PodStatus) String() string {
@@ -55,6 +56,8 @@ func (status PodStatus) String() string {
 		return "POD_COMPOSE_CHECK_FAILED"
 	case POD_EMPTY:
 		return ""
+	case POD_ADMISSION_DENIED:
+		return "POD_ADMISSION_DENIED"
 	}
 
 	return ""
@@ -112,6 +115,34 @@ const (
 	HOSTNAME                = "hostname"
 	VOLUMES                 = "volumes"
 	DEPENDS_ON              = "depends_on"
+	DEPLOY                  = "deploy"
+	RESOURCES               = "resources"
+	RESTART_POLICY          = "restart_policy"
+	LIMITS                  = "limits"
+	CPUS                    = "cpus"
+	MEM                     = "mem"
+	DISK                    = "disk"
+	MEMORY                  = "memory"
+	CPU_SHARES              = "cpu_shares"
+	CPU_QUOTA               = "cpu_quota"
+	CPU_PERIOD              = "cpu_period"
+	MEM_LIMIT               = "mem_limit"
+	MEMSWAP_LIMIT           = "memswap_limit"
+	PRIVILEGED              = "privileged"
+	PID                     = "pid"
+	IPC                     = "ipc"
+	UTS                     = "uts"
+	USERNS_MODE             = "userns_mode"
+	CGROUP                  = "cgroup"
+	SECURITY_OPT            = "security_opt"
+	VOLUMES_FROM            = "volumes_from"
+	DRIVER_OPTS             = "driver_opts"
+	CONTAINER_MODE_PREFIX   = "container:"
+	CAP_ADD                 = "cap_add"
+	DEVICES                 = "devices"
+	CONFIGS                 = "configs"
+	SECRETS                 = "secrets"
+	FILE                    = "file"
 	EXTRA_HOSTS             = "extra_hosts"
 	CGROUP_PARENT           = "cgroup_parent"
 	HOST_MODE               = "host"
@@ -127,6 +158,7 @@ const (
 	DEFAULT_FOLDER          = "poddata"
 	NO_FOLDER               = "dontcreatefolder"
 	RM_INFRA_CONTAINER      = "rm_infra_container"
+	COMPOSE_COMPATIBILITY   = "compose_compatibility"
 	COMPOSE_HTTP_TIMEOUT    = "COMPOSE_HTTP_TIMEOUT"
 	SERVICE_DETAIL          = "serviceDetail"
 	INFRA_CONTAINER         = "networkproxy"
@@ -134,6 +166,40 @@ const (
 	FOREVER                 = 1<<63 - 1
 	DCE_OUT                 = "dce.out"
 	DCE_ERR                 = "dce.err"
+	TASK_ID_LABEL           = "taskId"
+	EXECUTOR_ID_LABEL       = "executorId"
+	STOP_SIGNAL_LABEL       = "dce.stop.signal"
+	STOP_TIMEOUT_LABEL      = "dce.stop.timeout"
+	CPUS_LABEL              = "dce.resources.cpus"
+	MEM_LABEL               = "dce.resources.mem"
+	DISK_LABEL              = "dce.resources.disk"
+	PULL_POLICY_LABEL       = "dce.pull.policy"
+	REGISTRY_FILE_LABEL     = "dce.registry.auth.file"
+	REGISTRY_SECRET_LABEL   = "dce.registry.auth.secret"
+	CONTAINER_START         = "start"
+	CONTAINER_DIE           = "die"
+	CONTAINER_HEALTH_STATUS = "health_status"
+	RESTART_NO              = "no"
+	RESTART_ON_FAILURE      = "on-failure"
+	RESTART_ALWAYS          = "always"
+	RESTART_UNLESS_STOPPED  = "unless-stopped"
+)
+
+// Reasons of task failure reported to mesos
+const (
+	FAILURE_PLUGIN               = "PLUGIN_FAILED"
+	FAILURE_COMPOSE_WRITE        = "COMPOSE_WRITE_FAILED"
+	FAILURE_COMPOSE_CHECK        = "COMPOSE_CHECK_FAILED"
+	FAILURE_IMAGE_PULL           = "IMAGE_PULL_FAILED"
+	FAILURE_LAUNCH               = "LAUNCH_FAILED"
+	FAILURE_HEALTH_CHECK         = "HEALTH_CHECK_FAILED"
+	FAILURE_HEALTH_CHECK_TIMEOUT = "HEALTH_CHECK_TIMEOUT"
+	FAILURE_CONTAINER_EXITED     = "CONTAINER_EXITED"
+	FAILURE_CONTAINER_UNHEALTHY  = "CONTAINER_UNHEALTHY"
+	FAILURE_POD_EXITED           = "POD_EXITED"
+	FAILURE_MONITOR              = "MONITOR_FAILED"
+	FAILURE_IMAGE_DENIED         = "IMAGE_DENIED"
+	FAILURE_COMPOSE_DENIED       = "COMPOSE_DENIED"
 )
 
 // ServiceDetail key is filepath, value is map to store Unmarshal the docker-compose.yaml
@@ -185,8 +251,39 @@ type StepData struct {
 	ExecTimeMS int64             `json:"execTimeMS,omitempty"`
 }
 
+// RestartPolicy of a service in pod, which is honoured by executor instead of docker
+type RestartPolicy struct {
+	Condition string
+	// MaxRetries is the maximum restart count of on-failure policy, 0 means unlimited
+	MaxRetries int
+}
+
+// TaskFailure describes why a task failed, it's sent to mesos as message and data of task status
+type TaskFailure struct {
+	Reason       string `json:"reason"`
+	Message      string `json:"message"`
+	Step         string `json:"step,omitempty"`
+	Service      string `json:"service,omitempty"`
+	ContainerId  string `json:"containerId,omitempty"`
+	ExitCode     int    `json:"exitCode,omitempty"`
+	HealthOutput string `json:"healthOutput,omitempty"`
+}
+
 type SvcContainer struct {
 	ServiceName string
 	ContainerId string
 	Pid         string
 }
+
+// ContainerEvent is a state change of a container reported by container runtime
+type ContainerEvent struct {
+	ContainerId string
+	// Action is the type of event, such as die or health_status
+	Action string
+	// HealthStatus is set for health_status events
+	HealthStatus string
+	// ExitCode is set for die events
+	ExitCode   int
+	Attributes map[string]string
+	Time       int64
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/paypal/dce-go/config"
 	"github.com/paypal/dce-go/types"
 	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
 )
 
 const (
@@ -239,7 +240,8 @@ func WriteChangeToFiles() error {
 func DumpPluginModifiedComposeFiles(plugin, funcName string, pluginOrder int) {
 	filesMap := pod.GetServiceDetail()
 	for file := range filesMap {
-		content, _ := yaml.Marshal(filesMap[file])
+		// environment and labels of services are kept in compose traces, sensitive values are redacted
+		content, _ := yaml.Marshal(redact.Value(filesMap[file]))
 		fParts := strings.Split(file, PATH_DELIMITER)
 		if len(fParts) < 2 {
 			log.Printf("Skip dumping modified compose file by plugin %s, since file name is invalid %s", plugin, file)
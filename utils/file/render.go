@@ -0,0 +1,125 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/paypal/dce-go/utils/redact"
+)
+
+const (
+	RENDER_DIFF = "render.diff"
+	EMPTY_FILE  = "/dev/null"
+)
+
+// WriteRenderedFiles writes compose files generated by plugins into dir, along with a unified diff against
+// the original compose files in current folder. Both sides of the diff are normalized by yaml marshalling,
+// so that only changes made by plugins are shown, and sensitive values are redacted.
+// Paths of the written files are returned.
+func WriteRenderedFiles(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "failed to create render folder")
+	}
+
+	filesMap := pod.GetServiceDetail()
+	var generated []string
+	for file := range filesMap {
+		generated = append(generated, file)
+	}
+	sort.Strings(generated)
+
+	var written []string
+	var diff strings.Builder
+	for _, file := range generated {
+		content, err := yaml.Marshal(redact.Value(filesMap[file]))
+		if err != nil {
+			return written, errors.Wrapf(err, "failed to marshal %s", file)
+		}
+
+		name := strings.TrimPrefix(file, config.GetAppFolder()+PATH_DELIMITER)
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return written, err
+		}
+		if err = ioutil.WriteFile(path, content, 0644); err != nil {
+			return written, errors.Wrapf(err, "failed to write %s", path)
+		}
+		written = append(written, path)
+
+		original := strings.TrimSuffix(name, FILE_POSTFIX)
+		before, err := normalizeFile(original)
+		if err != nil {
+			return written, err
+		}
+		fromFile, lines := original, splitLines(before)
+		if before == nil {
+			fromFile, lines = EMPTY_FILE, nil
+		}
+		fileDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        lines,
+			B:        splitLines(content),
+			FromFile: fromFile,
+			ToFile:   name,
+			Context:  3,
+		})
+		if err != nil {
+			return written, errors.Wrapf(err, "failed to diff %s", file)
+		}
+		diff.WriteString(fileDiff)
+	}
+
+	path := filepath.Join(dir, RENDER_DIFF)
+	if err := ioutil.WriteFile(path, []byte(diff.String()), 0644); err != nil {
+		return written, errors.Wrap(err, "failed to write diff")
+	}
+	return append(written, path), nil
+}
+
+// normalizeFile marshals a compose file the same way as generated files with sensitive values redacted,
+// nil is returned if file doesn't exist, e.g. infra container file which is created by general plugin
+func normalizeFile(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", file)
+	}
+	var content map[string]interface{}
+	if err = yaml.Unmarshal(data, &content); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", file)
+	}
+	return yaml.Marshal(redact.Value(content))
+}
+
+// splitLines splits content into lines with line endings kept, which is expected by difflib
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/pod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRenderedFiles(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	sandbox := t.TempDir()
+	assert.NoError(t, os.Chdir(sandbox))
+
+	folder := config.GetAppFolder()
+	config.GetConfig().Set(config.FOLDER_NAME, "poddata_render")
+	defer config.GetConfig().Set(config.FOLDER_NAME, folder)
+	defer pod.SetServiceDetail(types.ServiceDetail{})
+
+	assert.NoError(t, ioutil.WriteFile("docker-compose.yml", []byte(`version: "2.1"
+services:
+  web:
+    image: web:1.0
+    environment:
+      DB_PASSWORD: pa55
+    ports:
+    - "8080:8080"
+`), 0644))
+	pod.SetServiceDetail(types.ServiceDetail{
+		"poddata_render/docker-compose.yml-generated.yml": {
+			"version": "2.1",
+			"services": map[interface{}]interface{}{
+				"web": map[interface{}]interface{}{
+					"image":        "web:1.0",
+					"environment":  map[interface{}]interface{}{"DB_PASSWORD": "pa55"},
+					"network_mode": "service:networkproxy",
+				},
+			},
+		},
+		"poddata_render/docker-infra-container.yml-generated.yml": {
+			"services": map[interface{}]interface{}{
+				"networkproxy": map[interface{}]interface{}{"ports": []interface{}{"31000:8080"}},
+			},
+		},
+	})
+
+	out := filepath.Join(sandbox, "rendered")
+	files, err := WriteRenderedFiles(out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(out, "docker-compose.yml-generated.yml"),
+		filepath.Join(out, "docker-infra-container.yml-generated.yml"),
+		filepath.Join(out, RENDER_DIFF),
+	}, files)
+
+	content, err := ioutil.ReadFile(filepath.Join(out, "docker-compose.yml-generated.yml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "network_mode: service:networkproxy")
+	assert.NotContains(t, string(content), "pa55", "sensitive values should be redacted")
+
+	diff, err := ioutil.ReadFile(filepath.Join(out, RENDER_DIFF))
+	assert.NoError(t, err)
+	assert.Equal(t, `--- docker-compose.yml
++++ docker-compose.yml-generated.yml
+@@ -3,6 +3,5 @@
+     environment:
+       DB_PASSWORD: '******'
+     image: web:1.0
+-    ports:
+-    - 8080:8080
++    network_mode: service:networkproxy
+ version: "2.1"
+--- /dev/null
++++ docker-infra-container.yml-generated.yml
+@@ -0,0 +1,4 @@
++services:
++  networkproxy:
++    ports:
++    - 31000:8080
+`, string(diff), "only changes made by plugins should be shown")
+}
@@ -102,3 +102,36 @@ func GetRequest(ctx context.Context, transport http.RoundTripper, url string) ([
 	}
 	return respBody, nil
 }
+
+// http request with any method
+// status code of response is returned along with response body
+func DoRequest(ctx context.Context, transport http.RoundTripper, method, url string, body io.Reader) (int, []byte, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   config.GetHttpTimeout(),
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		log.Println("Error creating http request : ", err.Error())
+		return 0, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Error sending http %s request : %s", method, err.Error())
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("Error reading http response : ", err.Error())
+		return resp.StatusCode, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"runtime"
@@ -38,6 +39,22 @@ func DefaultPooledTransport() *http.Transport {
 	return transport
 }
 
+// UnixSocketTransport returns a new http.Transport with the same default values
+// as DefaultPooledTransport, but dialing to the unix socket at path for every request
+// regardless of the host in request url. It's used to talk to local daemons such as dockerd.
+func UnixSocketTransport(path string) *http.Transport {
+	transport := DefaultPooledTransport()
+	transport.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	return transport
+}
+
 // DefaultClient returns a new http.Client with similar default values to
 // http.Client, but with a non-shared Transport, idle connections disabled, and
 // keepalives disabled.
@@ -0,0 +1,67 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics exports pod lifecycle and step timings as prometheus metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dce"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	// StepDuration is the duration of each dce step, such as image pull, plugin phases and health check of a service
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of dce steps by step name and outcome.",
+		Buckets:   []float64{1, 2, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"step", "status"})
+
+	// PodStatusTransitions counts pod status updates
+	PodStatusTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pod_status_transitions_total",
+		Help:      "Number of pod status transitions by target status.",
+	}, []string{"status"})
+
+	// ContainerRestarts counts services restarted by executor per restart policy
+	ContainerRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "container_restarts_total",
+		Help:      "Number of container restarts by service.",
+	}, []string{"service"})
+
+	// HealthCheckFailures counts services found unhealthy
+	HealthCheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_check_failures_total",
+		Help:      "Number of health check failures by service.",
+	}, []string{"service"})
+)
+
+func init() {
+	registry.MustRegister(StepDuration, PodStatusTransitions, ContainerRestarts, HealthCheckFailures)
+}
+
+// Handler serves metrics in prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,51 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	StepDuration.WithLabelValues("Image_Pull", "Success").Observe(3)
+	PodStatusTransitions.WithLabelValues("POD_RUNNING").Inc()
+	ContainerRestarts.WithLabelValues("redis").Inc()
+	HealthCheckFailures.WithLabelValues("redis").Inc()
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, expected := range []string{
+		`dce_step_duration_seconds_bucket{status="Success",step="Image_Pull",le="5"} 1`,
+		`dce_step_duration_seconds_count{status="Success",step="Image_Pull"} 1`,
+		`dce_pod_status_transitions_total{status="POD_RUNNING"} 1`,
+		`dce_container_restarts_total{service="redis"} 1`,
+		`dce_health_check_failures_total{service="redis"} 1`,
+	} {
+		assert.Contains(t, string(body), expected)
+	}
+}
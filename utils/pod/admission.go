@@ -0,0 +1,241 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	IMAGE_ADMISSION_STEP = "Image_Admission"
+	IMAGE_SIGNATURE_STEP = "Image_Signature"
+	DEFAULT_REGISTRY     = "docker.io"
+	LIBRARY_NAMESPACE    = "library"
+)
+
+// ImageViolation is an image of pod violating image policy
+type ImageViolation struct {
+	Image    string
+	Services []string
+	Reason   string
+}
+
+func (v ImageViolation) String() string {
+	if v.Image == "" {
+		return fmt.Sprintf("service %s %s", strings.Join(v.Services, ","), v.Reason)
+	}
+	return fmt.Sprintf("image %s of %s %s", v.Image, strings.Join(v.Services, ","), v.Reason)
+}
+
+// verifySignature verifies signature of an image with a public key, by cosign by default
+var verifySignature = func(ctx context.Context, image, key string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, config.GetImageVerifier(), "verify", "--key", key, image)
+	cmd.Env = dockerConfigEnv(os.Environ())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// AdmitImages checks images of services as they are written in compose files against image policy in config
+// before images are pulled: images must be from registries or repositories in admission.images.allowlist and pinned
+// to digests if admission.images.requiredigest is set. Services built by compose are denied while any image policy
+// is set, since their images don't come from registries. Signatures are verified by VerifyImages once images are
+// pulled. It returns a failure of the task with all the violations if any image is denied.
+func AdmitImages(files []string) *types.TaskFailure {
+	allowlist := config.GetImageAllowlist()
+	requireDigest := config.RequireImageDigest()
+	if len(allowlist) == 0 && !requireDigest && len(config.GetImagePublicKeys()) == 0 {
+		return nil
+	}
+	log.Println("====================Admit Images====================")
+
+	filesMap := GetServiceDetail()
+	pulls, err := getPodImages(filesMap, files)
+	if err != nil {
+		return &types.TaskFailure{Reason: types.FAILURE_IMAGE_DENIED, Message: err.Error(), Step: IMAGE_ADMISSION_STEP}
+	}
+
+	var violations []ImageViolation
+	for _, service := range getBuiltServices(filesMap, files) {
+		violations = append(violations, ImageViolation{Services: []string{service},
+			Reason: "is built by compose instead of pulling image from a registry"})
+	}
+	for _, p := range pulls {
+		if reason := checkImage(p.Image, allowlist, requireDigest); reason != "" {
+			violations = append(violations, ImageViolation{Image: p.Image, Services: p.Services, Reason: reason})
+		}
+	}
+	if len(violations) == 0 {
+		log.Println("All the images of pod are admitted")
+		return nil
+	}
+	return imageFailure(violations, IMAGE_ADMISSION_STEP)
+}
+
+// VerifyImages verifies signatures of images of services against admission.images.publickeys once images are pulled.
+// Tags could be pushed again after verification, so images must be pinned to digests, either in compose files or
+// by the digests resolved when they're pulled, and the digests that containers run are verified.
+// It returns a failure of the task with all the violations if any image isn't signed by a trusted key.
+func VerifyImages(files []string) *types.TaskFailure {
+	keys := config.GetImagePublicKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+	log.Println("====================Verify Images====================")
+
+	pulls, err := getPodImages(GetServiceDetail(), files)
+	if err != nil {
+		return &types.TaskFailure{Reason: types.FAILURE_IMAGE_DENIED, Message: err.Error(), Step: IMAGE_SIGNATURE_STEP}
+	}
+
+	var violations []ImageViolation
+	for _, p := range pulls {
+		if reason := verifyImage(p.Image, keys); reason != "" {
+			violations = append(violations, ImageViolation{Image: p.Image, Services: p.Services, Reason: reason})
+		}
+	}
+	if len(violations) == 0 {
+		log.Println("Signatures of all the images of pod are verified")
+		return nil
+	}
+	return imageFailure(violations, IMAGE_SIGNATURE_STEP)
+}
+
+// imageFailure returns a failure of the task with all the violations of image policy
+func imageFailure(violations []ImageViolation, step string) *types.TaskFailure {
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		log.Errorf("POD_ADMISSION_DENIED -- %s", v)
+		messages = append(messages, v.String())
+	}
+	failure := &types.TaskFailure{
+		Reason:  types.FAILURE_IMAGE_DENIED,
+		Message: strings.Join(messages, "; "),
+		Step:    step,
+	}
+	if len(violations) == 1 && len(violations[0].Services) == 1 {
+		failure.Service = violations[0].Services[0]
+	}
+	return failure
+}
+
+// getBuiltServices returns services built by compose in compose files
+func getBuiltServices(filesMap types.ServiceDetail, files []string) []string {
+	built := make(map[string]bool)
+	for _, file := range files {
+		servMap, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range servMap {
+			if containerDetails, ok := detail.(map[interface{}]interface{}); ok {
+				if _, ok := containerDetails[BUILD]; ok {
+					built[fmt.Sprint(name)] = true
+				}
+			}
+		}
+	}
+	services := make([]string, 0, len(built))
+	for service := range built {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// checkImage returns the reason why image as written in compose files is denied, it's empty if image is admitted
+func checkImage(image string, allowlist []string, requireDigest bool) string {
+	if len(allowlist) > 0 && !isImageAllowed(image, allowlist) {
+		return "isn't from an allowed registry or repository"
+	}
+	if requireDigest && !strings.Contains(image, DIGEST_DELIMITER) {
+		return "isn't pinned to a digest"
+	}
+	return ""
+}
+
+// verifyImage returns the reason why signature of image isn't verified, it's empty if image is signed by any key
+func verifyImage(image string, keys []string) string {
+	// tags could be pushed again after verification, so only signatures of digests are verified
+	if !strings.Contains(image, DIGEST_DELIMITER) {
+		return "isn't pinned to a digest to verify its signature"
+	}
+	var errs []string
+	for _, key := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), config.GetPullTimeout())
+		err := verifySignature(ctx, image, key)
+		cancel()
+		if err == nil {
+			log.Printf("Signature of image %s is verified by %s", image, key)
+			return ""
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+	}
+	log.Warnf("Failed to verify signature of image %s: %s", image, strings.Join(errs, "; "))
+	return "isn't signed by any trusted key"
+}
+
+// isImageAllowed checks whether repository of image is, or is under, a registry or repository in allowlist
+func isImageAllowed(image string, allowlist []string) bool {
+	repository := fullRepository(ImageRepository(image))
+	for _, allowed := range allowlist {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "" {
+			continue
+		}
+		if !strings.Contains(allowed, "/") && isRegistryHost(allowed) {
+			if strings.HasPrefix(repository, allowed+"/") {
+				return true
+			}
+			continue
+		}
+		allowed = fullRepository(allowed)
+		if repository == allowed || strings.HasPrefix(repository, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fullRepository returns repository with registry and namespace of docker hub, e.g. docker.io/library/redis of redis
+func fullRepository(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) == 1 || !isRegistryHost(parts[0]) {
+		repository = DEFAULT_REGISTRY + "/" + repository
+	}
+	if strings.HasPrefix(repository, DEFAULT_REGISTRY+"/") && strings.Count(repository, "/") == 1 {
+		repository = DEFAULT_REGISTRY + "/" + LIBRARY_NAMESPACE + strings.TrimPrefix(repository, DEFAULT_REGISTRY)
+	}
+	return repository
+}
+
+// isRegistryHost checks whether the first part of repository is a registry host as docker does
+func isRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestAdmitImages(t *testing.T) {
+	defer func() {
+		config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, nil)
+		config.GetConfig().Set(config.ADMISSION_REQUIRE_DIGEST, false)
+		config.GetConfig().Set(config.ADMISSION_PUBLIC_KEYS, nil)
+	}()
+	verify := verifySignature
+	defer func() { verifySignature = verify }()
+	var verified []string
+	verifySignature = func(ctx context.Context, image, key string) error {
+		verified = append(verified, image+" "+key)
+		if key == "team.pub" && image != "registry.example.com/team/app@sha256:unsigned" {
+			return nil
+		}
+		return errors.New("no matching signatures")
+	}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web:
+    image: registry.example.com/team/app@sha256:app
+  worker:
+    image: registry.example.com/team/app@sha256:app
+  cache:
+    image: redis:6
+  proxy:
+    image: registry.example.com/team/app@sha256:unsigned
+`), &compose))
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": compose})
+	defer SetServiceDetail(make(types.ServiceDetail))
+	files := []string{"docker-compose.yml"}
+
+	assert.Nil(t, AdmitImages(files), "images should be admitted without image policy")
+
+	config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, []string{"registry.example.com/team", "redis"})
+	assert.Nil(t, AdmitImages(files))
+
+	config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, []string{"registry.example.com"})
+	failure := AdmitImages(files)
+	assert.Equal(t, &types.TaskFailure{
+		Reason:  types.FAILURE_IMAGE_DENIED,
+		Message: "image redis:6 of cache isn't from an allowed registry or repository",
+		Step:    IMAGE_ADMISSION_STEP,
+		Service: "cache",
+	}, failure)
+
+	config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, nil)
+	config.GetConfig().Set(config.ADMISSION_REQUIRE_DIGEST, true)
+	assert.Equal(t, "image redis:6 of cache isn't pinned to a digest", AdmitImages(files).Message)
+
+	config.GetConfig().Set(config.ADMISSION_REQUIRE_DIGEST, false)
+	config.GetConfig().Set(config.ADMISSION_PUBLIC_KEYS, []string{"ops.pub", "team.pub"})
+	assert.Nil(t, AdmitImages(files), "signatures should be verified once images are pulled")
+	failure = VerifyImages(files)
+	assert.Equal(t, "image redis:6 of cache isn't pinned to a digest to verify its signature; "+
+		"image registry.example.com/team/app@sha256:unsigned of proxy isn't signed by any trusted key", failure.Message)
+	assert.Equal(t, IMAGE_SIGNATURE_STEP, failure.Step)
+	assert.Empty(t, failure.Service, "service isn't set for violations of more than one service")
+	assert.Equal(t, []string{
+		"registry.example.com/team/app@sha256:app ops.pub",
+		"registry.example.com/team/app@sha256:app team.pub",
+		"registry.example.com/team/app@sha256:unsigned ops.pub",
+		"registry.example.com/team/app@sha256:unsigned team.pub",
+	}, verified, "image shared by services should be verified once")
+
+	// tags are pinned to the digests resolved when images are pulled
+	verified = nil
+	services := compose[types.SERVICES].(map[interface{}]interface{})
+	pinImages(files, []*ImagePull{{Image: "redis:6", Digest: "sha256:redis"}})
+	delete(services, "proxy")
+	assert.Nil(t, VerifyImages(files), "resolved digest of tag should be verified")
+	assert.Contains(t, verified, "redis@sha256:redis team.pub")
+}
+
+func TestAdmitImagesBuild(t *testing.T) {
+	defer config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, nil)
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web:
+    image: registry.example.com/team/app@sha256:app
+  builder:
+    build: .
+    image: registry.example.com/team/builder
+`), &compose))
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": compose})
+	defer SetServiceDetail(make(types.ServiceDetail))
+	files := []string{"docker-compose.yml"}
+
+	assert.Nil(t, AdmitImages(files), "services could be built without image policy")
+
+	config.GetConfig().Set(config.ADMISSION_IMAGE_ALLOWLIST, []string{"registry.example.com"})
+	assert.Equal(t, &types.TaskFailure{
+		Reason:  types.FAILURE_IMAGE_DENIED,
+		Message: "service builder is built by compose instead of pulling image from a registry",
+		Step:    IMAGE_ADMISSION_STEP,
+		Service: "builder",
+	}, AdmitImages(files), "services built by compose should be denied by image policy")
+}
+
+func Test_isImageAllowed(t *testing.T) {
+	testCases := []struct {
+		image     string
+		allowlist []string
+		allowed   bool
+	}{
+		{"redis:6", []string{"redis"}, true},
+		{"redis", []string{"docker.io/library/redis"}, true},
+		{"docker.io/library/redis:6", []string{"redis"}, true},
+		{"redisx:6", []string{"redis"}, false},
+		{"team/app:1.0", []string{"docker.io"}, true},
+		{"registry.example.com:5000/team/app:1.0", []string{"registry.example.com:5000/team/"}, true},
+		{"registry.example.com:5000/team/app:1.0", []string{"registry.example.com"}, false},
+		{"localhost/app", []string{"localhost"}, true},
+		{"evil.com/registry.example.com/app", []string{"registry.example.com"}, false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.allowed, isImageAllowed(tc.image, tc.allowlist), "image %s, allowlist %v", tc.image,
+			tc.allowlist)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	COMPOSE_V1 = 1
+	COMPOSE_V2 = 2
+
+	composePlugin = "compose"
+)
+
+// Compose is the compose cli used by cli runtimes,
+// either legacy standalone docker-compose or compose v2, which is usually a docker cli plugin
+type Compose struct {
+	Command []string
+	Version string
+	Major   int
+}
+
+// ComposeContainer is a container listed by compose v2 ps --format json
+type ComposeContainer struct {
+	ID       string
+	Name     string
+	Service  string
+	State    string
+	Health   string
+	ExitCode int
+	Status   string
+}
+
+var (
+	composeMu       sync.Mutex
+	detectedCompose *Compose
+
+	// composeVersion runs "<compose> version --short", it's a var so that tests could fake compose cli
+	composeVersion = func(command []string) (string, error) {
+		args := append(append([]string{}, command[1:]...), "version", "--short")
+		out, err := exec.Command(command[0], args...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+)
+
+func (c *Compose) String() string {
+	version := c.Version
+	if version == "" {
+		version = "unknown version"
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(c.Command, " "), version)
+}
+
+// IsV2 checks whether compose is v2, which lists running containers only by default
+// and doesn't support --verbose
+func (c *Compose) IsV2() bool {
+	return c.Major >= COMPOSE_V2
+}
+
+// isPlugin checks whether compose runs as docker cli plugin, e.g. docker compose
+func (c *Compose) isPlugin() bool {
+	return len(c.Command) > 1 && c.Command[len(c.Command)-1] == composePlugin
+}
+
+// Cmd creates compose command with cmd parts generated by GenerateCmdParts,
+// flags which aren't supported by compose v2 are replaced
+func (c *Compose) Cmd(parts []string) *exec.Cmd {
+	command := append([]string{}, c.Command...)
+	if c.IsV2() {
+		args := make([]string, 0, len(parts))
+		for _, part := range parts {
+			if part != "--verbose" {
+				args = append(args, part)
+				continue
+			}
+			// verbose output of compose v2 is enabled by debug flag of docker cli
+			if c.isPlugin() {
+				command = append(command[:1], append([]string{"--debug"}, command[1:]...)...)
+			}
+		}
+		parts = args
+	}
+	return exec.Command(command[0], append(command[1:], parts...)...)
+}
+
+// DetectCompose detects compose cli and its version, compose set in config is used if any,
+// otherwise docker compose v2 plugin is preferred over legacy docker-compose.
+// Compose v2 plugin is assumed if none of them reports a version.
+func DetectCompose() *Compose {
+	candidates := [][]string{{"docker", composePlugin}, {"docker-compose"}}
+	if command := strings.Fields(config.GetComposeBinary()); len(command) > 0 {
+		candidates = [][]string{command}
+	}
+
+	var compose *Compose
+	for _, command := range candidates {
+		version, err := composeVersion(command)
+		if err != nil {
+			log.Debugf("Compose : %s isn't available : %v", strings.Join(command, " "), err)
+			continue
+		}
+		compose = &Compose{
+			Command: command,
+			Version: strings.TrimPrefix(version, "v"),
+			Major:   parseComposeMajor(version),
+		}
+		break
+	}
+	if compose == nil {
+		compose = &Compose{Command: candidates[0], Major: COMPOSE_V1}
+		if compose.isPlugin() {
+			compose.Major = COMPOSE_V2
+		}
+		log.Warnf("Compose : unable to detect compose version, assuming %s is compose v%d", strings.Join(compose.Command, " "), compose.Major)
+	}
+
+	composeMu.Lock()
+	detectedCompose = compose
+	composeMu.Unlock()
+	return compose
+}
+
+// GetCompose returns compose detected at launch, compose is detected if it hasn't been
+func GetCompose() *Compose {
+	composeMu.Lock()
+	compose := detectedCompose
+	composeMu.Unlock()
+	if compose == nil {
+		return DetectCompose()
+	}
+	return compose
+}
+
+// parseComposeMajor parses major version from output of compose version --short, e.g. 1.29.2 or v2.20.2
+func parseComposeMajor(version string) int {
+	major := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 2)[0]
+	if n, err := strconv.Atoi(major); err == nil && n > 0 {
+		return n
+	}
+	return COMPOSE_V1
+}
+
+// ParseComposePs parses output of compose v2 ps --format json,
+// which is a json array before compose 2.21 and a json object per line since then
+func ParseComposePs(out []byte) ([]ComposeContainer, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var containers []ComposeContainer
+	if out[0] == '[' {
+		if err := json.Unmarshal(out, &containers); err != nil {
+			return nil, errors.Wrap(err, "failed to parse compose ps output")
+		}
+		return containers, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var container ComposeContainer
+		err := decoder.Decode(&container)
+		if err == io.EOF {
+			return containers, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse compose ps output")
+		}
+		containers = append(containers, container)
+	}
+}
+
+// formatComposePs formats containers as a table like compose v1 ps does
+func formatComposePs(containers []ComposeContainer) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSERVICE\tSTATE\tSTATUS")
+	for _, c := range containers {
+		status := c.Status
+		switch {
+		case status != "":
+		case c.Health != "":
+			status = c.Health
+		case c.State == "exited":
+			status = fmt.Sprintf("exit code %d", c.ExitCode)
+		default:
+			status = c.State
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, c.Service, c.State, status)
+	}
+	w.Flush()
+	return buf.String()
+}
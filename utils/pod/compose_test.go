@@ -0,0 +1,139 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCompose sets a script which records its args and prints output as compose v2 plugin detected at launch
+func fakeCompose(t *testing.T, output string) string {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + args + "\ncat <<'EOF'\n" + output + "\nEOF\n"
+	binary := filepath.Join(dir, "docker")
+	assert.NoError(t, ioutil.WriteFile(binary, []byte(script), 0755))
+
+	detectedCompose = &Compose{Command: []string{binary, "compose"}, Version: "2.20.2", Major: COMPOSE_V2}
+	t.Cleanup(func() { detectedCompose = nil })
+	return args
+}
+
+func TestDetectCompose(t *testing.T) {
+	defer func(f func([]string) (string, error)) { composeVersion = f }(composeVersion)
+	defer func() { detectedCompose = nil }()
+
+	versions := map[string]string{"docker-compose": "1.29.2"}
+	composeVersion = func(command []string) (string, error) {
+		if version, ok := versions[strings.Join(command, " ")]; ok {
+			return version, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	compose := DetectCompose()
+	assert.Equal(t, []string{"docker-compose"}, compose.Command)
+	assert.False(t, compose.IsV2())
+	assert.Equal(t, "docker-compose (1.29.2)", compose.String())
+
+	versions["docker compose"] = "v2.20.2"
+	compose = DetectCompose()
+	assert.Equal(t, []string{"docker", "compose"}, compose.Command, "compose v2 plugin should be preferred")
+	assert.Equal(t, "2.20.2", compose.Version)
+	assert.True(t, compose.IsV2())
+	assert.Equal(t, compose, GetCompose())
+
+	config.GetConfig().Set(config.COMPOSE_BINARY, "/usr/local/bin/docker-compose")
+	defer config.GetConfig().Set(config.COMPOSE_BINARY, "")
+	compose = DetectCompose()
+	assert.Equal(t, []string{"/usr/local/bin/docker-compose"}, compose.Command)
+	assert.False(t, compose.IsV2(), "configured compose should be assumed v1 if version isn't reported")
+
+	config.GetConfig().Set(config.COMPOSE_BINARY, "docker compose")
+	delete(versions, "docker compose")
+	assert.True(t, DetectCompose().IsV2(), "compose plugin should be assumed v2 if version isn't reported")
+}
+
+func TestParseComposeMajor(t *testing.T) {
+	assert.Equal(t, COMPOSE_V1, parseComposeMajor("1.29.2"))
+	assert.Equal(t, COMPOSE_V2, parseComposeMajor("v2.20.2"))
+	assert.Equal(t, COMPOSE_V2, parseComposeMajor("2.27.0-desktop.1\n"))
+	assert.Equal(t, COMPOSE_V1, parseComposeMajor("unknown"))
+}
+
+func TestComposeCmd(t *testing.T) {
+	parts := []string{"-f", "docker-compose.yml", "--verbose", "up", "-d"}
+
+	cmd := (&Compose{Command: []string{"docker-compose"}, Major: COMPOSE_V1}).Cmd(parts)
+	assert.Equal(t, []string{"docker-compose", "-f", "docker-compose.yml", "--verbose", "up", "-d"}, cmd.Args)
+
+	cmd = (&Compose{Command: []string{"docker", "compose"}, Major: COMPOSE_V2}).Cmd(parts)
+	assert.Equal(t, []string{"docker", "--debug", "compose", "-f", "docker-compose.yml", "up", "-d"}, cmd.Args)
+
+	cmd = (&Compose{Command: []string{"docker-compose"}, Major: COMPOSE_V2}).Cmd(parts)
+	assert.Equal(t, []string{"docker-compose", "-f", "docker-compose.yml", "up", "-d"}, cmd.Args)
+	assert.Equal(t, []string{"-f", "docker-compose.yml", "--verbose", "up", "-d"}, parts, "parts shouldn't be modified")
+}
+
+func TestParseComposePs(t *testing.T) {
+	containers, err := ParseComposePs([]byte(`[{"ID":"abc","Name":"pod_web_1","Service":"web","State":"running","Health":"healthy"},` +
+		`{"ID":"def","Name":"pod_job_1","Service":"job","State":"exited","ExitCode":1}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []ComposeContainer{
+		{ID: "abc", Name: "pod_web_1", Service: "web", State: "running", Health: "healthy"},
+		{ID: "def", Name: "pod_job_1", Service: "job", State: "exited", ExitCode: 1},
+	}, containers, "compose before 2.21 prints a json array")
+
+	lines, err := ParseComposePs([]byte(`{"ID":"abc","Name":"pod_web_1","Service":"web","State":"running","Health":"healthy"}
+{"ID":"def","Name":"pod_job_1","Service":"job","State":"exited","ExitCode":1}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, containers, lines, "compose since 2.21 prints a json object per line")
+
+	containers, err = ParseComposePs([]byte("\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, containers)
+
+	_, err = ParseComposePs([]byte("NAME SERVICE STATUS"))
+	assert.Error(t, err)
+}
+
+func TestCliRuntimeComposeV2(t *testing.T) {
+	args := fakeCompose(t, `{"ID":"abc","Name":"pod_web_1","Service":"web","State":"running","Status":"Up 2 minutes"}
+{"ID":"def","Name":"pod_job_1","Service":"job","State":"exited","ExitCode":1}`)
+	r := &cliRuntime{containerBinary: "docker"}
+
+	_, err := r.Ps(nil, "web")
+	assert.NoError(t, err)
+	status, err := r.Status(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"NAME        SERVICE   STATE     STATUS",
+		"pod_web_1   web       running   Up 2 minutes",
+		"pod_job_1   job       exited    exit code 1",
+	}, strings.Split(strings.TrimSpace(status), "\n"))
+
+	out, err := ioutil.ReadFile(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "compose ps -a -q web\ncompose ps -a --format json\n", string(out),
+		"stopped containers should be listed by compose v2")
+}
@@ -0,0 +1,147 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/redact"
+	log "github.com/sirupsen/logrus"
+)
+
+var taskFailure = struct {
+	sync.Mutex
+	failure *types.TaskFailure
+}{}
+
+// SetTaskFailure records why task fails. Only the first failure is kept, since it's usually the root cause
+func SetTaskFailure(failure types.TaskFailure) {
+	taskFailure.Lock()
+	defer taskFailure.Unlock()
+
+	if taskFailure.failure != nil {
+		log.Debugf("Task failure %+v is ignored, task already failed with %+v", redactFailure(failure),
+			redactFailure(*taskFailure.failure))
+		return
+	}
+	log.Printf("Task failure : %+v", redactFailure(failure))
+	taskFailure.failure = &failure
+}
+
+// redactFailure returns a copy of task failure with sensitive values redacted, message and health check output
+// could have credentials printed by containers
+func redactFailure(failure types.TaskFailure) types.TaskFailure {
+	failure.Message = redact.Text(failure.Message)
+	failure.HealthOutput = redact.Text(failure.HealthOutput)
+	return failure
+}
+
+// GetTaskFailure returns why task fails, nil if no failure is recorded
+func GetTaskFailure() *types.TaskFailure {
+	taskFailure.Lock()
+	defer taskFailure.Unlock()
+
+	if taskFailure.failure == nil {
+		return nil
+	}
+	failure := *taskFailure.failure
+	return &failure
+}
+
+// NewContainerFailure describes failure of a container, it's either exited with non-zero code or unhealthy
+func NewContainerFailure(step string, svcContainer types.SvcContainer, exitCode int) types.TaskFailure {
+	if exitCode != 0 {
+		return types.TaskFailure{
+			Reason:      types.FAILURE_CONTAINER_EXITED,
+			Message:     fmt.Sprintf("service %s exited with code %d", svcContainer.ServiceName, exitCode),
+			Step:        step,
+			Service:     svcContainer.ServiceName,
+			ContainerId: svcContainer.ContainerId,
+			ExitCode:    exitCode,
+		}
+	}
+	return types.TaskFailure{
+		Reason:       types.FAILURE_CONTAINER_UNHEALTHY,
+		Message:      fmt.Sprintf("service %s is unhealthy", svcContainer.ServiceName),
+		Step:         step,
+		Service:      svcContainer.ServiceName,
+		ContainerId:  svcContainer.ContainerId,
+		HealthOutput: GetHealthCheckOutput(svcContainer.ContainerId),
+	}
+}
+
+// GetHealthCheckOutput returns output of the last health check of a container
+func GetHealthCheckOutput(containerId string) string {
+	out, err := GetRuntime().InspectRaw(containerId)
+	if err != nil {
+		log.Warnf("Error inspecting container %s for health check output: %v", containerId, err)
+		return ""
+	}
+
+	type container struct {
+		State struct {
+			Health *struct {
+				Log []struct {
+					Output string
+				}
+			}
+		}
+	}
+	var c container
+	out = bytes.TrimSpace(out)
+	// docker inspect cli returns an array
+	if bytes.HasPrefix(out, []byte("[")) {
+		var containers []container
+		if err = json.Unmarshal(out, &containers); err == nil && len(containers) > 0 {
+			c = containers[0]
+		}
+	} else {
+		err = json.Unmarshal(out, &c)
+	}
+	if err != nil {
+		log.Warnf("Error parsing inspect details of container %s: %v", containerId, err)
+		return ""
+	}
+	if c.State.Health == nil || len(c.State.Health.Log) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(c.State.Health.Log[len(c.State.Health.Log)-1].Output)
+}
+
+// setFailureStatus attaches reason, message and data of task failure to task status
+func setFailureStatus(status *mesos.TaskStatus, failure *types.TaskFailure, launched bool) {
+	if failure == nil {
+		return
+	}
+	reason := mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED
+	if !launched {
+		reason = mesos.TaskStatus_REASON_CONTAINER_LAUNCH_FAILED
+	}
+	status.Reason = reason.Enum()
+	redacted := redactFailure(*failure)
+	status.Message = &redacted.Message
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		log.Warnf("Error marshalling task failure: %v", err)
+		return
+	}
+	status.Data = redact.JSON(data)
+}
@@ -0,0 +1,116 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/redact"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetTaskFailure() {
+	taskFailure.Lock()
+	taskFailure.failure = nil
+	taskFailure.Unlock()
+}
+
+func TestSetTaskFailure(t *testing.T) {
+	resetTaskFailure()
+	defer resetTaskFailure()
+
+	assert.Nil(t, GetTaskFailure())
+	SetTaskFailure(types.TaskFailure{Reason: types.FAILURE_IMAGE_PULL, Message: "pull failed"})
+	SetTaskFailure(types.TaskFailure{Reason: types.FAILURE_PLUGIN, Message: "plugin failed"})
+	assert.Equal(t, &types.TaskFailure{Reason: types.FAILURE_IMAGE_PULL, Message: "pull failed"}, GetTaskFailure(),
+		"first failure should be kept")
+}
+
+func TestSetTaskFailureRedacted(t *testing.T) {
+	resetTaskFailure()
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		resetTaskFailure()
+	}()
+
+	redact.AddValue("l0g-s3cr3t")
+	SetTaskFailure(types.TaskFailure{Reason: types.FAILURE_HEALTH_CHECK, Message: "login with l0g-s3cr3t failed",
+		HealthOutput: "l0g-s3cr3t is rejected"})
+	assert.Contains(t, out.String(), "login with "+redact.MASK+" failed")
+	assert.NotContains(t, out.String(), "l0g-s3cr3t", "sensitive values shouldn't be logged")
+	assert.Equal(t, "login with l0g-s3cr3t failed", GetTaskFailure().Message, "task failure shouldn't be modified")
+}
+
+func TestNewContainerFailure(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.raw["id1"] = `[{"State": {"Health": {"Status": "unhealthy", "Log": [{"Output": "ok"}, {"Output": "connection refused\n"}]}}}]`
+	f.raw["id2"] = `{"State": {"Health": {"Status": "unhealthy", "Log": [{"Output": "timeout"}]}}}`
+	redis := types.SvcContainer{ServiceName: "redis", ContainerId: "id1"}
+
+	assert.Equal(t, types.TaskFailure{
+		Reason:      types.FAILURE_CONTAINER_EXITED,
+		Message:     "service redis exited with code 137",
+		Step:        MONITOR_STEP,
+		Service:     "redis",
+		ContainerId: "id1",
+		ExitCode:    137,
+	}, NewContainerFailure(MONITOR_STEP, redis, 137))
+
+	assert.Equal(t, types.TaskFailure{
+		Reason:       types.FAILURE_CONTAINER_UNHEALTHY,
+		Message:      "service redis is unhealthy",
+		Step:         "HealthCheck-redis",
+		Service:      "redis",
+		ContainerId:  "id1",
+		HealthOutput: "connection refused",
+	}, NewContainerFailure("HealthCheck-redis", redis, 0))
+
+	assert.Equal(t, "timeout", GetHealthCheckOutput("id2"), "inspect output of docker api should be supported")
+	assert.Equal(t, "", GetHealthCheckOutput("id3"))
+}
+
+func TestSetFailureStatus(t *testing.T) {
+	failure := &types.TaskFailure{Reason: types.FAILURE_IMAGE_PULL, Message: "pull failed", Step: "Image_Pull"}
+
+	status := &mesos.TaskStatus{}
+	setFailureStatus(status, nil, false)
+	assert.Nil(t, status.Reason)
+	assert.Nil(t, status.Message)
+
+	setFailureStatus(status, failure, false)
+	assert.Equal(t, mesos.TaskStatus_REASON_CONTAINER_LAUNCH_FAILED, status.GetReason())
+	assert.Equal(t, "pull failed", status.GetMessage())
+	var data types.TaskFailure
+	assert.NoError(t, json.Unmarshal(status.GetData(), &data))
+	assert.Equal(t, *failure, data)
+
+	setFailureStatus(status, failure, true)
+	assert.Equal(t, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED, status.GetReason())
+
+	failure = &types.TaskFailure{Reason: types.FAILURE_HEALTH_CHECK, Message: "failed to connect postgres://app:pa55@db",
+		HealthOutput: "PASSWORD=pa55 is rejected"}
+	setFailureStatus(status, failure, true)
+	assert.Equal(t, "failed to connect postgres://app:"+redact.MASK+"@db", status.GetMessage())
+	assert.NotContains(t, string(status.GetData()), "pa55", "sensitive values shouldn't be sent to mesos")
+	assert.Equal(t, "failed to connect postgres://app:pa55@db", failure.Message, "task failure shouldn't be modified")
+}
@@ -0,0 +1,132 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const SERVICE_RESTARTING = "restarting"
+
+// PodHealth is the aggregated health of pod sent to mesos as data of task status
+type PodHealth struct {
+	Healthy  bool              `json:"healthy"`
+	Services map[string]string `json:"services"`
+}
+
+var podHealth = struct {
+	sync.Mutex
+	services map[string]string
+	// healthy is the pod health last reported to mesos, nil until pod is running
+	healthy *bool
+}{services: make(map[string]string)}
+
+// sendStatusUpdate sends task status to mesos without triggering pod status hooks
+var sendStatusUpdate = func(status *mesos.TaskStatus) error {
+	if ComposeExecutorDriver == nil {
+		return fmt.Errorf("executor driver isn't initialized")
+	}
+	_, err := ComposeExecutorDriver.SendStatusUpdate(status)
+	return err
+}
+
+// SetServiceHealth records health of a service found by pod monitor, such as healthy, unhealthy, starting
+// or restarting. Health of service is removed if it's empty.
+func SetServiceHealth(service, health string) {
+	podHealth.Lock()
+	defer podHealth.Unlock()
+
+	if health == "" {
+		delete(podHealth.services, service)
+		return
+	}
+	podHealth.services[service] = health
+}
+
+// initPodHealth sets pod as healthy once it's running, since all the services passed initial health check
+func initPodHealth() {
+	podHealth.Lock()
+	defer podHealth.Unlock()
+
+	healthy := true
+	podHealth.healthy = &healthy
+}
+
+// GetPodHealth aggregates health of services, pod is healthy only if every service is healthy
+func GetPodHealth() PodHealth {
+	podHealth.Lock()
+	defer podHealth.Unlock()
+
+	health := PodHealth{Healthy: true, Services: make(map[string]string, len(podHealth.services))}
+	for service, status := range podHealth.services {
+		health.Services[service] = status
+		if status != types.HEALTHY.String() {
+			health.Healthy = false
+		}
+	}
+	return health
+}
+
+// ReportPodHealth sends TASK_RUNNING with healthy field to mesos if aggregated pod health is changed
+func ReportPodHealth() {
+	logger := log.WithFields(log.Fields{
+		"func": "pod.ReportPodHealth",
+	})
+
+	health := GetPodHealth()
+	podHealth.Lock()
+	if podHealth.healthy == nil || *podHealth.healthy == health.Healthy || GetPodStatus() != types.POD_RUNNING {
+		podHealth.Unlock()
+		return
+	}
+	podHealth.healthy = &health.Healthy
+	podHealth.Unlock()
+
+	data, err := json.Marshal(health)
+	if err != nil {
+		logger.Warnf("Error marshalling pod health: %v", err)
+	}
+	message := "pod is healthy"
+	if !health.Healthy {
+		var degraded []string
+		for service, status := range health.Services {
+			if status != types.HEALTHY.String() {
+				degraded = append(degraded, fmt.Sprintf("%s is %s", service, status))
+			}
+		}
+		sort.Strings(degraded)
+		message = "pod is unhealthy: " + strings.Join(degraded, ", ")
+	}
+
+	logger.Printf("Pod health changed, %s", message)
+	err = sendStatusUpdate(&mesos.TaskStatus{
+		TaskId:  ComposeTaskInfo.GetTaskId(),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+		Healthy: &health.Healthy,
+		Message: &message,
+		Data:    data,
+	})
+	if err != nil {
+		logger.Errorf("Error updating mesos task health : %v", err)
+	}
+}
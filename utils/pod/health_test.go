@@ -0,0 +1,129 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/json"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// usePodHealth resets pod health and captures task status sent to mesos
+func usePodHealth(t *testing.T) *[]*mesos.TaskStatus {
+	resetPodHealth := func() {
+		podHealth.Lock()
+		podHealth.services = make(map[string]string)
+		podHealth.healthy = nil
+		podHealth.Unlock()
+	}
+	resetPodHealth()
+
+	var sent []*mesos.TaskStatus
+	send := sendStatusUpdate
+	sendStatusUpdate = func(status *mesos.TaskStatus) error {
+		sent = append(sent, status)
+		return nil
+	}
+	status := GetPodStatus()
+	t.Cleanup(func() {
+		sendStatusUpdate = send
+		SetPodStatus(status)
+		resetPodHealth()
+	})
+	return &sent
+}
+
+func TestReportPodHealth(t *testing.T) {
+	sent := usePodHealth(t)
+
+	SetPodStatus(types.POD_RUNNING)
+	SetServiceHealth("redis", types.UNHEALTHY.String())
+	ReportPodHealth()
+	assert.Empty(t, *sent, "health shouldn't be reported before pod is running")
+
+	initPodHealth()
+	ReportPodHealth()
+	SetServiceHealth("web", SERVICE_RESTARTING)
+	ReportPodHealth()
+	assert.Len(t, *sent, 1, "health should only be reported once it's changed")
+
+	status := (*sent)[0]
+	assert.Equal(t, mesos.TaskState_TASK_RUNNING, status.GetState())
+	assert.False(t, status.GetHealthy())
+	assert.Equal(t, "pod is unhealthy: redis is unhealthy", status.GetMessage())
+	var health PodHealth
+	assert.NoError(t, json.Unmarshal(status.GetData(), &health))
+	assert.Equal(t, PodHealth{Services: map[string]string{"redis": "unhealthy"}}, health)
+
+	SetServiceHealth("redis", types.HEALTHY.String())
+	SetServiceHealth("web", "")
+	ReportPodHealth()
+	assert.Len(t, *sent, 2)
+	assert.True(t, (*sent)[1].GetHealthy())
+	assert.Equal(t, "pod is healthy", (*sent)[1].GetMessage())
+
+	SetPodStatus(types.POD_STARTING)
+	SetServiceHealth("redis", types.UNHEALTHY.String())
+	ReportPodHealth()
+	assert.Len(t, *sent, 2, "health shouldn't be reported once pod isn't running")
+}
+
+func TestCheckPodStatusUnhealthy(t *testing.T) {
+	sent := usePodHealth(t)
+	f := useFakeRuntime(t)
+	f.containers["redis"] = types.ContainerStatusDetails{IsRunning: true, HealthStatus: "unhealthy"}
+	f.containers["web"] = types.ContainerStatusDetails{IsRunning: true}
+	resetTaskFailure()
+	defer func() {
+		resetTaskFailure()
+		MonitorContainerList = nil
+		HealthCheckListId = make(map[string]bool)
+		config.GetConfig().Set(config.CLEAN_POD_UNHEALTHY, true)
+	}()
+
+	SetPodStatus(types.POD_RUNNING)
+	initPodHealth()
+	config.GetConfig().Set(types.IS_SERVICE, true)
+	config.GetConfig().Set(config.CLEAN_POD_UNHEALTHY, false)
+	HealthCheckListId["redis"] = true
+	MonitorContainerList = []types.SvcContainer{{ServiceName: "redis", ContainerId: "redis"},
+		{ServiceName: "web", ContainerId: "web"}}
+
+	status, err := CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_EMPTY, status, "unhealthy container shouldn't fail pod if cleanpod.unhealthy is false")
+	assert.Nil(t, GetTaskFailure())
+	assert.Equal(t, PodHealth{Services: map[string]string{"redis": "unhealthy", "web": "healthy"}}, GetPodHealth())
+	assert.Len(t, *sent, 1)
+	assert.False(t, (*sent)[0].GetHealthy())
+
+	f.containers["redis"] = types.ContainerStatusDetails{IsRunning: true, HealthStatus: "healthy"}
+	status, err = CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_EMPTY, status)
+	assert.Len(t, *sent, 2)
+	assert.True(t, (*sent)[1].GetHealthy())
+
+	f.containers["redis"] = types.ContainerStatusDetails{IsRunning: true, HealthStatus: "unhealthy"}
+	config.GetConfig().Set(config.CLEAN_POD_UNHEALTHY, true)
+	status, err = CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FAILED, status)
+	assert.Equal(t, types.FAILURE_CONTAINER_UNHEALTHY, GetTaskFailure().Reason)
+}
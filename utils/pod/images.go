@@ -0,0 +1,305 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PULL_ALWAYS         = "always"
+	PULL_IF_NOT_PRESENT = "if-not-present"
+	PULL_NEVER          = "never"
+	IMAGE_PULL_STEP     = "Image_Pull"
+	DIGEST_DELIMITER    = "@"
+	BUILD               = "build"
+)
+
+// ImagePull is the result of pulling an image used by services of pod, it's recorded in launch report
+type ImagePull struct {
+	Image    string   `json:"image"`
+	Services []string `json:"services"`
+	Policy   string   `json:"policy"`
+	Pulled   bool     `json:"pulled"`
+	Digest   string   `json:"digest,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+var imagePulls struct {
+	sync.RWMutex
+	pulls []ImagePull
+}
+
+// pullBackoff returns the time to wait before retrying to pull an image
+var pullBackoff = func(retry int) time.Duration {
+	return time.Duration(retry+1) * config.GetPollInterval()
+}
+
+// GetImagePulls returns results of pulling images of pod
+func GetImagePulls() []ImagePull {
+	imagePulls.RLock()
+	defer imagePulls.RUnlock()
+	return imagePulls.pulls
+}
+
+// policyPriority orders pull policies, the highest policy wins if an image is used by services with different policies
+var policyPriority = map[string]int{PULL_NEVER: 0, PULL_IF_NOT_PRESENT: 1, PULL_ALWAYS: 2}
+
+// getServicePullPolicy returns pull policy in label dce.pull.policy of a service, or launchtask.pullpolicy in config
+func getServicePullPolicy(containerDetails map[interface{}]interface{}) (string, error) {
+	policy := config.GetPullPolicy()
+	if p, ok := ServiceLabels(containerDetails)[types.PULL_POLICY_LABEL]; ok {
+		policy = p
+	}
+	if _, ok := policyPriority[policy]; !ok {
+		return "", errors.Errorf("invalid pull policy %s, it should be one of %s, %s and %s", policy,
+			PULL_ALWAYS, PULL_IF_NOT_PRESENT, PULL_NEVER)
+	}
+	return policy, nil
+}
+
+// getPodImages returns images of services in compose files and their pull policies.
+// Image of a service could be overridden by later files, services built by compose are skipped.
+func getPodImages(filesMap types.ServiceDetail, files []string) ([]*ImagePull, error) {
+	images := make(map[string]string)
+	policies := make(map[string]string)
+	built := make(map[string]bool)
+	for _, file := range files {
+		servMap, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range servMap {
+			service := fmt.Sprint(name)
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := containerDetails[BUILD]; ok {
+				built[service] = true
+			}
+			if image, ok := containerDetails[types.IMAGE].(string); ok && image != "" {
+				images[service] = image
+			}
+			if _, ok := ServiceLabels(containerDetails)[types.PULL_POLICY_LABEL]; ok || policies[service] == "" {
+				policy, err := getServicePullPolicy(containerDetails)
+				if err != nil {
+					return nil, errors.Wrapf(err, "service %s in %s", service, file)
+				}
+				policies[service] = policy
+			}
+		}
+	}
+
+	pulls := make(map[string]*ImagePull)
+	for service, image := range images {
+		if built[service] {
+			continue
+		}
+		pull, ok := pulls[image]
+		if !ok {
+			pull = &ImagePull{Image: image, Policy: policies[service]}
+			pulls[image] = pull
+		}
+		pull.Services = append(pull.Services, service)
+		if policyPriority[policies[service]] > policyPriority[pull.Policy] {
+			pull.Policy = policies[service]
+		}
+	}
+
+	result := make([]*ImagePull, 0, len(pulls))
+	for _, pull := range pulls {
+		sort.Strings(pull.Services)
+		result = append(result, pull)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Image < result[j].Image })
+	return result, nil
+}
+
+// PullImages pulls images of services in parallel by their pull policies, each image is retried and timed out
+// individually. Images are pinned to their digests in compose files once all of them are pulled.
+func PullImages(puller plugin.ImagePuller, files []string) error {
+	log.Println("====================Pull Images====================")
+
+	pulls, err := getPodImages(GetServiceDetail(), files)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, config.GetPullParallelism())
+	for _, p := range pulls {
+		wg.Add(1)
+		go func(p *ImagePull) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := pullImage(puller, p); err != nil {
+				p.Error = err.Error()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	var failed []string
+	imagePulls.Lock()
+	imagePulls.pulls = nil
+	for _, p := range pulls {
+		imagePulls.pulls = append(imagePulls.pulls, *p)
+		if p.Error != "" {
+			failed = append(failed, p.Error)
+		}
+	}
+	imagePulls.Unlock()
+	if len(failed) > 0 {
+		return errors.Errorf("failed to pull %d images: %s", len(failed), strings.Join(failed, "; "))
+	}
+
+	// images are always pinned if their signatures are verified, so that containers run the digests verified
+	if config.PinImageDigest() || len(config.GetImagePublicKeys()) > 0 {
+		pinImages(files, pulls)
+	}
+	return nil
+}
+
+// pullImage pulls an image by its pull policy and resolves its digest
+func pullImage(puller plugin.ImagePuller, p *ImagePull) error {
+	logger := log.WithFields(log.Fields{
+		"image":  p.Image,
+		"policy": p.Policy,
+		"func":   "pod.pullImage",
+	})
+
+	digest, exists, err := puller.ImageDigest(p.Image)
+	if err != nil {
+		logger.Warnf("Failed to inspect image before pulling it: %v", err)
+	}
+	switch {
+	case p.Policy == PULL_NEVER && !exists:
+		return errors.Errorf("image %s isn't present and its pull policy is %s", p.Image, PULL_NEVER)
+	case p.Policy == PULL_ALWAYS || !exists:
+		stepName := fmt.Sprintf("%s_%s", IMAGE_PULL_STEP, p.Image)
+		retry := config.GetPullRetryCount()
+		if retry <= 0 {
+			retry = 1
+		}
+		for i := 0; i < retry; i++ {
+			if i != 0 {
+				time.Sleep(pullBackoff(i - 1))
+				logger.Printf("Retry pulling image: %d", i)
+			}
+			StartStep(StepMetrics, stepName)
+			ctx, cancel := context.WithTimeout(context.Background(), config.GetPullTimeout())
+			err = puller.PullImage(ctx, p.Image)
+			if ctx.Err() == context.DeadlineExceeded {
+				err = errors.Errorf("timed out after %v", config.GetPullTimeout())
+			}
+			cancel()
+			EndStep(StepMetrics, stepName, map[string]string{"image": p.Image, "policy": p.Policy}, err)
+			if err == nil {
+				break
+			}
+			logger.Warnf("Failed to pull image: %v", err)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to pull image %s", p.Image)
+		}
+		p.Pulled = true
+		if digest, _, err = puller.ImageDigest(p.Image); err != nil {
+			logger.Warnf("Failed to resolve digest of image: %v", err)
+		}
+	default:
+		logger.Println("Image is present, skip pulling it")
+	}
+	p.Digest = digest
+	logger.Printf("Image digest is %s", digest)
+	return nil
+}
+
+// pinImages replaces image tags of services with digests, so that containers run the images that were pulled
+// even if the tags are pushed again
+func pinImages(files []string, pulls []*ImagePull) {
+	digests := make(map[string]string)
+	for _, p := range pulls {
+		if p.Digest != "" && !strings.Contains(p.Image, DIGEST_DELIMITER) {
+			digests[p.Image] = ImageRepository(p.Image) + DIGEST_DELIMITER + p.Digest
+		}
+	}
+	if len(digests) == 0 {
+		return
+	}
+
+	filesMap := GetServiceDetail()
+	for _, file := range files {
+		servMap, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range servMap {
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			image, ok := containerDetails[types.IMAGE].(string)
+			if pinned, found := digests[image]; ok && found {
+				containerDetails[types.IMAGE] = pinned
+				log.Printf("Pin image of service %v in %s as %s", name, file, pinned)
+			}
+		}
+	}
+	SetServiceDetail(filesMap)
+}
+
+// ImageRepository returns repository of an image without tag and digest, e.g. registry:5000/app of
+// registry:5000/app:1.0
+func ImageRepository(image string) string {
+	if i := strings.Index(image, DIGEST_DELIMITER); i >= 0 {
+		image = image[:i]
+	}
+	// tag is after the last colon which isn't part of registry host
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// RepoDigest returns the digest of image from repo digests of local image, which are in form of repository@digest
+func RepoDigest(image string, repoDigests []string) string {
+	repository := normalizeRepository(ImageRepository(image))
+	for _, repoDigest := range repoDigests {
+		parts := strings.SplitN(repoDigest, DIGEST_DELIMITER, 2)
+		if len(parts) == 2 && normalizeRepository(parts[0]) == repository {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// normalizeRepository removes default registry and namespace of docker hub from repository
+func normalizeRepository(repository string) string {
+	repository = strings.TrimPrefix(repository, "docker.io/")
+	return strings.TrimPrefix(repository, "library/")
+}
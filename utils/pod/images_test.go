@@ -0,0 +1,162 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// fakePuller pulls images into a local image store, an image fails to be pulled as many times as configured
+type fakePuller struct {
+	sync.Mutex
+	local    map[string]string
+	remote   map[string]string
+	failures map[string]int
+	slow     map[string]bool
+	pulled   []string
+}
+
+func (f *fakePuller) PullImage(ctx context.Context, image string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.pulled = append(f.pulled, image)
+	if f.slow[image] {
+		f.Unlock()
+		<-ctx.Done()
+		f.Lock()
+		return ctx.Err()
+	}
+	if f.failures[image] > 0 {
+		f.failures[image]--
+		return errors.New("registry unavailable")
+	}
+	f.local[image] = f.remote[image]
+	return nil
+}
+
+func (f *fakePuller) ImageDigest(image string) (string, bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	digest, ok := f.local[image]
+	return digest, ok, nil
+}
+
+func TestPullImages(t *testing.T) {
+	pullBackoff = func(int) time.Duration { return 0 }
+	defer func() {
+		config.GetConfig().Set(config.PULL_POLICY, PULL_ALWAYS)
+		config.GetConfig().Set(config.PULL_TIMEOUT, "5m")
+	}()
+	config.GetConfig().Set(config.PULL_POLICY, PULL_IF_NOT_PRESENT)
+	config.GetConfig().Set(config.PULL_TIMEOUT, "100ms")
+	config.GetConfig().Set(config.PULL_RETRY, 3)
+
+	var compose, override map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web:
+    image: app:1.0
+    labels:
+      dce.pull.policy: always
+  worker:
+    image: app:1.0
+  db:
+    image: postgres:13
+  cache:
+    image: redis
+  builder:
+    build: .
+    image: builder
+`), &compose))
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  cache:
+    image: registry:5000/redis:6
+    labels:
+      - dce.pull.policy=never
+`), &override))
+	files := []string{"docker-compose.yml", "override.yml"}
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": compose, "override.yml": override})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	f := &fakePuller{
+		local:    map[string]string{"postgres:13": "sha256:pg", "registry:5000/redis:6": "sha256:redis"},
+		remote:   map[string]string{"app:1.0": "sha256:app"},
+		failures: map[string]int{"app:1.0": 2},
+	}
+	assert.NoError(t, PullImages(f, files))
+	assert.Equal(t, []string{"app:1.0", "app:1.0", "app:1.0"}, f.pulled,
+		"present images shouldn't be pulled, failed pulls should be retried")
+	assert.Equal(t, []ImagePull{
+		{Image: "app:1.0", Services: []string{"web", "worker"}, Policy: PULL_ALWAYS, Pulled: true, Digest: "sha256:app"},
+		{Image: "postgres:13", Services: []string{"db"}, Policy: PULL_IF_NOT_PRESENT, Digest: "sha256:pg"},
+		{Image: "registry:5000/redis:6", Services: []string{"cache"}, Policy: PULL_NEVER, Digest: "sha256:redis"},
+	}, GetImagePulls())
+
+	filesMap := GetServiceDetail()
+	services := filesMap["docker-compose.yml"][types.SERVICES].(map[interface{}]interface{})
+	assert.Equal(t, "app@sha256:app", services["web"].(map[interface{}]interface{})[types.IMAGE])
+	assert.Equal(t, "postgres@sha256:pg", services["db"].(map[interface{}]interface{})[types.IMAGE])
+	assert.Equal(t, "builder", services["builder"].(map[interface{}]interface{})[types.IMAGE],
+		"image built by compose shouldn't be pinned")
+	services = filesMap["override.yml"][types.SERVICES].(map[interface{}]interface{})
+	assert.Equal(t, "registry:5000/redis@sha256:redis", services["cache"].(map[interface{}]interface{})[types.IMAGE])
+
+	// one slow image fails on its own timeout while the others are pulled
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": map[string]interface{}{
+		types.SERVICES: map[interface{}]interface{}{
+			"web": map[interface{}]interface{}{types.IMAGE: "app:2.0"},
+			"db":  map[interface{}]interface{}{types.IMAGE: "slow:1"},
+			"old": map[interface{}]interface{}{types.IMAGE: "absent:1", types.LABELS: []interface{}{"dce.pull.policy=never"}},
+		},
+	}})
+	f = &fakePuller{
+		local:  map[string]string{},
+		remote: map[string]string{"app:2.0": "sha256:app2"},
+		slow:   map[string]bool{"slow:1": true},
+	}
+	err := PullImages(f, []string{"docker-compose.yml"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to pull 2 images")
+	pulls := GetImagePulls()
+	assert.Equal(t, "image absent:1 isn't present and its pull policy is never", pulls[0].Error)
+	assert.True(t, pulls[1].Pulled)
+	assert.Equal(t, "failed to pull image slow:1: timed out after 100ms", pulls[2].Error)
+
+	config.GetConfig().Set(config.PULL_POLICY, "sometimes")
+	err = PullImages(f, []string{"docker-compose.yml"})
+	assert.Error(t, err, "invalid pull policy should fail")
+}
+
+func TestRepoDigest(t *testing.T) {
+	assert.Equal(t, "registry:5000/app", ImageRepository("registry:5000/app:1.0"))
+	assert.Equal(t, "registry:5000/app", ImageRepository("registry:5000/app"))
+	assert.Equal(t, "app", ImageRepository("app@sha256:123"))
+
+	digests := []string{"registry:5000/redis@sha256:abc", "redis@sha256:def"}
+	assert.Equal(t, "sha256:def", RepoDigest("redis:6", digests))
+	assert.Equal(t, "sha256:def", RepoDigest("docker.io/library/redis:6", digests))
+	assert.Equal(t, "sha256:abc", RepoDigest("registry:5000/redis:6", digests))
+	assert.Equal(t, "", RepoDigest("app:1.0", digests))
+}
@@ -0,0 +1,226 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// MONITOR_STEP is the step name of task failure found by pod monitor
+const MONITOR_STEP = "Pod_Monitor"
+
+// podMonitor keeps the cancel func of pod monitor context
+var podMonitor struct {
+	sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewMonitorContext returns the context which pod monitor runs with, it's cancelled by StopMonitor
+func NewMonitorContext(parent context.Context) context.Context {
+	podMonitor.Lock()
+	defer podMonitor.Unlock()
+	ctx, cancel := context.WithCancel(parent)
+	podMonitor.cancel = cancel
+	return ctx
+}
+
+// StopMonitor stops pod monitor, e.g. before pod is stopped by KillTask,
+// so that containers being stopped aren't restarted or taken as failures
+func StopMonitor() {
+	podMonitor.Lock()
+	defer podMonitor.Unlock()
+	if podMonitor.cancel != nil {
+		podMonitor.cancel()
+	}
+}
+
+// monitorLock guards MonitorContainerList and HealthCheckListId, which are updated by health check and monitor,
+// and could be read by status api at the same time
+var monitorLock sync.RWMutex
+
+// GetInfraContainerId returns infra container ID of the pod, empty if infra container is removed by config
+func GetInfraContainerId() (string, error) {
+	if config.GetConfig().GetBool(types.RM_INFRA_CONTAINER) {
+		return "", nil
+	}
+	infraContainerId, err := GetContainerIdByService(ComposeFiles, types.INFRA_CONTAINER)
+	if err != nil {
+		return "", errors.Wrap(err, "fail to get infra container ID")
+	}
+	return infraContainerId, nil
+}
+
+// CheckPodStatus inspects every container in MonitorContainerList, finished containers(exit with 0) are removed
+// from the list. POD_EMPTY is returned if pod is still running.
+func CheckPodStatus(infraContainerId string) (types.PodStatus, error) {
+	logger := log.WithFields(log.Fields{
+		"func": "pod.CheckPodStatus",
+	})
+
+	// Containers are being stopped once pod is killed
+	if status := GetPodStatus(); IsTerminal(status) {
+		return status, nil
+	}
+
+	for i := 0; i < len(MonitorContainerList); i++ {
+		hc, ok := HealthCheckListId[MonitorContainerList[i].ContainerId]
+		healthy, running, exitCode, err := CheckContainer(MonitorContainerList[i].ContainerId, ok && hc)
+		if err != nil {
+			SetTaskFailure(types.TaskFailure{
+				Reason:      types.FAILURE_MONITOR,
+				Message:     fmt.Sprintf("failed to check service %s: %v", MonitorContainerList[i].ServiceName, err),
+				Step:        MONITOR_STEP,
+				Service:     MonitorContainerList[i].ServiceName,
+				ContainerId: MonitorContainerList[i].ContainerId,
+			})
+			return types.POD_FAILED, err
+		}
+		logger.Debugf("container %s has health check, health status: %s, exitCode: %d, err : %v",
+			MonitorContainerList[i], healthy.String(), exitCode, err)
+
+		// Exited container is restarted if it's allowed by restart policy of its service
+		if !running && RestartOnExit(MonitorContainerList[i], exitCode) {
+			SetServiceHealth(MonitorContainerList[i].ServiceName, SERVICE_RESTARTING)
+			continue
+		}
+
+		if exitCode != 0 {
+			SetTaskFailure(NewContainerFailure(MONITOR_STEP, MonitorContainerList[i], exitCode))
+			return types.POD_FAILED, nil
+		}
+
+		if exitCode == 0 && !running {
+			logger.Infof("Removed finished(exit with 0) container %s from monitor list",
+				MonitorContainerList[i])
+			SetServiceHealth(MonitorContainerList[i].ServiceName, "")
+			monitorLock.Lock()
+			MonitorContainerList = append(MonitorContainerList[:i], MonitorContainerList[i+1:]...)
+			monitorLock.Unlock()
+			i--
+			continue
+		}
+
+		if healthy == types.UNHEALTHY {
+			metrics.HealthCheckFailures.WithLabelValues(MonitorContainerList[i].ServiceName).Inc()
+			if !config.CleanPodOnUnhealthy() {
+				SetServiceHealth(MonitorContainerList[i].ServiceName, healthy.String())
+				continue
+			}
+			SetTaskFailure(NewContainerFailure(MONITOR_STEP, MonitorContainerList[i], 0))
+			err = PrintInspectDetail(MonitorContainerList[i].ContainerId)
+			if err != nil {
+				log.Warnf("failed to get container detail: %s ", err)
+			}
+			return types.POD_FAILED, nil
+		}
+		SetServiceHealth(MonitorContainerList[i].ServiceName, healthy.String())
+	}
+
+	status := MonitorListStatus(infraContainerId)
+	if status == types.POD_EMPTY {
+		ReportPodHealth()
+	}
+	return status, nil
+}
+
+// MonitorListStatus decides pod status from containers left in MonitorContainerList.
+// Send finished to mesos IF no container running or ONLY system proxy is running in the pod
+func MonitorListStatus(infraContainerId string) types.PodStatus {
+	logger := log.WithFields(log.Fields{
+		"func": "pod.MonitorListStatus",
+	})
+
+	switch config.IsService() {
+	case true:
+		if len(MonitorContainerList) == 0 {
+			logger.Error("Task is SERVICE. All containers in the pod exit with code 0, sending FAILED")
+			SetTaskFailure(types.TaskFailure{
+				Reason:  types.FAILURE_POD_EXITED,
+				Message: "task is service, all containers in the pod exit with code 0",
+				Step:    MONITOR_STEP,
+			})
+			return types.POD_FAILED
+		}
+		if len(MonitorContainerList) == 1 && MonitorContainerList[0].ContainerId == infraContainerId {
+			logger.Error("Task is SERVICE. Only infra container is running in the pod, sending FAILED")
+			SetTaskFailure(types.TaskFailure{
+				Reason:  types.FAILURE_POD_EXITED,
+				Message: "task is service, only infra container is running in the pod",
+				Step:    MONITOR_STEP,
+			})
+			return types.POD_FAILED
+		}
+	case false:
+		if len(MonitorContainerList) == 0 {
+			logger.Info("Task is ADHOC job. All containers in the pod exit with code 0, sending FINISHED")
+			return types.POD_FINISHED
+		}
+		if len(MonitorContainerList) == 1 && MonitorContainerList[0].ContainerId == infraContainerId {
+			logger.Info("Task is ADHOC job. Only infra container is running in the pod, sending FINISHED")
+			return types.POD_FINISHED
+		}
+	}
+	return types.POD_EMPTY
+}
+
+// RemoveFromMonitorList removes container from MonitorContainerList, returns false if container isn't monitored
+func RemoveFromMonitorList(containerId string) bool {
+	for i, c := range MonitorContainerList {
+		if c.ContainerId == containerId {
+			monitorLock.Lock()
+			MonitorContainerList = append(MonitorContainerList[:i], MonitorContainerList[i+1:]...)
+			monitorLock.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// GetMonitoredContainer returns container in MonitorContainerList by container ID
+func GetMonitoredContainer(containerId string) (types.SvcContainer, bool) {
+	for _, c := range MonitorContainerList {
+		if c.ContainerId == containerId {
+			return c, true
+		}
+	}
+	return types.SvcContainer{}, false
+}
+
+// GetMonitorContainers returns a copy of MonitorContainerList
+func GetMonitorContainers() []types.SvcContainer {
+	monitorLock.RLock()
+	defer monitorLock.RUnlock()
+	return CopySvcContainers(nil, MonitorContainerList)
+}
+
+// GetHealthCheckList returns a copy of HealthCheckListId
+func GetHealthCheckList() map[string]bool {
+	monitorLock.RLock()
+	defer monitorLock.RUnlock()
+
+	healthChecks := make(map[string]bool, len(HealthCheckListId))
+	for id, hc := range HealthCheckListId {
+		healthChecks[id] = hc
+	}
+	return healthChecks
+}
@@ -0,0 +1,85 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPodStatus(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.containers["infra"] = types.ContainerStatusDetails{IsRunning: true}
+	f.containers["redis"] = types.ContainerStatusDetails{IsRunning: true}
+	f.containers["job"] = types.ContainerStatusDetails{}
+	f.containers["failed"] = types.ContainerStatusDetails{ExitCode: 1}
+	f.containers["unhealthy"] = types.ContainerStatusDetails{IsRunning: true, HealthStatus: "unhealthy"}
+	defer func() {
+		MonitorContainerList = nil
+		HealthCheckListId = make(map[string]bool)
+	}()
+
+	config.GetConfig().Set(types.IS_SERVICE, true)
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "infra"}, {ContainerId: "redis"}, {ContainerId: "job"}}
+	status, err := CheckPodStatus("infra")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_EMPTY, status)
+	assert.Equal(t, []types.SvcContainer{{ContainerId: "infra"}, {ContainerId: "redis"}}, MonitorContainerList,
+		"finished container should be removed from monitor list")
+
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "infra"}, {ContainerId: "job"}}
+	status, err = CheckPodStatus("infra")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FAILED, status, "service with only infra container running should fail")
+
+	config.GetConfig().Set(types.IS_SERVICE, false)
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "infra"}, {ContainerId: "job"}}
+	status, err = CheckPodStatus("infra")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FINISHED, status, "adhoc job with only infra container running should finish")
+
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "redis"}, {ContainerId: "failed"}}
+	status, err = CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FAILED, status)
+
+	HealthCheckListId["unhealthy"] = true
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "unhealthy"}}
+	status, err = CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FAILED, status)
+
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "fake"}}
+	status, err = CheckPodStatus("")
+	assert.Error(t, err)
+	assert.Equal(t, types.POD_FAILED, status)
+}
+
+func TestMonitorList(t *testing.T) {
+	defer func() { MonitorContainerList = nil }()
+	MonitorContainerList = []types.SvcContainer{{ContainerId: "id1"}, {ContainerId: "id2"}}
+
+	c, ok := GetMonitoredContainer("id1")
+	assert.True(t, ok)
+	assert.Equal(t, types.SvcContainer{ContainerId: "id1"}, c)
+	_, ok = GetMonitoredContainer("id3")
+	assert.False(t, ok)
+	assert.True(t, RemoveFromMonitorList("id1"))
+	assert.False(t, RemoveFromMonitorList("id1"))
+	assert.Equal(t, []types.SvcContainer{{ContainerId: "id2"}}, MonitorContainerList)
+}
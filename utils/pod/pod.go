@@ -16,8 +16,10 @@ package pod
 
 import (
 	"bufio"
+	"bytes"
 	"container/list"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -32,6 +34,8 @@ import (
 	"github.com/paypal/dce-go/config"
 	"github.com/paypal/dce-go/plugin"
 	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/paypal/dce-go/utils/redact"
 	waitUtil "github.com/paypal/dce-go/utils/wait"
 	"github.com/paypal/gorealis/gen-go/apache/aurora"
 	"github.com/pkg/errors"
@@ -101,37 +105,37 @@ func CheckPodExitCode(files []string) (int, error) {
 
 // Check exit code of container
 func checkContainerExitCode(containerId string) (int, error) {
-	out, err := exec.Command("docker", "inspect",
-		"--format='{{.State.ExitCode}}'", containerId).Output()
-	_out := strings.Trim(strings.Trim(string(out[:]), "\n"), "'")
-	log.Printf("Check Pod Exit Code : Container %s ExitCode : %v\n", containerId, _out)
+	containerDetail, err := GetRuntime().Inspect(containerId, false)
 	if err != nil {
 		log.Errorf("Error retrieving container exit code of container : %s, %s\n", containerId, err.Error())
 		return 1, err
 	}
-
-	exitCode, err := strconv.Atoi(_out)
-	if err != nil {
-		log.Fatalf("Error converting string to int : %s\n", err.Error())
-	}
-	return exitCode, nil
+	log.Printf("Check Pod Exit Code : Container %s ExitCode : %v\n", containerId, containerDetail.ExitCode)
+	return containerDetail.ExitCode, nil
 }
 
 // get docker health check logs
 func PrintInspectDetail(containerId string) error {
-	dceLog := config.CreateFileAppendMode(types.DCE_OUT)
-	dceErr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd := exec.Command("docker", "inspect",
-		containerId)
-	cmd.Stdout = dceLog
-	cmd.Stderr = dceErr
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
-
+	out, err := GetRuntime().InspectRaw(containerId)
 	if err != nil {
 		log.Println("Error inspecting container for health check details :", err)
 		return err
 	}
-	fmt.Println("Inspect Logs: ", string(out))
+
+	// env and labels of container could have credentials
+	var inspect bytes.Buffer
+	if err = json.Indent(&inspect, redact.JSON(out), "", "    "); err != nil {
+		inspect.Reset()
+		inspect.WriteString(redact.Text(string(out)))
+	}
+	inspect.WriteString("\n")
+
+	dceLog := config.CreateFileAppendMode(types.DCE_OUT)
+	defer dceLog.Close()
+	if _, err = dceLog.Write(inspect.Bytes()); err != nil {
+		log.Warnf("Error writing inspect details of container %s: %v", containerId, err)
+	}
+	fmt.Println("Inspect Logs: ", inspect.String())
 	return nil
 }
 
@@ -143,6 +147,10 @@ func GenerateCmdParts(files []string, cmd string) ([]string, error) {
 	if config.EnableVerbose() {
 		cmd = " --verbose" + cmd
 	}
+	// deploy section of compose v3 is converted by docker-compose in compatibility mode
+	if config.GetConfig().GetBool(types.COMPOSE_COMPATIBILITY) {
+		cmd = " --compatibility" + cmd
+	}
 	var s string
 	for _, file := range files {
 		if _, err := os.Stat(file); err != nil {
@@ -158,28 +166,11 @@ func GenerateCmdParts(files []string, cmd string) ([]string, error) {
 // Get set of containers id in pod
 // docker-compose -f docker-compose.yaml ps -q
 func GetPodContainerIds(files []string) ([]string, error) {
-	var containerIds []string
-
-	parts, err := GenerateCmdParts(files, " ps -q")
-	if err != nil {
-		log.Errorln("Error generating compose cmd parts")
-		return nil, err
-	}
-
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker-compose", parts...))
+	containerIds, err := GetRuntime().Ps(files, "")
 	if err != nil {
 		log.Errorf("GetContainerIds : Error executing cmd docker-compose ps %#v", err)
 		return nil, err
 	}
-
-	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
-	for scanner.Scan() {
-		containerIds = append(containerIds, scanner.Text())
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Errorln("reading standard input:", err)
-	}
 	return containerIds, nil
 }
 
@@ -215,30 +206,13 @@ func GetContainerPid(containerID string) (string, error) {
 		return "", fmt.Errorf("container ID can't be empty")
 	}
 
-	// Generate cmd --  docker inspect -f '{{.State.Pid}}' <container id>
-	parts := strings.Fields("inspect -f '{{.State.Pid}}' " + containerID)
-
-	// Run cmd to get container pid
-	cmd := exec.Command("docker", parts...)
-	logger.Printf("Command to get container pid by container ID: %s", cmd.Args)
-
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
+	containerDetail, err := GetRuntime().Inspect(containerID, false)
 	if err != nil {
 		logger.Errorf("Error getting container pid %s : %v", containerID, err)
 		return "", err
 	}
 
-	// Scan output
-	var pid string
-	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
-	for scanner.Scan() {
-		pid += scanner.Text()
-	}
-	if err := scanner.Err(); err != nil {
-		logger.Errorln("stderr: ", err)
-		return "", err
-	}
-	pid = strings.Trim(pid, "'")
+	pid := strconv.Itoa(containerDetail.Pid)
 	logger.Printf("container pid: %s", pid)
 	return pid, nil
 }
@@ -256,52 +230,25 @@ func GetContainerIdByService(files []string, service string) (string, error) {
 		return "", err
 	}
 
-	// Generate cmd -- docker-compose -f [file] ps -q [service]
-	parts, err := GenerateCmdParts(files, " ps -q "+service)
-	if err != nil {
-		logger.Errorf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return "", err
-	}
-
-	// Run cmd to get container id
-	cmd := exec.Command("docker-compose", parts...)
-	logger.Printf("Command to get container id by service name: %s", cmd.Args)
-
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
+	ids, err := GetRuntime().Ps(files, service)
 	if err != nil {
 		logger.Errorf("Error getting container id by service: %v", err)
 		return "", err
 	}
 
-	// Scan output
-	var id string
-	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
-	for scanner.Scan() {
-		id += scanner.Text()
-	}
-	if err := scanner.Err(); err != nil {
-		logger.Errorln("stderr: ", err)
-		return "", err
-	}
-
+	id := strings.Join(ids, "")
 	logger.Printf("container id: %s", id)
 	return id, nil
 }
 
 // docker-compose -f docker-compose.yaml ps
 func GetPodDetail(files []string, primaryContainerId string, healthcheck bool) {
-	parts, err := GenerateCmdParts(files, " ps")
-	if err != nil {
-		log.Errorln("Error generating cmd parts")
-	}
-
-	//out, err := exec.Command("docker-compose", parts...).Output()
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker-compose", parts...))
+	out, err := GetRuntime().Status(files)
 	if err != nil {
 		log.Errorf("GetPodDetail : Error executing cmd docker-compose ps %#v", err)
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
+	scanner := bufio.NewScanner(strings.NewReader(out))
 	for scanner.Scan() {
 		log.Println(scanner.Text())
 	}
@@ -341,33 +288,34 @@ func GetPorts(taskInfo *mesos.TaskInfo) *list.Element {
 	return ports.Front()
 }
 
+// GetScalarResource returns the total of a scalar resource in task info, such as cpus or mem
+func GetScalarResource(taskInfo *mesos.TaskInfo, name string) float64 {
+	var total float64
+	for _, resource := range taskInfo.GetResources() {
+		if resource.GetName() == name {
+			total += resource.GetScalar().GetValue()
+		}
+	}
+	return total
+}
+
 // Launch pod
 // docker-compose up
 func LaunchPod(files []string) (types.PodStatus, error) {
 	//log.SetOutput(os.Stdout)
 	log.Println("====================Launch Pod====================")
 
-	parts, err := GenerateCmdParts(files, " up -d")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return types.POD_FAILED, err
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+			return types.POD_FAILED, err
+		}
 	}
 
-	cmd := exec.Command("docker-compose", parts...)
-	log.Printf("Launch Pod : Command to launch task : %v", cmd.Args)
-
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", types.COMPOSE_HTTP_TIMEOUT, config.GetComposeHttpTimeout()))
-
 	go dockerLogToPodLogFile(files, true)
 
 	LaunchCmdAttempted = true
-	err = cmd.Run()
+	err := GetRuntime().Up(files)
 	log.Println("Updated the state of LaunchCmdAttempted to true.")
 	if err != nil {
 		log.Printf("POD_LAUNCH_FAIL -- Error running launch task command : %v", err)
@@ -381,19 +329,9 @@ func LaunchPod(files []string) (types.PodStatus, error) {
 // 'retry' parameter is to indicate if RetryCmdLogs func should keep retrying if logs cmd fails or just exit.
 // This is to make sure that we don't go in an infinite loop in RetryCmdLogs func when pod is killed, finished or fails.
 func dockerLogToPodLogFile(files []string, retry bool) {
-	parts, err := GenerateCmdParts(files, " logs -t --follow --no-color")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	log.Printf("Command to print container log: %v", cmd.Args)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	_, err = waitUtil.RetryCmdLogs(cmd, retry)
+	err := GetRuntime().Logs(files, retry)
 	if err != nil {
-		log.Printf("POD_LAUNCH_LOG_FAIL -- Error running cmd %s\n", cmd.Args)
+		log.Printf("POD_LAUNCH_LOG_FAIL -- Error following pod logs : %v\n", err)
 	}
 }
 
@@ -424,23 +362,9 @@ func StopPod(ctx context.Context, files []string) error {
 		logger.Errorf("Error executing PreKillTask in plugins:%v", err)
 	}
 
-	//get stop timeout from config
-	timeout := config.GetStopTimeout()
-	parts, err := GenerateCmdParts(files, " stop -t "+strconv.Itoa(timeout))
-	if err != nil {
-		logger.Errorf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return err
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-
-	logger.Printf("Stop Pod : Command to stop task : %s", cmd.Args)
-
-	err = cmd.Run()
+	// Services are stopped in reverse dependency order, so infra container is stopped after app containers
+	timeout := GetStopGracePeriod()
+	err = stopServices(files, timeout)
 	if err != nil {
 		logger.Errorf("POD_STOP_FAIL -- %s", err.Error())
 		err = ForceKill()
@@ -480,20 +404,7 @@ func callAllPluginsPostKillTask(ctx context.Context) error {
 // docker-compose down -v
 func RemovePodVolume(files []string) error {
 	log.Println("====================Remove Pod Volume====================")
-	parts, err := GenerateCmdParts(files, " down -v")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return err
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-	log.Println("Remove Pod Volume: Command to rm volume : docker-compose ", parts)
-
-	err = cmd.Run()
+	err := GetRuntime().Down(files, true, false)
 	if err != nil {
 		log.Printf("POD_CLEAN_VOLUME_FAIL -- %v", err)
 		return err
@@ -506,21 +417,7 @@ func RemovePodVolume(files []string) error {
 // docker-compose down --rmi
 func RemovePodImage(files []string) error {
 	log.Println("====================Remove Pod Images====================")
-	parts, err := GenerateCmdParts(files, " down --rmi all")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return err
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-
-	log.Println("Remove Pod Image: Command to rm images : docker-compose ", parts)
-
-	err = cmd.Run()
+	err := GetRuntime().Down(files, false, true)
 	if err != nil {
 		log.Errorln("POD_CLEAN_IMAGE_FAIL -- probably images are in used by other containers")
 	}
@@ -529,28 +426,19 @@ func RemovePodImage(files []string) error {
 }
 
 func GetContainerNetwork(id string) (string, error) {
-	//cmd := exec.Command("docker", "inspect", "--format='{{.HostConfig.NetworkMode}}'", name)
-	//out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
-
-	out, err := exec.Command("docker", "inspect", "--format='{{.HostConfig.NetworkMode}}'", id).Output()
+	network, err := GetRuntime().ContainerNetwork(id)
 	if err != nil {
 		log.Errorf("Error retrieving container network mode : %s , %s\n", id, err.Error())
 		return "", err
 	}
 
-	network := strings.Replace(strings.TrimSuffix(string(out[:]), "\n"), "'", "", -1)
 	log.Printf("Get container %s network : %s\n", id, network)
 	return network, err
 }
 
 func RemoveNetwork(name string) error {
 	log.Println("====================Remove network====================")
-	cmd := exec.Command("docker", "network", "rm", name)
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-	err := cmd.Run()
+	err := GetRuntime().RemoveNetwork(name)
 	if err != nil {
 		log.Errorf("Error in rm network : %s , %s\n", name, err.Error())
 	}
@@ -577,28 +465,7 @@ func ForceKill() error {
 
 // validate compose before image pull
 func ValidateCompose(files []string) error {
-	parts, err := GenerateCmdParts(files, " config -q")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return err
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = dcelog
-	cmd.Stderr = dceerr
-	log.Println("Validate compose : Command to validate manifest : docker-compose ", parts)
-
-	err = cmd.Start()
-	if err != nil {
-		return err
-	}
-
-	err = waitUtil.WaitCmd(config.GetLaunchTimeout(), &types.CmdResult{
-		Command: cmd,
-	})
-
+	err := GetRuntime().Validate(files)
 	if err != nil {
 		return err
 	}
@@ -611,32 +478,7 @@ func ValidateCompose(files []string) error {
 func PullImage(files []string) error {
 	log.Println("====================Pull Image====================")
 
-	parts, err := GenerateCmdParts(files, " pull")
-	if err != nil {
-		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
-		return err
-	}
-
-	cmd := exec.Command("docker-compose", parts...)
-	Dcelog := config.CreateFileAppendMode(types.DCE_OUT)
-	Dceerr := config.CreateFileAppendMode(types.DCE_ERR)
-	cmd.Stdout = Dcelog
-	cmd.Stderr = Dceerr
-	log.Println("Pull Image : Command to pull images : docker-compose ", parts)
-
-	err = cmd.Start()
-	if err != nil {
-		log.Printf("POD_PULL_IMAGE_FAIL	-- %v ", err)
-		return err
-	}
-
-	err = waitUtil.WaitCmd(config.GetLaunchTimeout(), &types.CmdResult{
-		Command: cmd,
-	})
-	if err != nil {
-		return err
-	}
-	return nil
+	return GetRuntime().Pull(files)
 }
 
 // CheckContainer does check container details
@@ -676,7 +518,6 @@ func KillContainer(sig string, svcContainer types.SvcContainer) error {
 	})
 
 	var err error
-	var cmd *exec.Cmd
 
 	// Get container pid
 	if svcContainer.Pid == "" {
@@ -692,19 +533,14 @@ func KillContainer(sig string, svcContainer types.SvcContainer) error {
 	}
 	// If pid is not cached, still use docker kill sending signal
 	if svcContainer.Pid != "" && svcContainer.Pid != "0" {
-		cmd = exec.Command("kill", "-"+sig, svcContainer.Pid)
+		cmd := exec.Command("kill", "-"+sig, svcContainer.Pid)
+		logger.Printf("Command to kill container: %v", cmd.Args)
+		_, err = waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
 	} else {
 		logger.Info("pid not found from cache, sending docker kill instead")
-		if sig != "" {
-			cmd = exec.Command("docker", "kill", fmt.Sprintf("--signal=%s", sig), svcContainer.ContainerId)
-		} else {
-			cmd = exec.Command("docker", "kill", svcContainer.ContainerId)
-		}
+		err = GetRuntime().Kill(svcContainer.ContainerId, sig)
 	}
 
-	logger.Printf("Command to kill container: %v", cmd.Args)
-
-	_, err = waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
 	if err != nil {
 		log.Printf("Error kill container %s : %v", svcContainer.ContainerId, err)
 		return err
@@ -714,44 +550,24 @@ func KillContainer(sig string, svcContainer types.SvcContainer) error {
 }
 
 func GetDockerPorts(containerId string, privatePort string) (string, error) {
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker", "port", containerId, privatePort))
+	port, err := GetRuntime().Port(containerId, privatePort)
 	if err != nil {
 		log.Printf("Error inspecting container dynamic ports : %v", err)
 		return "", err
 	}
-	log.Printf("Get Container Dynamic Port : %s", string(out))
-	if ports := strings.Split(string(out), PORT_SEPARATOR); len(ports) > 1 {
-		return strings.TrimSuffix(ports[1], "\n"), nil
-	}
-	return "", err
+	return port, nil
 }
 
 // docker inspect
 func InspectContainerDetails(containerId string, healthcheck bool) (types.ContainerStatusDetails, error) {
-	var containerStatusDetails types.ContainerStatusDetails
-	var out []byte
-	var err error
-	if healthcheck {
-		out, err = waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker", "inspect",
-			"--format='{{.State.Pid}},{{.State.Running}},{{.State.ExitCode}},{{.State.Health.Status}},{{.RestartCount}},{{.HostConfig.RestartPolicy.MaximumRetryCount}},{{.Name}}'",
-			containerId))
-	} else {
-		out, err = waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker", "inspect",
-			"--format='{{.State.Pid}},{{.State.Running}},{{.State.ExitCode}},{{.RestartCount}},{{.HostConfig.RestartPolicy.MaximumRetryCount}},{{.Name}}'",
-			containerId))
-	}
+	containerStatusDetails, err := GetRuntime().Inspect(containerId, healthcheck)
 	if err != nil {
 		log.Printf("Error inspecting container details : %v \n", err)
 		return containerStatusDetails, err
 	}
 
-	containerStatusDetails, err = ParseToContainerDetail(string(out[:]), healthcheck)
-	if err != nil {
-		log.Printf("Error parsing output to container details : %v \n", err)
-		return containerStatusDetails, err
-	}
-
 	containerStatusDetails.SetContainerId(containerId)
+	updateRestartCount(&containerStatusDetails)
 
 	log.Debugf("Inspect container : %s , Name: %s, health status: %s, exit code : %v, is running : %v\n",
 		containerId, containerStatusDetails.Name, containerStatusDetails.HealthStatus,
@@ -864,6 +680,7 @@ func SetPodStatus(status types.PodStatus) {
 	CurPodStatus.Lock()
 	CurPodStatus.Status = status
 	CurPodStatus.Unlock()
+	metrics.PodStatusTransitions.WithLabelValues(status.String()).Inc()
 	log.Printf("Update Status : Update podStatus as %s", status)
 }
 
@@ -892,6 +709,7 @@ func SendPodStatus(ctx context.Context, status types.PodStatus) {
 	switch status {
 	case types.POD_RUNNING:
 		updatePodLaunched()
+		initPodHealth()
 		SendMesosStatus(ctx, ComposeExecutorDriver, ComposeTaskInfo.GetTaskId(), mesos.TaskState_TASK_RUNNING.Enum())
 	case types.POD_FINISHED:
 		// Stop pod after sending status to mesos
@@ -922,7 +740,7 @@ func SendPodStatus(ctx context.Context, status types.PodStatus) {
 		callAllPluginsPostKillTask(ctx)
 		SendMesosStatus(ctx, ComposeExecutorDriver, ComposeTaskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
 
-	case types.POD_COMPOSE_CHECK_FAILED:
+	case types.POD_COMPOSE_CHECK_FAILED, types.POD_ADMISSION_DENIED:
 		callAllPluginsPostKillTask(ctx)
 		SendMesosStatus(ctx, ComposeExecutorDriver, ComposeTaskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED.Enum())
 	}
@@ -941,6 +759,12 @@ func SendMesosStatus(ctx context.Context, driver executor.ExecutorDriver, taskId
 		TaskId: taskId,
 		State:  state,
 	}
+	if *state == mesos.TaskState_TASK_FAILED {
+		CurPodStatus.RLock()
+		launched := CurPodStatus.Launched
+		CurPodStatus.RUnlock()
+		setFailureStatus(runStatus, GetTaskFailure(), launched)
+	}
 
 	logger.Printf("start sending status %s to mesos", state.Enum().String())
 	_, err := driver.SendStatusUpdate(runStatus)
@@ -1015,6 +839,11 @@ func WaitOnPod(ctx context.Context) {
 
 // DockerDump does dump docker.pid and docker-containerd.pid and docker log if docker dump is enabled in config
 func DockerDump() {
+	// there isn't a daemon to dump with podman
+	if GetRuntime().Name() == PODMAN_RUNTIME {
+		log.Println("Skip docker dump with podman runtime")
+		return
+	}
 	log.Println(" ######## Begin dockerDump ######## ")
 
 	dockerDumpPath := config.GetConfigSection("dockerdump")["dumppath"]
@@ -1100,11 +929,11 @@ func DockerDump() {
 	fmtTime := timeNow.Format("2006-01-02 15:04:05")
 
 	//STEP3 --  copy docker log
-	cmdCpDockerLog := exec.Command("cp", dockerlogPath, dockerDumpPath+"/docker.log."+fmtTime)
-	log.Printf("Cmd to copy docker log: %s", cmdCpDockerLog.Path)
-	err = cmdCpDockerLog.Run()
+	// docker log is redacted since env of containers could be logged by docker in debug mode
+	log.Printf("Copy docker log %s with sensitive values redacted", dockerlogPath)
+	err = copyRedacted(dockerlogPath, dockerDumpPath+"/docker.log."+fmtTime)
 	if err != nil {
-		log.Errorf("Error running cmd to copy docker log: %v", err)
+		log.Errorf("Error copying docker log: %v", err)
 	} else {
 		log.Println(" CP docker.log complete ...")
 	}
@@ -1120,7 +949,7 @@ func DockerDump() {
 			log.Errorln("Error opening file")
 		}
 		defer f.Close()
-		_, err = f.Write(outDockerInfo)
+		_, err = f.Write([]byte(redact.Text(string(outDockerInfo))))
 		if err != nil {
 			log.Errorf(" Failed file write: %s/docker.info.. error:%v", dockerDumpPath, err)
 		}
@@ -1182,6 +1011,10 @@ func HealthCheck(files []string, podServices map[string]bool, out chan<- string)
 		containers, err = GetServiceContainers(files, services)
 		if err != nil {
 			logger.Errorln("Error retrieving container id list : ", err.Error())
+			SetTaskFailure(types.TaskFailure{
+				Reason:  types.FAILURE_HEALTH_CHECK,
+				Message: fmt.Sprintf("failed to get containers of pod: %v", err),
+			})
 			out <- types.POD_FAILED.String()
 			return
 		}
@@ -1189,7 +1022,9 @@ func HealthCheck(files []string, podServices map[string]bool, out chan<- string)
 		logger.Debugf("list of containers are launched : %v", containers)
 		time.Sleep(interval)
 	}
+	monitorLock.Lock()
 	MonitorContainerList = CopySvcContainers(MonitorContainerList, containers)
+	monitorLock.Unlock()
 	for _, c := range MonitorContainerList {
 		logger.Infof("service : %s, containerid: %s, pid: %s", c.ServiceName, c.ContainerId, c.Pid)
 	}
@@ -1204,6 +1039,11 @@ func HealthCheck(files []string, podServices map[string]bool, out chan<- string)
 		systemProxyId, err = GetContainerIdByService(files, types.INFRA_CONTAINER)
 		if err != nil {
 			logger.Errorf("Error getting container id of service %s: %v", types.INFRA_CONTAINER, err)
+			SetTaskFailure(types.TaskFailure{
+				Reason:  types.FAILURE_HEALTH_CHECK,
+				Message: fmt.Sprintf("failed to get container of service %s: %v", types.INFRA_CONTAINER, err),
+				Service: types.INFRA_CONTAINER,
+			})
 			log.Println("POD_INIT_HEALTH_CHECK_FAILURE -- Send Failed")
 			out <- types.POD_FAILED.String()
 			return
@@ -1233,6 +1073,12 @@ healthCheck:
 				}
 			}
 
+			// Exited container is restarted if it's allowed by restart policy of its service, state of container
+			// isn't known if it fails to be inspected
+			if err == nil && !running && RestartOnExit(containers[i], exitCode) {
+				continue
+			}
+
 			if !(exitCode == 0 && !running) && healthy == types.UNHEALTHY {
 				err = fmt.Errorf("service %s is unhealthy", containers[i].ServiceName)
 
@@ -1240,6 +1086,9 @@ healthCheck:
 					types.GetInstanceStatusTag(containers[i], healthy, running, exitCode), err)
 
 				log.Println("POD_INIT_HEALTH_CHECK_FAILURE -- Send Failed")
+				metrics.HealthCheckFailures.WithLabelValues(containers[i].ServiceName).Inc()
+				SetTaskFailure(NewContainerFailure(fmt.Sprintf("HealthCheck-%s", containers[i].ServiceName),
+					containers[i], exitCode))
 				err = PrintInspectDetail(containers[i].ContainerId)
 				if err != nil {
 					log.Warnf("Error during docker inspect: %v ", err)
@@ -1273,6 +1122,9 @@ healthCheck:
 					types.GetInstanceStatusTag(containers[i], healthy, running, exitCode), err)
 
 				log.Println("POD_INIT_HEALTH_CHECK_FAILURE -- Send Failed")
+				metrics.HealthCheckFailures.WithLabelValues(containers[i].ServiceName).Inc()
+				SetTaskFailure(NewContainerFailure(fmt.Sprintf("HealthCheck-%s", containers[i].ServiceName),
+					containers[i], exitCode))
 				err = PrintInspectDetail(containers[i].ContainerId)
 				if err != nil {
 					log.Warnf("Error during docker inspect: %v ", err)
@@ -1293,7 +1145,9 @@ healthCheck:
 	}
 
 	UpdateHealthCheckStatus(StepMetrics)
+	monitorLock.Lock()
 	MonitorContainerList = CopySvcContainers(MonitorContainerList, containers)
+	monitorLock.Unlock()
 
 	logger.Printf("Health Check List: %v", HealthCheckListId)
 	logger.Printf("Pod Monitor List: %v", MonitorContainerList)
@@ -1306,12 +1160,20 @@ healthCheck:
 		out <- types.POD_FINISHED.String()
 	} else if len(containers) == 0 && isService {
 		logger.Println("Task is SERVICE. Send POD_FAILED")
+		SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_POD_EXITED,
+			Message: "task is service, all containers in the pod exit with code 0",
+		})
 		out <- types.POD_FAILED.String()
 	} else if !isService && hasInfra && len(containers) == 1 && containers[0].ContainerId == systemProxyId {
 		logger.Println("Task is ADHOC job. Only infra container is running, send POD_FINISHED")
 		out <- types.POD_FINISHED.String()
 	} else if isService && hasInfra && len(containers) == 1 && containers[0].ContainerId == systemProxyId {
 		logger.Println("Task is SERVICE. Only infra container is running, send POD_FAILED")
+		SetTaskFailure(types.TaskFailure{
+			Reason:  types.FAILURE_POD_EXITED,
+			Message: "task is service, only infra container is running in the pod",
+		})
 		out <- types.POD_FAILED.String()
 	} else {
 		logger.Println("Initial Health Check : send POD_RUNNING")
@@ -1325,18 +1187,19 @@ healthCheck:
 
 // check if primary container unable health check or not
 func isHealthCheckConfigured(containerId string) (bool, error) {
-	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command("docker", "inspect", "--format='{{if .State.Health }}{{.State.Health.Status}}{{ end }}'", containerId))
+	hc, err := GetRuntime().HasHealthCheck(containerId)
 	if err != nil {
 		log.Errorf("Error executing cmd to check if healtcheck configured: %v", err)
 		return false, err
 	}
 
-	_out := strings.Replace(strings.TrimSuffix(string(out[:]), "\n"), "'", "", -1)
-	if _out == "" {
+	if !hc {
 		return false, nil
 	}
 
+	monitorLock.Lock()
 	HealthCheckListId[containerId] = true
+	monitorLock.Unlock()
 	//log.Debugf("Initial Health Check : Container %s Health check is configured to true", containerId)
 	return true, nil
 }
@@ -1345,6 +1208,10 @@ func IsService(taskInfo *mesos.TaskInfo) bool {
 	d := thrift.NewTDeserializer()
 	assignTask := aurora.NewAssignedTask()
 	d.Read(assignTask, taskInfo.GetData())
+	// task info not scheduled by aurora, e.g. launched in run mode, doesn't carry aurora task config
+	if assignTask.Task == nil {
+		return false
+	}
 	return assignTask.Task.IsService
 }
 
@@ -1497,3 +1364,18 @@ func stopDriver(ctx context.Context, status string, driver executor.ExecutorDriv
 	}
 	logger.Infof("driver stopped with status %s", driverStatus.String())
 }
+
+// copyRedacted copies text file with sensitive values redacted
+func copyRedacted(source, dest string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return redact.Copy(dst, src)
+}
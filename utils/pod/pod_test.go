@@ -265,6 +265,11 @@ func TestGetLabel(t *testing.T) {
 	}
 }
 
+func TestIsService(t *testing.T) {
+	assert.False(t, IsService(&mesos.TaskInfo{}), "task info without aurora task config isn't a service")
+	assert.False(t, IsService(&mesos.TaskInfo{Data: []byte("not thrift")}))
+}
+
 func TestGetAndRemoveLabel(t *testing.T) {
 	key1 := "org.apache.aurora.metadata.nsvip"
 	value1 := "1.1.1.1"
@@ -0,0 +1,508 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	COMPOSE_ADMISSION_STEP = "Compose_Admission"
+	VOLUME_DELIMITER       = ":"
+	VOLUME_TYPE            = "type"
+	VOLUME_SOURCE          = "source"
+	BIND_VOLUME            = "bind"
+	CAPABILITY_PREFIX      = "CAP_"
+	VOLUME_DEVICE          = "device"
+	VOLUME_OPTIONS         = "o"
+	UNCONFINED             = "unconfined"
+)
+
+// PolicyViolation is a compose option of a service violating compose policy
+type PolicyViolation struct {
+	File    string
+	Service string
+	Rule    string
+	Value   string
+	// Stripped is true if the option is removed from compose file instead of denying the pod
+	Stripped bool
+}
+
+func (v PolicyViolation) String() string {
+	if v.Service == "" {
+		return fmt.Sprintf("%s in %s isn't allowed: %s", v.Rule, filepath.Base(v.File), v.Value)
+	}
+	return fmt.Sprintf("%s of service %s in %s isn't allowed: %s", v.Rule, v.Service, filepath.Base(v.File), v.Value)
+}
+
+// composeRule checks a service by a rule of compose policy, options violating the rule are removed if strip is true.
+// It returns the violations and whether they are stripped. keys are the compose options covered by the rule.
+type composeRule struct {
+	name   string
+	config string
+	keys   []string
+	check  func(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation
+}
+
+var composeRules = []composeRule{
+	{types.PRIVILEGED, config.ADMISSION_PRIVILEGED, []string{types.PRIVILEGED, types.SECURITY_OPT}, checkPrivileged},
+	{"host namespace", config.ADMISSION_HOST_NAMESPACES, []string{types.PID, types.IPC, types.UTS, types.USERNS_MODE,
+		types.CGROUP, types.NETWORK_MODE}, checkHostNamespaces},
+	{types.CAP_ADD, config.ADMISSION_CAPABILITIES, []string{types.CAP_ADD}, checkCapabilities},
+	{types.DEVICES, config.ADMISSION_DEVICES, []string{types.DEVICES}, checkDevices},
+	{"host path", config.ADMISSION_HOST_PATHS, []string{types.VOLUMES, types.VOLUMES_FROM}, checkHostPaths},
+}
+
+// variable matches variables which compose substitutes from environment and .env file of project folder, either
+// $VAR or ${VAR}. $$ is an escaped $.
+var variable = regexp.MustCompile(`\$(\{|[A-Za-z_])`)
+
+// AdmitCompose evaluates compose policy in admission.compose of config against services of pod. Each rule either
+// allows, denies or strips the compose options it covers: privileged mode and security options disabling
+// confinement, namespaces of host or other containers, cap_add outside capability allowlist, devices, and bind
+// mounts of host paths outside host path allowlist including named volumes bound to host paths and volumes of
+// other containers.
+// Covered options with variables are always denied, since compose substitutes them only at up, after admission.
+// Stripped options are removed from compose files, it returns a failure of the task with all the violations if any
+// option is denied.
+func AdmitCompose(files []string) *types.TaskFailure {
+	actions := make(map[string]string)
+	for _, rule := range composeRules {
+		if action := config.GetComposePolicy(rule.config); action != config.POLICY_ALLOW {
+			actions[rule.name] = action
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	log.Println("====================Admit Compose====================")
+
+	filesMap := GetServiceDetail()
+	var denied []PolicyViolation
+	for _, file := range files {
+		servMap, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, len(servMap))
+		for name := range servMap {
+			names = append(names, fmt.Sprint(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			containerDetails, ok := servMap[name].(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			for _, rule := range composeRules {
+				action, ok := actions[rule.name]
+				if !ok {
+					continue
+				}
+				violations := checkVariables(containerDetails, rule.keys)
+				violations = append(violations, rule.check(file, containerDetails, action == config.POLICY_STRIP)...)
+				for _, v := range violations {
+					v.File, v.Service = file, name
+					denied = admitViolation(v, denied)
+				}
+			}
+		}
+		// named volumes could bind host paths by options of local driver
+		if action, ok := actions["host path"]; ok {
+			for _, v := range checkVolumeDevices(file, filesMap[file], action == config.POLICY_STRIP) {
+				v.File = file
+				denied = admitViolation(v, denied)
+			}
+		}
+	}
+	SetServiceDetail(filesMap)
+
+	if len(denied) == 0 {
+		log.Println("Compose files of pod are admitted")
+		return nil
+	}
+	messages := make([]string, 0, len(denied))
+	services := make(map[string]bool)
+	for _, v := range denied {
+		messages = append(messages, v.String())
+		services[v.Service] = true
+	}
+	failure := &types.TaskFailure{
+		Reason:  types.FAILURE_COMPOSE_DENIED,
+		Message: strings.Join(messages, "; "),
+		Step:    COMPOSE_ADMISSION_STEP,
+	}
+	if len(services) == 1 {
+		failure.Service = denied[0].Service
+	}
+	return failure
+}
+
+// admitViolation logs a violation, and adds it to denied violations unless it's stripped
+func admitViolation(v PolicyViolation, denied []PolicyViolation) []PolicyViolation {
+	if v.Stripped {
+		log.Warnf("Strip compose option : %s", v)
+		return denied
+	}
+	log.Errorf("POD_ADMISSION_DENIED -- %s", v)
+	return append(denied, v)
+}
+
+// checkVariables checks covered options with variables, whose values aren't known until compose up
+func checkVariables(details map[interface{}]interface{}, keys []string) []PolicyViolation {
+	var violations []PolicyViolation
+	for _, key := range keys {
+		for _, value := range variables(details[key]) {
+			violations = append(violations, PolicyViolation{Rule: "variable in " + key, Value: value})
+		}
+	}
+	return violations
+}
+
+// variables returns the strings with variables in a compose option, including in its lists and maps
+func variables(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		if variable.MatchString(strings.ReplaceAll(v, "$$", "")) {
+			values = append(values, v)
+		}
+	case []interface{}:
+		for _, e := range v {
+			values = append(values, variables(e)...)
+		}
+	case map[interface{}]interface{}:
+		for _, e := range v {
+			values = append(values, variables(e)...)
+		}
+		sort.Strings(values)
+	}
+	return values
+}
+
+// checkPrivileged checks privileged mode and security_opt disabling seccomp, apparmor or selinux confinement
+func checkPrivileged(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	var violations []PolicyViolation
+	if privileged, ok := containerDetails[types.PRIVILEGED].(bool); ok && privileged {
+		if strip {
+			delete(containerDetails, types.PRIVILEGED)
+		}
+		violations = append(violations, PolicyViolation{Rule: types.PRIVILEGED, Value: "true", Stripped: strip})
+	}
+
+	securityOpts, ok := containerDetails[types.SECURITY_OPT].([]interface{})
+	if !ok {
+		return violations
+	}
+	kept := make([]interface{}, 0, len(securityOpts))
+	for _, opt := range securityOpts {
+		if !isUnconfined(fmt.Sprint(opt)) {
+			kept = append(kept, opt)
+			continue
+		}
+		violations = append(violations, PolicyViolation{Rule: types.SECURITY_OPT, Value: fmt.Sprint(opt),
+			Stripped: strip})
+	}
+	if strip && len(kept) < len(securityOpts) {
+		if len(kept) == 0 {
+			delete(containerDetails, types.SECURITY_OPT)
+		} else {
+			containerDetails[types.SECURITY_OPT] = kept
+		}
+	}
+	return violations
+}
+
+// isUnconfined checks whether a security option disables confinement, such as seccomp:unconfined,
+// apparmor=unconfined, label:disable or systempaths=unconfined
+func isUnconfined(opt string) bool {
+	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(opt)), "=", 2)
+	if len(parts) != 2 {
+		parts = strings.SplitN(parts[0], ":", 2)
+	}
+	if len(parts) != 2 {
+		return false
+	}
+	switch parts[0] {
+	case "seccomp", "apparmor", "systempaths":
+		return parts[1] == UNCONFINED
+	case "label":
+		return parts[1] == "disable"
+	}
+	return false
+}
+
+// checkHostNamespaces checks pid, ipc, uts, userns_mode, cgroup and network_mode of host, and pid, ipc and
+// network_mode joining other containers, which could be containers outside the pod. Network mode isn't stripped
+// since pod doesn't join infra container in these modes, so it's always denied unless it's allowed.
+func checkHostNamespaces(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	var violations []PolicyViolation
+	for _, key := range []string{types.PID, types.IPC, types.UTS, types.USERNS_MODE, types.CGROUP,
+		types.NETWORK_MODE} {
+		mode, ok := containerDetails[key].(string)
+		if !ok || (mode != types.HOST_MODE && !strings.HasPrefix(mode, types.CONTAINER_MODE_PREFIX)) {
+			continue
+		}
+		stripped := strip && key != types.NETWORK_MODE
+		if stripped {
+			delete(containerDetails, key)
+		}
+		violations = append(violations, PolicyViolation{Rule: key, Value: mode, Stripped: stripped})
+	}
+	return violations
+}
+
+// checkCapabilities checks cap_add against capability allowlist, capabilities are compared without CAP_ prefix
+func checkCapabilities(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	capAdd, ok := containerDetails[types.CAP_ADD].([]interface{})
+	if !ok {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for _, c := range config.GetCapabilityAllowlist() {
+		allowed[normalizeCapability(c)] = true
+	}
+
+	var violations []PolicyViolation
+	kept := make([]interface{}, 0, len(capAdd))
+	for _, c := range capAdd {
+		if allowed[normalizeCapability(fmt.Sprint(c))] {
+			kept = append(kept, c)
+			continue
+		}
+		violations = append(violations, PolicyViolation{Rule: types.CAP_ADD, Value: fmt.Sprint(c), Stripped: strip})
+	}
+	if strip && len(violations) > 0 {
+		if len(kept) == 0 {
+			delete(containerDetails, types.CAP_ADD)
+		} else {
+			containerDetails[types.CAP_ADD] = kept
+		}
+	}
+	return violations
+}
+
+func normalizeCapability(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), CAPABILITY_PREFIX)
+}
+
+func checkDevices(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	devices, ok := containerDetails[types.DEVICES].([]interface{})
+	if !ok || len(devices) == 0 {
+		return nil
+	}
+	violations := make([]PolicyViolation, 0, len(devices))
+	for _, d := range devices {
+		violations = append(violations, PolicyViolation{Rule: types.DEVICES, Value: fmt.Sprint(d), Stripped: strip})
+	}
+	if strip {
+		delete(containerDetails, types.DEVICES)
+	}
+	return violations
+}
+
+// checkHostPaths checks bind mounts of services against host path allowlist. Relative paths are resolved against
+// the folder of compose file, they are allowed as long as they are in sandbox. volumes_from of containers outside
+// pod are checked as well, since their mounts aren't known.
+func checkHostPaths(file string, containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	violations := checkVolumesFrom(containerDetails, strip)
+	volumes, ok := containerDetails[types.VOLUMES].([]interface{})
+	if !ok {
+		return violations
+	}
+
+	kept := make([]interface{}, 0, len(volumes))
+	for _, v := range volumes {
+		source := volumeSource(v)
+		if source == "" || isHostPathAllowed(file, source) {
+			kept = append(kept, v)
+			continue
+		}
+		violations = append(violations, PolicyViolation{Rule: types.VOLUMES, Value: source, Stripped: strip})
+	}
+	if strip && len(kept) < len(volumes) {
+		containerDetails[types.VOLUMES] = kept
+	}
+	return violations
+}
+
+// checkVolumesFrom checks volumes_from of containers, volumes_from of services in pod are allowed since their
+// volumes are checked themselves
+func checkVolumesFrom(containerDetails map[interface{}]interface{}, strip bool) []PolicyViolation {
+	volumesFrom, ok := containerDetails[types.VOLUMES_FROM].([]interface{})
+	if !ok {
+		return nil
+	}
+	var violations []PolicyViolation
+	kept := make([]interface{}, 0, len(volumesFrom))
+	for _, v := range volumesFrom {
+		if !strings.HasPrefix(fmt.Sprint(v), types.CONTAINER_MODE_PREFIX) {
+			kept = append(kept, v)
+			continue
+		}
+		violations = append(violations, PolicyViolation{Rule: types.VOLUMES_FROM, Value: fmt.Sprint(v), Stripped: strip})
+	}
+	if strip && len(kept) < len(volumesFrom) {
+		if len(kept) == 0 {
+			delete(containerDetails, types.VOLUMES_FROM)
+		} else {
+			containerDetails[types.VOLUMES_FROM] = kept
+		}
+	}
+	return violations
+}
+
+// checkVolumeDevices checks top-level named volumes bound to host paths by driver_opts of local driver, such as
+// {type: none, o: bind, device: /}, against host path allowlist. Options of stripped volumes are removed, so they
+// become ordinary named volumes. Options with variables are denied.
+func checkVolumeDevices(file string, composeMap map[string]interface{}, strip bool) []PolicyViolation {
+	volumes, ok := composeMap[types.VOLUMES].(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(volumes))
+	for name := range volumes {
+		names = append(names, fmt.Sprint(name))
+	}
+	sort.Strings(names)
+
+	var violations []PolicyViolation
+	for _, name := range names {
+		volume, ok := volumes[name].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		opts, ok := volume[types.DRIVER_OPTS].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if values := variables(opts); len(values) > 0 {
+			for _, value := range values {
+				violations = append(violations, PolicyViolation{Rule: fmt.Sprintf("variable in %s of volume %s",
+					types.DRIVER_OPTS, name), Value: value})
+			}
+			continue
+		}
+		device, ok := opts[VOLUME_DEVICE]
+		if !ok || !isBindOption(fmt.Sprint(opts[VOLUME_OPTIONS])) || isHostPathAllowed(file, fmt.Sprint(device)) {
+			continue
+		}
+		if strip {
+			delete(volume, types.DRIVER_OPTS)
+		}
+		violations = append(violations, PolicyViolation{Rule: fmt.Sprintf("%s of volume %s", VOLUME_DEVICE, name),
+			Value: fmt.Sprint(device), Stripped: strip})
+	}
+	return violations
+}
+
+// isBindOption checks whether mount options of local driver bind a host path, such as bind or rbind,ro
+func isBindOption(o string) bool {
+	for _, opt := range strings.Split(o, ",") {
+		if opt = strings.TrimSpace(opt); opt == BIND_VOLUME || opt == "r"+BIND_VOLUME {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeSource returns host path of a bind mount, it's empty for named volumes and volumes of other types
+func volumeSource(v interface{}) string {
+	var source string
+	switch volume := v.(type) {
+	case string:
+		parts := strings.SplitN(volume, VOLUME_DELIMITER, 2)
+		if len(parts) < 2 {
+			return ""
+		}
+		source = parts[0]
+	case map[interface{}]interface{}:
+		if fmt.Sprint(volume[VOLUME_TYPE]) != BIND_VOLUME {
+			return ""
+		}
+		source = fmt.Sprint(volume[VOLUME_SOURCE])
+	default:
+		return ""
+	}
+	// named volume doesn't start with a path
+	if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") {
+		return ""
+	}
+	return source
+}
+
+// isHostPathAllowed checks host path against host path allowlist. Relative paths are resolved against folder of
+// compose file along with their symlinks, they are allowed if they're in sandbox.
+func isHostPathAllowed(file, source string) bool {
+	path := source
+	if strings.HasPrefix(source, ".") {
+		sandbox, err := os.Getwd()
+		if err != nil {
+			return false
+		}
+		if sandbox, err = filepath.EvalSymlinks(sandbox); err != nil {
+			return false
+		}
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			return false
+		}
+		if path, err = evalSymlinks(filepath.Join(dir, source)); err != nil {
+			log.Warnf("Error resolving host path %s : %v", source, err)
+			return false
+		}
+		if rel, err := filepath.Rel(sandbox, path); err == nil && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	} else if !strings.HasPrefix(source, "~") {
+		path = filepath.Clean(source)
+	}
+
+	for _, allowed := range config.GetHostPathAllowlist() {
+		allowed = filepath.Clean(allowed)
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// evalSymlinks resolves symlinks of the longest existing part of path, the rest is created as it is by compose
+func evalSymlinks(path string) (string, error) {
+	var rest string
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestAdmitCompose(t *testing.T) {
+	rules := []string{config.ADMISSION_PRIVILEGED, config.ADMISSION_HOST_NAMESPACES, config.ADMISSION_CAPABILITIES,
+		config.ADMISSION_DEVICES, config.ADMISSION_HOST_PATHS}
+	defer func() {
+		for _, rule := range rules {
+			config.GetConfig().Set(rule, "")
+		}
+		config.GetConfig().Set(config.ADMISSION_CAPABILITY_ALLOWLIST, nil)
+		config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, nil)
+	}()
+
+	compose := func() map[string]interface{} {
+		var compose map[string]interface{}
+		assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web:
+    image: web
+    privileged: true
+    pid: host
+    cap_add: [NET_ADMIN, CAP_SYS_ADMIN]
+    devices:
+      - /dev/fuse:/dev/fuse
+    volumes:
+      - data:/data
+      - ./conf:/etc/web
+      - /var/run/docker.sock:/var/run/docker.sock
+      - /var/log/web:/logs
+      - type: bind
+        source: ../../../etc
+        target: /host-etc
+  proxy:
+    image: proxy
+    network_mode: host
+`), &compose))
+		return compose
+	}
+	files := []string{"poddata/docker-compose.yml"}
+
+	SetServiceDetail(types.ServiceDetail{files[0]: compose()})
+	defer SetServiceDetail(make(types.ServiceDetail))
+	assert.Nil(t, AdmitCompose(files), "compose options should be allowed without compose policy")
+
+	for _, rule := range rules {
+		config.GetConfig().Set(rule, config.POLICY_DENY)
+	}
+	config.GetConfig().Set(config.ADMISSION_CAPABILITY_ALLOWLIST, []string{"net_admin"})
+	config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, []string{"/var/log/"})
+	failure := AdmitCompose(files)
+	assert.Equal(t, &types.TaskFailure{
+		Reason: types.FAILURE_COMPOSE_DENIED,
+		Message: "network_mode of service proxy in docker-compose.yml isn't allowed: host; " +
+			"privileged of service web in docker-compose.yml isn't allowed: true; " +
+			"pid of service web in docker-compose.yml isn't allowed: host; " +
+			"cap_add of service web in docker-compose.yml isn't allowed: CAP_SYS_ADMIN; " +
+			"devices of service web in docker-compose.yml isn't allowed: /dev/fuse:/dev/fuse; " +
+			"volumes of service web in docker-compose.yml isn't allowed: /var/run/docker.sock; " +
+			"volumes of service web in docker-compose.yml isn't allowed: ../../../etc",
+		Step: COMPOSE_ADMISSION_STEP,
+	}, failure)
+
+	for _, rule := range rules {
+		config.GetConfig().Set(rule, config.POLICY_STRIP)
+	}
+	SetServiceDetail(types.ServiceDetail{files[0]: compose()})
+	failure = AdmitCompose(files)
+	assert.Equal(t, "network_mode of service proxy in docker-compose.yml isn't allowed: host", failure.Message,
+		"host network can't be stripped")
+	assert.Equal(t, "proxy", failure.Service)
+
+	services := GetServiceDetail()[files[0]][types.SERVICES].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{
+		types.IMAGE:   "web",
+		types.CAP_ADD: []interface{}{"NET_ADMIN"},
+		types.VOLUMES: []interface{}{"data:/data", "./conf:/etc/web", "/var/log/web:/logs"},
+	}, services["web"])
+
+	config.GetConfig().Set(config.ADMISSION_HOST_NAMESPACES, config.POLICY_ALLOW)
+	assert.Nil(t, AdmitCompose(files))
+}
+
+func TestAdmitComposeOptions(t *testing.T) {
+	rules := []string{config.ADMISSION_PRIVILEGED, config.ADMISSION_HOST_NAMESPACES, config.ADMISSION_HOST_PATHS}
+	defer func() {
+		for _, rule := range rules {
+			config.GetConfig().Set(rule, "")
+		}
+		config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, nil)
+	}()
+
+	compose := func() map[string]interface{} {
+		var compose map[string]interface{}
+		assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  web:
+    image: web
+    pid: container:agent
+    ipc: service:db
+    cgroup: host
+    security_opt:
+      - seccomp:unconfined
+      - apparmor=unconfined
+      - no-new-privileges:true
+    volumes_from:
+      - db
+      - container:agent
+    volumes:
+      - root:/host
+      - logs:/logs
+  db:
+    image: db
+    network_mode: container:agent
+    security_opt: [label:disable]
+volumes:
+  root:
+    driver_opts:
+      type: none
+      o: bind
+      device: /
+  logs:
+    driver: local
+    driver_opts:
+      type: none
+      o: rbind
+      device: /var/log/web
+  data: {}
+`), &compose))
+		return compose
+	}
+	files := []string{"poddata/docker-compose.yml"}
+	SetServiceDetail(types.ServiceDetail{files[0]: compose()})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	for _, rule := range rules {
+		config.GetConfig().Set(rule, config.POLICY_DENY)
+	}
+	config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, []string{"/var/log"})
+	assert.Equal(t, "security_opt of service db in docker-compose.yml isn't allowed: label:disable; "+
+		"network_mode of service db in docker-compose.yml isn't allowed: container:agent; "+
+		"security_opt of service web in docker-compose.yml isn't allowed: seccomp:unconfined; "+
+		"security_opt of service web in docker-compose.yml isn't allowed: apparmor=unconfined; "+
+		"pid of service web in docker-compose.yml isn't allowed: container:agent; "+
+		"cgroup of service web in docker-compose.yml isn't allowed: host; "+
+		"volumes_from of service web in docker-compose.yml isn't allowed: container:agent; "+
+		"device of volume root in docker-compose.yml isn't allowed: /", AdmitCompose(files).Message)
+
+	for _, rule := range rules {
+		config.GetConfig().Set(rule, config.POLICY_STRIP)
+	}
+	assert.Equal(t, "network_mode of service db in docker-compose.yml isn't allowed: container:agent",
+		AdmitCompose(files).Message, "network mode of other containers can't be stripped")
+
+	composeMap := GetServiceDetail()[files[0]]
+	services := composeMap[types.SERVICES].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{
+		types.IMAGE:        "web",
+		types.IPC:          "service:db",
+		types.SECURITY_OPT: []interface{}{"no-new-privileges:true"},
+		types.VOLUMES_FROM: []interface{}{"db"},
+		types.VOLUMES:      []interface{}{"root:/host", "logs:/logs"},
+	}, services["web"])
+	assert.NotContains(t, services["db"], types.SECURITY_OPT)
+	volumes := composeMap[types.VOLUMES].(map[interface{}]interface{})
+	assert.Equal(t, map[interface{}]interface{}{}, volumes["root"], "volume bound to host path should be stripped")
+	assert.Contains(t, volumes["logs"], types.DRIVER_OPTS, "volume bound to allowed host path should be kept")
+}
+
+func TestAdmitComposeVariables(t *testing.T) {
+	rules := []string{config.ADMISSION_PRIVILEGED, config.ADMISSION_HOST_NAMESPACES, config.ADMISSION_HOST_PATHS}
+	defer func() {
+		for _, rule := range rules {
+			config.GetConfig().Set(rule, "")
+		}
+	}()
+
+	// variables are substituted by compose from .env file of project folder in sandbox at up
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("ROOT=/\nP=true\nM=host\n"), 0644))
+	body := []byte(`
+services:
+  web:
+    image: web
+    privileged: ${P}
+    pid: $M
+    network_mode: ${M:-bridge}
+    volumes:
+      - ${ROOT:-/}:/host
+      - ./cache$$1:/cache
+      - type: bind
+        source: ${ROOT}
+        target: /root
+volumes:
+  root:
+    driver_opts:
+      type: none
+      o: bind
+      device: ${ROOT}
+`)
+	file := filepath.Join(dir, "docker-compose.yml")
+	assert.NoError(t, ioutil.WriteFile(file, body, 0644))
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(body, &compose))
+	SetServiceDetail(types.ServiceDetail{file: compose})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	for _, rule := range rules {
+		config.GetConfig().Set(rule, config.POLICY_STRIP)
+	}
+	assert.Equal(t, "variable in privileged of service web in docker-compose.yml isn't allowed: ${P}; "+
+		"variable in pid of service web in docker-compose.yml isn't allowed: $M; "+
+		"variable in network_mode of service web in docker-compose.yml isn't allowed: ${M:-bridge}; "+
+		"variable in volumes of service web in docker-compose.yml isn't allowed: ${ROOT:-/}:/host; "+
+		"variable in volumes of service web in docker-compose.yml isn't allowed: ${ROOT}; "+
+		"variable in driver_opts of volume root in docker-compose.yml isn't allowed: ${ROOT}",
+		AdmitCompose([]string{file}).Message, "options with variables should be denied even if they're stripped")
+}
+
+func TestIsHostPathAllowed(t *testing.T) {
+	config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, []string{"/var/log"})
+	defer config.GetConfig().Set(config.ADMISSION_HOST_PATH_ALLOWLIST, nil)
+
+	sandbox := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(sandbox))
+	defer os.Chdir(wd)
+	assert.NoError(t, os.MkdirAll(filepath.Join(sandbox, "poddata", "conf"), os.ModePerm))
+	assert.NoError(t, os.Symlink("/", filepath.Join(sandbox, "poddata", "root")))
+	assert.NoError(t, os.Symlink("/var/log", filepath.Join(sandbox, "poddata", "logs")))
+	file := "poddata/docker-compose.yml"
+
+	assert.True(t, isHostPathAllowed(file, "./conf"))
+	assert.True(t, isHostPathAllowed(file, "./data/db"), "paths created by compose in sandbox should be allowed")
+	assert.True(t, isHostPathAllowed(file, "../poddata"))
+	assert.True(t, isHostPathAllowed(file, "./logs/web"), "symlinks to allowed host paths should be allowed")
+	assert.True(t, isHostPathAllowed(file, "/var/log/web"))
+	assert.False(t, isHostPathAllowed(file, "../.."))
+	assert.False(t, isHostPathAllowed(file, "./root"), "symlinks out of sandbox should be resolved")
+	assert.False(t, isHostPathAllowed(file, "./root/etc"))
+	assert.False(t, isHostPathAllowed(file, "./root/missing/dir"))
+	assert.False(t, isHostPathAllowed(file, "/etc"))
+}
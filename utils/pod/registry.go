@@ -0,0 +1,228 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DOCKER_CONFIG            = "DOCKER_CONFIG"
+	DOCKER_CONFIG_FILE       = "config.json"
+	DOCKER_CONFIG_DIR_PREFIX = "docker-"
+)
+
+// RegistryAuth is the credential of a registry
+type RegistryAuth struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// dockerConfig is the part of docker config file about registry credentials
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+var registryAuth struct {
+	sync.Mutex
+	config dockerConfig
+	// dir is the docker config dir of pod on tmpfs, it's empty if there isn't any credential
+	dir string
+}
+
+// AddRegistryAuth adds a registry credential into docker config of pod, a later credential of the same
+// registry wins. Plugins could add credentials before images are pulled.
+func AddRegistryAuth(auth RegistryAuth) error {
+	if auth.Registry == "" || auth.Username == "" {
+		return errors.New("registry and username of registry credential are required")
+	}
+	redact.AddValue(auth.Password)
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	if registryAuth.config.Auths == nil {
+		registryAuth.config.Auths = make(map[string]dockerAuth)
+	}
+	registryAuth.config.Auths[auth.Registry] = dockerAuth{
+		Auth: base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+	}
+	return nil
+}
+
+// AddDockerConfig merges registry credentials in a docker config file supplied by task, such as
+// ~/.docker/config.json, into docker config of pod. credHelpers are dropped, since they run binaries on the agent
+// as the executor.
+func AddDockerConfig(data []byte) error {
+	var c dockerConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return errors.Wrap(err, "invalid docker config")
+	}
+	if len(c.CredHelpers) > 0 {
+		registries := make([]string, 0, len(c.CredHelpers))
+		for registry := range c.CredHelpers {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+		log.Warnf("Ignore credHelpers of %v in docker config of task", registries)
+	}
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	if registryAuth.config.Auths == nil {
+		registryAuth.config.Auths = make(map[string]dockerAuth)
+	}
+	for registry, auth := range c.Auths {
+		redact.AddValue(auth.Auth)
+		redact.AddValue(auth.IdentityToken)
+		registryAuth.config.Auths[registry] = auth
+	}
+	return nil
+}
+
+// WriteDockerConfig writes registry credentials of pod into a docker config dir per task in registryauth.dir,
+// which should be a tmpfs outside the sandbox, and is used by docker and compose to pull images through
+// DOCKER_CONFIG. Credentials come from registryauth section of config, a docker config file in sandbox fetched as
+// mesos uri named by label dce.registry.auth.file, and those added by plugins, such as the docker config in secret
+// referenced by label dce.registry.auth.secret. Credentials of docker on the agent are used as before if there
+// isn't any.
+func WriteDockerConfig(taskInfo *mesos.TaskInfo) error {
+	log.Println("====================Write Docker Config====================")
+
+	for _, auth := range config.GetRegistryAuths() {
+		if err := AddRegistryAuth(RegistryAuth{
+			Registry: auth[config.REGISTRY],
+			Username: auth[config.USERNAME],
+			Password: auth[config.PASSWORD],
+		}); err != nil {
+			return errors.Wrapf(err, "invalid %s in config", config.REGISTRY_AUTH_REGISTRIES)
+		}
+	}
+
+	if file := GetLabel(types.REGISTRY_FILE_LABEL, taskInfo); file != "" {
+		if err := checkSandboxPath(file); err != nil {
+			return errors.Wrapf(err, "invalid label %s", types.REGISTRY_FILE_LABEL)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read docker config %s fetched from uri", file)
+		}
+		if err = AddDockerConfig(data); err != nil {
+			return errors.Wrapf(err, "failed to load %s", file)
+		}
+	}
+
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	if len(registryAuth.config.Auths) == 0 {
+		log.Println("No registry credential is provided, use docker config of agent")
+		return nil
+	}
+
+	dir, err := filepath.Abs(filepath.Join(config.GetRegistryAuthDir(),
+		DOCKER_CONFIG_DIR_PREFIX+taskInfo.GetTaskId().GetValue()))
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create docker config dir %s", dir)
+	}
+	data, err := json.MarshalIndent(registryAuth.config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, DOCKER_CONFIG_FILE), data, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write docker config into %s", dir)
+	}
+	registryAuth.dir = dir
+
+	registries := make([]string, 0, len(registryAuth.config.Auths))
+	for registry := range registryAuth.config.Auths {
+		registries = append(registries, registry)
+	}
+	log.Printf("Docker config with credentials of %v is written into %s", registries, dir)
+	return nil
+}
+
+// GetDockerConfig returns the docker config dir of pod, it's empty if registry credentials aren't provided
+func GetDockerConfig() string {
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	return registryAuth.dir
+}
+
+// RemoveDockerConfig removes docker config of pod, so that credentials don't outlive the pod
+func RemoveDockerConfig() {
+	registryAuth.Lock()
+	defer registryAuth.Unlock()
+	if registryAuth.dir == "" {
+		return
+	}
+	if err := os.RemoveAll(registryAuth.dir); err != nil {
+		log.Errorf("Error removing docker config %s : %v", registryAuth.dir, err)
+	}
+	registryAuth.dir = ""
+}
+
+// dockerConfigEnv returns environment of commands pulling images, DOCKER_CONFIG is set if pod has its own
+// docker config
+func dockerConfigEnv(env []string) []string {
+	if dir := GetDockerConfig(); dir != "" {
+		env = append(env, DOCKER_CONFIG+"="+dir)
+	}
+	return env
+}
+
+// checkSandboxPath checks that file is inside the sandbox, which is the working dir of executor, after symlinks
+// are followed
+func checkSandboxPath(file string) error {
+	sandbox, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if sandbox, err = filepath.EvalSymlinks(sandbox); err != nil {
+		return err
+	}
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if rel, err := filepath.Rel(sandbox, path); err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Errorf("%s is out of sandbox", file)
+	}
+	return nil
+}
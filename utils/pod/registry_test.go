@@ -0,0 +1,102 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDockerConfig(t *testing.T) {
+	resetRegistryAuth := func() {
+		registryAuth.Lock()
+		registryAuth.config = dockerConfig{}
+		registryAuth.dir = ""
+		registryAuth.Unlock()
+		config.GetConfig().Set(config.REGISTRY_AUTH_REGISTRIES, nil)
+	}
+	resetRegistryAuth()
+	defer resetRegistryAuth()
+
+	tmp := t.TempDir()
+	config.GetConfig().Set(config.REGISTRY_AUTH_DIR, tmp)
+	defer config.GetConfig().Set(config.REGISTRY_AUTH_DIR, "/dev/shm")
+	dir := filepath.Join(tmp, DOCKER_CONFIG_DIR_PREFIX+"task-1")
+
+	// docker config from uri is fetched into sandbox
+	sandbox := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(sandbox))
+	defer os.Chdir(wd)
+
+	assert.NoError(t, WriteDockerConfig(&mesos.TaskInfo{}))
+	assert.Empty(t, GetDockerConfig(), "docker config of agent should be used without credentials")
+	assert.Equal(t, []string{"A=1"}, dockerConfigEnv([]string{"A=1"}))
+
+	config.GetConfig().Set(config.REGISTRY_AUTH_REGISTRIES, []interface{}{
+		map[interface{}]interface{}{"registry": "registry.example.com", "username": "team", "password": "s3cret"},
+	})
+	uri := filepath.Join(sandbox, "docker.json")
+	assert.NoError(t, ioutil.WriteFile(uri, []byte(`{"auths":{"quay.io":{"auth":"cXVheTpwYXNz"}},`+
+		`"credHelpers":{"gcr.io":"gcloud"}}`), 0600))
+	key, value := types.REGISTRY_FILE_LABEL, uri
+	taskId := "task-1"
+	taskInfo := &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: &taskId},
+		Labels: &mesos.Labels{Labels: []*mesos.Label{{Key: &key, Value: &value}}}}
+	assert.NoError(t, AddRegistryAuth(RegistryAuth{Registry: "quay.io", Username: "old", Password: "old"}))
+
+	assert.NoError(t, WriteDockerConfig(taskInfo))
+	assert.Equal(t, dir, GetDockerConfig())
+	assert.Equal(t, []string{"A=1", "DOCKER_CONFIG=" + dir}, dockerConfigEnv([]string{"A=1"}))
+
+	info, err := os.Stat(filepath.Join(dir, DOCKER_CONFIG_FILE))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := ioutil.ReadFile(filepath.Join(dir, DOCKER_CONFIG_FILE))
+	assert.NoError(t, err)
+	var written dockerConfig
+	assert.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, dockerConfig{
+		Auths: map[string]dockerAuth{
+			"registry.example.com": {Auth: "dGVhbTpzM2NyZXQ="},
+			"quay.io":              {Auth: "cXVheTpwYXNz"},
+		},
+	}, written, "credential in uri file should override the earlier one, and credHelpers should be dropped")
+
+	RemoveDockerConfig()
+	assert.Empty(t, GetDockerConfig())
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	value = filepath.Join(sandbox, "missing.json")
+	assert.Error(t, WriteDockerConfig(taskInfo), "missing docker config from uri should fail")
+	value = filepath.Join(tmp, "docker.json")
+	assert.NoError(t, ioutil.WriteFile(value, []byte(`{"auths":{}}`), 0600))
+	assert.EqualError(t, WriteDockerConfig(taskInfo), "invalid label dce.registry.auth.file: "+value+
+		" is out of sandbox")
+	assert.NoError(t, os.Symlink(value, filepath.Join(sandbox, "link.json")))
+	value = "link.json"
+	assert.Error(t, WriteDockerConfig(taskInfo), "symlink out of sandbox should be rejected")
+	assert.Error(t, AddRegistryAuth(RegistryAuth{Registry: "quay.io"}), "username should be required")
+}
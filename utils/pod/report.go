@@ -0,0 +1,203 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LAUNCH_REPORT_JSON = "launch-report.json"
+	LAUNCH_REPORT_XML  = "launch-report.xml"
+)
+
+// LaunchReport is written into app folder once pod reaches a terminal status
+type LaunchReport struct {
+	TaskId   string             `json:"taskId"`
+	Status   string             `json:"status"`
+	Launched bool               `json:"launched"`
+	Failure  *types.TaskFailure `json:"failure,omitempty"`
+	Steps    []ReportStep       `json:"steps"`
+	Images   []ImagePull        `json:"images,omitempty"`
+}
+
+// ReportStep is a single attempt of a dce step
+type ReportStep struct {
+	StepName   string            `json:"stepName"`
+	RetryID    int               `json:"retryID"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	StartTime  int64             `json:"startTime"`
+	EndTime    int64             `json:"endTime,omitempty"`
+	ExecTimeMS int64             `json:"execTimeMS"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Testcases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// IsTerminal checks whether pod won't change status any more
+func IsTerminal(status types.PodStatus) bool {
+	switch status {
+	case types.POD_FAILED, types.POD_KILLED, types.POD_FINISHED, types.POD_PULL_FAILED, types.POD_COMPOSE_CHECK_FAILED,
+		types.POD_ADMISSION_DENIED:
+		return true
+	}
+	return false
+}
+
+// NewLaunchReport flattens StepMetrics into a launch report, steps are sorted by start time.
+// Failure and step errors are redacted, since they could have credentials printed by containers
+func NewLaunchReport(status types.PodStatus) LaunchReport {
+	CurPodStatus.RLock()
+	launched := CurPodStatus.Launched
+	CurPodStatus.RUnlock()
+
+	failure := GetTaskFailure()
+	if failure != nil {
+		*failure = redactFailure(*failure)
+	}
+	report := LaunchReport{
+		TaskId:   ComposeTaskInfo.GetTaskId().GetValue(),
+		Status:   status.String(),
+		Launched: launched,
+		Failure:  failure,
+		Steps:    []ReportStep{},
+		Images:   GetImagePulls(),
+	}
+	for _, steps := range GetStepMetrics() {
+		for _, step := range steps {
+			s := ReportStep{
+				StepName:   step.StepName,
+				RetryID:    step.RetryID,
+				Status:     step.Status,
+				Tags:       step.Tags,
+				StartTime:  step.StartTime,
+				EndTime:    step.EndTime,
+				ExecTimeMS: step.ExecTimeMS,
+			}
+			if step.ErrorMsg != nil {
+				s.Error = redact.Text(step.ErrorMsg.Error())
+			}
+			report.Steps = append(report.Steps, s)
+		}
+	}
+	sort.SliceStable(report.Steps, func(i, j int) bool {
+		if report.Steps[i].StartTime != report.Steps[j].StartTime {
+			return report.Steps[i].StartTime < report.Steps[j].StartTime
+		}
+		if report.Steps[i].StepName != report.Steps[j].StepName {
+			return report.Steps[i].StepName < report.Steps[j].StepName
+		}
+		return report.Steps[i].RetryID < report.Steps[j].RetryID
+	})
+	return report
+}
+
+// JUnit converts launch report into junit style xml, each step attempt is a test case
+func (r LaunchReport) JUnit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:  fmt.Sprintf("dce-launch-%s", r.TaskId),
+		Tests: len(r.Steps),
+	}
+	var total int64
+	for _, step := range r.Steps {
+		total += step.ExecTimeMS
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("%s#%d", step.StepName, step.RetryID),
+			Classname: "dce",
+			Time:      fmt.Sprintf("%.3f", float64(step.ExecTimeMS)/1000),
+		}
+		if step.Status != "Success" {
+			suite.Failures++
+			message := step.Error
+			if message == "" {
+				message = fmt.Sprintf("step status %s", step.Status)
+			}
+			tc.Failure = &junitFailure{Message: message, Text: fmt.Sprintf("tags: %v", step.Tags)}
+		}
+		suite.Testcases = append(suite.Testcases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", float64(total)/1000)
+
+	body, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// WriteLaunchReport writes launch report as json, and optionally junit xml, into app folder
+func WriteLaunchReport(status types.PodStatus) error {
+	if !config.EnableLaunchReport() || config.GetConfig().GetBool(types.NO_FOLDER) {
+		return nil
+	}
+
+	folder := config.GetAppFolder()
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create app folder %s", folder)
+	}
+
+	report := NewLaunchReport(status)
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal launch report")
+	}
+	if err = ioutil.WriteFile(filepath.Join(folder, LAUNCH_REPORT_JSON), body, 0644); err != nil {
+		return errors.Wrap(err, "failed to write launch report")
+	}
+
+	if config.EnableJUnitLaunchReport() {
+		body, err = report.JUnit()
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal junit launch report")
+		}
+		if err = ioutil.WriteFile(filepath.Join(folder, LAUNCH_REPORT_XML), body, 0644); err != nil {
+			return errors.Wrap(err, "failed to write junit launch report")
+		}
+	}
+	log.Printf("Launch report of pod status %s is written into %s", status, folder)
+	return nil
+}
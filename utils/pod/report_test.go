@@ -0,0 +1,108 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/redact"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLaunchReport(t *testing.T) {
+	folder := t.TempDir()
+	config.GetConfig().Set(config.FOLDER_NAME, folder)
+	config.GetConfig().Set(config.LAUNCH_REPORT, true)
+	config.GetConfig().Set(config.LAUNCH_REPORT_JUNIT, true)
+	steps := StepMetrics
+	StepMetrics = make(map[string][]*types.StepData)
+	defer func() {
+		StepMetrics = steps
+		config.GetConfig().Set(config.FOLDER_NAME, "")
+		config.GetConfig().Set(config.LAUNCH_REPORT_JUNIT, false)
+		SetPodStatus(types.POD_STAGING)
+	}()
+
+	StartStep(StepMetrics, "Image_Pull")
+	EndStep(StepMetrics, "Image_Pull", nil, errors.New("pull timeout"))
+	StartStep(StepMetrics, "Image_Pull")
+	EndStep(StepMetrics, "Image_Pull", nil, nil)
+	StartStep(StepMetrics, "HealthCheck-redis")
+	EndStep(StepMetrics, "HealthCheck-redis", map[string]string{"healthStatus": "unhealthy"}, nil)
+	// steps are sorted by start time
+	StepMetrics["HealthCheck-redis"][0].StartTime = 1
+	StepMetrics["Image_Pull"][0].StartTime = 2
+	StepMetrics["Image_Pull"][1].StartTime = 2
+
+	SetPodStatus(types.POD_FAILED)
+	_, err := ioutil.ReadFile(filepath.Join(folder, LAUNCH_REPORT_JSON))
+	assert.Error(t, err, "report shouldn't be written by setting pod status")
+
+	assert.NoError(t, WriteLaunchReport(types.POD_FAILED))
+	body, err := ioutil.ReadFile(filepath.Join(folder, LAUNCH_REPORT_JSON))
+	assert.NoError(t, err)
+	var report LaunchReport
+	assert.NoError(t, json.Unmarshal(body, &report))
+	assert.Equal(t, "POD_FAILED", report.Status)
+	assert.Len(t, report.Steps, 3)
+	assert.Equal(t, "HealthCheck-redis", report.Steps[0].StepName)
+	assert.Equal(t, "Error", report.Steps[0].Status)
+	assert.Equal(t, ReportStep{StepName: "Image_Pull", RetryID: 0, Status: "Error", Error: "pull timeout",
+		StartTime: report.Steps[1].StartTime, EndTime: report.Steps[1].EndTime}, report.Steps[1])
+	assert.Equal(t, 1, report.Steps[2].RetryID)
+	assert.Equal(t, "Success", report.Steps[2].Status)
+
+	body, err = ioutil.ReadFile(filepath.Join(folder, LAUNCH_REPORT_XML))
+	assert.NoError(t, err)
+	var suite junitTestSuite
+	assert.NoError(t, xml.Unmarshal(body, &suite))
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, "Image_Pull#0", suite.Testcases[1].Name)
+	assert.Equal(t, "pull timeout", suite.Testcases[1].Failure.Message)
+	assert.Nil(t, suite.Testcases[2].Failure)
+}
+
+func TestNewLaunchReportRedacted(t *testing.T) {
+	steps := StepMetrics
+	StepMetrics = make(map[string][]*types.StepData)
+	resetTaskFailure()
+	defer func() {
+		StepMetrics = steps
+		resetTaskFailure()
+	}()
+
+	redact.AddValue("r3p0-t0k3n")
+	StartStep(StepMetrics, "Image_Pull")
+	EndStep(StepMetrics, "Image_Pull", nil, errors.New("failed to login with r3p0-t0k3n"))
+	SetTaskFailure(types.TaskFailure{Reason: types.FAILURE_IMAGE_PULL, Message: "pull failed with r3p0-t0k3n",
+		HealthOutput: "token r3p0-t0k3n is rejected"})
+
+	report := NewLaunchReport(types.POD_PULL_FAILED)
+	assert.Equal(t, "pull failed with "+redact.MASK, report.Failure.Message)
+	assert.Equal(t, "token "+redact.MASK+" is rejected", report.Failure.HealthOutput)
+	assert.Equal(t, "failed to login with "+redact.MASK, report.Steps[0].Error)
+	body, err := report.JUnit()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "r3p0-t0k3n", "sensitive values shouldn't be written into sandbox")
+	assert.Equal(t, "pull failed with r3p0-t0k3n", GetTaskFailure().Message, "task failure shouldn't be modified")
+}
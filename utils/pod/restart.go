@@ -0,0 +1,211 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// serviceRestart tracks restarts of a service done by executor
+type serviceRestart struct {
+	policy     types.RestartPolicy
+	count      int
+	restarting bool
+}
+
+var restarts = struct {
+	sync.Mutex
+	services map[string]*serviceRestart
+}{services: make(map[string]*serviceRestart)}
+
+// ParseRestartPolicy parses restart value of a service in compose file,
+// e.g. "no", "always", "unless-stopped", "on-failure" or "on-failure:3",
+// or deploy.restart_policy of compose v3 such as {condition: on-failure, max_attempts: 3}
+func ParseRestartPolicy(restart interface{}) (types.RestartPolicy, error) {
+	var value string
+	switch v := restart.(type) {
+	case string:
+		value = strings.TrimSpace(v)
+	case map[interface{}]interface{}:
+		return parseDeployRestartPolicy(v)
+	case bool:
+		// restart: no is unmarshalled as false
+		if v {
+			return types.RestartPolicy{}, errors.Errorf("invalid restart policy %v", v)
+		}
+		value = types.RESTART_NO
+	case nil:
+		value = types.RESTART_NO
+	default:
+		return types.RestartPolicy{}, errors.Errorf("invalid restart policy %v", v)
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	switch parts[0] {
+	case "", types.RESTART_NO:
+		return types.RestartPolicy{Condition: types.RESTART_NO}, nil
+	case types.RESTART_ALWAYS, types.RESTART_UNLESS_STOPPED:
+		return types.RestartPolicy{Condition: types.RESTART_ALWAYS}, nil
+	case types.RESTART_ON_FAILURE:
+		policy := types.RestartPolicy{Condition: types.RESTART_ON_FAILURE}
+		if len(parts) == 2 {
+			maxRetries, err := strconv.Atoi(parts[1])
+			if err != nil || maxRetries < 0 {
+				return types.RestartPolicy{}, errors.Errorf("invalid max retries of restart policy %s", value)
+			}
+			policy.MaxRetries = maxRetries
+		}
+		return policy, nil
+	}
+	return types.RestartPolicy{}, errors.Errorf("invalid restart policy %s", value)
+}
+
+// parseDeployRestartPolicy parses deploy.restart_policy, condition is one of none, on-failure and any
+func parseDeployRestartPolicy(restart map[interface{}]interface{}) (types.RestartPolicy, error) {
+	var policy types.RestartPolicy
+	switch condition := restart["condition"]; condition {
+	case "none":
+		policy.Condition = types.RESTART_NO
+	case nil, "any":
+		policy.Condition = types.RESTART_ALWAYS
+	case types.RESTART_ON_FAILURE:
+		policy.Condition = types.RESTART_ON_FAILURE
+	default:
+		return types.RestartPolicy{}, errors.Errorf("invalid condition of restart policy %v", condition)
+	}
+	if maxAttempts, ok := restart["max_attempts"]; ok {
+		n, ok := maxAttempts.(int)
+		if !ok || n < 0 {
+			return types.RestartPolicy{}, errors.Errorf("invalid max attempts of restart policy %v", maxAttempts)
+		}
+		policy.MaxRetries = n
+	}
+	return policy, nil
+}
+
+// SetRestartPolicy sets restart policy of a service, restart count is reset
+func SetRestartPolicy(service string, policy types.RestartPolicy) {
+	restarts.Lock()
+	defer restarts.Unlock()
+
+	if policy.Condition == types.RESTART_NO {
+		delete(restarts.services, service)
+		return
+	}
+	restarts.services[service] = &serviceRestart{policy: policy}
+}
+
+// GetRestartCount returns restart count and restart policy of a service, false if service has no restart policy
+func GetRestartCount(service string) (int, types.RestartPolicy, bool) {
+	restarts.Lock()
+	defer restarts.Unlock()
+
+	r, ok := restarts.services[service]
+	if !ok {
+		return 0, types.RestartPolicy{}, false
+	}
+	return r.count, r.policy, true
+}
+
+// RestartOnExit restarts the service of an exited container if it's allowed by restart policy.
+// Service is restarted after a backoff, in the background. It returns true if service is restarting,
+// otherwise the exit should be handled by caller.
+func RestartOnExit(svcContainer types.SvcContainer, exitCode int) bool {
+	logger := log.WithFields(log.Fields{
+		"service": svcContainer.ServiceName,
+		"func":    "pod.RestartOnExit",
+	})
+
+	// Services aren't restarted once pod is being killed or has reached a terminal status
+	if IsTerminal(GetPodStatus()) {
+		return false
+	}
+
+	restarts.Lock()
+	defer restarts.Unlock()
+
+	r, ok := restarts.services[svcContainer.ServiceName]
+	if !ok {
+		return false
+	}
+	if r.restarting {
+		return true
+	}
+	if r.policy.Condition == types.RESTART_ON_FAILURE && exitCode == 0 {
+		return false
+	}
+	if r.policy.MaxRetries > 0 && r.count >= r.policy.MaxRetries {
+		logger.Errorf("Service exited with code %d and exhausted max retries %d of restart policy",
+			exitCode, r.policy.MaxRetries)
+		return false
+	}
+
+	r.count++
+	metrics.ContainerRestarts.WithLabelValues(svcContainer.ServiceName).Inc()
+	r.restarting = true
+	backoff := restartBackoff(r.count)
+	logger.Printf("Service exited with code %d, restart(%d) in %v", exitCode, r.count, backoff)
+
+	go func() {
+		time.Sleep(backoff)
+		if status := GetPodStatus(); IsTerminal(status) {
+			logger.Printf("Skip restarting service since pod status is %s", status)
+		} else if err := GetRuntime().Restart(ComposeFiles, svcContainer.ServiceName); err != nil {
+			// Container is still exited and will be handled by next check
+			logger.Errorf("Error restarting service: %v", err)
+		}
+
+		restarts.Lock()
+		r.restarting = false
+		restarts.Unlock()
+	}()
+	return true
+}
+
+// restartBackoff doubles for each restart, and is capped by maximum backoff in config
+func restartBackoff(count int) time.Duration {
+	backoff := config.GetRestartBackoff()
+	max := config.GetMaxRestartBackoff()
+	for i := 1; i < count && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// updateRestartCount populates restart count in container details from restart policy of its service
+func updateRestartCount(details *types.ContainerStatusDetails) {
+	for _, c := range MonitorContainerList {
+		if c.ContainerId != details.ContainerId {
+			continue
+		}
+		if count, policy, ok := GetRestartCount(c.ServiceName); ok {
+			details.RestartCount = count
+			details.MaxRetryCount = policy.MaxRetries
+		}
+		return
+	}
+}
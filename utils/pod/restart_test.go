@@ -0,0 +1,206 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	testCases := []struct {
+		restart  interface{}
+		expected types.RestartPolicy
+		err      bool
+	}{
+		{"no", types.RestartPolicy{Condition: types.RESTART_NO}, false},
+		{false, types.RestartPolicy{Condition: types.RESTART_NO}, false},
+		{"always", types.RestartPolicy{Condition: types.RESTART_ALWAYS}, false},
+		{"unless-stopped", types.RestartPolicy{Condition: types.RESTART_ALWAYS}, false},
+		{"on-failure", types.RestartPolicy{Condition: types.RESTART_ON_FAILURE}, false},
+		{"on-failure:3", types.RestartPolicy{Condition: types.RESTART_ON_FAILURE, MaxRetries: 3}, false},
+		{"on-failure:x", types.RestartPolicy{}, true},
+		{"sometimes", types.RestartPolicy{}, true},
+		{true, types.RestartPolicy{}, true},
+		{map[interface{}]interface{}{"condition": "none"}, types.RestartPolicy{Condition: types.RESTART_NO}, false},
+		{map[interface{}]interface{}{}, types.RestartPolicy{Condition: types.RESTART_ALWAYS}, false},
+		{map[interface{}]interface{}{"condition": "on-failure", "max_attempts": 3},
+			types.RestartPolicy{Condition: types.RESTART_ON_FAILURE, MaxRetries: 3}, false},
+		{map[interface{}]interface{}{"condition": "sometimes"}, types.RestartPolicy{}, true},
+		{map[interface{}]interface{}{"max_attempts": "3"}, types.RestartPolicy{}, true},
+	}
+	for _, tc := range testCases {
+		policy, err := ParseRestartPolicy(tc.restart)
+		if tc.err {
+			assert.Error(t, err, "restart %v", tc.restart)
+			continue
+		}
+		assert.NoError(t, err, "restart %v", tc.restart)
+		assert.Equal(t, tc.expected, policy, "restart %v", tc.restart)
+	}
+}
+
+func TestRestartOnExit(t *testing.T) {
+	f := useFakeRuntime(t)
+	config.GetConfig().Set(config.RESTART_BACKOFF, "1ms")
+	config.GetConfig().Set(config.MAX_RESTART_BACKOFF, "2ms")
+	defer func() {
+		MonitorContainerList = nil
+		SetRestartPolicy("redis", types.RestartPolicy{Condition: types.RESTART_NO})
+		SetRestartPolicy("job", types.RestartPolicy{Condition: types.RESTART_NO})
+	}()
+
+	redis := types.SvcContainer{ServiceName: "redis", ContainerId: "id1"}
+	job := types.SvcContainer{ServiceName: "job", ContainerId: "id2"}
+	SetRestartPolicy("redis", types.RestartPolicy{Condition: types.RESTART_ON_FAILURE, MaxRetries: 2})
+	SetRestartPolicy("job", types.RestartPolicy{Condition: types.RESTART_ALWAYS})
+
+	waitRestarted := func(service string) {
+		select {
+		case s := <-f.restarted:
+			assert.Equal(t, service, s)
+		case <-time.After(time.Second):
+			t.Fatalf("service %s isn't restarted", service)
+		}
+		// wait until restart is done
+		for {
+			restarts.Lock()
+			restarting := restarts.services[service].restarting
+			restarts.Unlock()
+			if !restarting {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	assert.False(t, RestartOnExit(redis, 0), "on-failure policy shouldn't restart service exited with 0")
+	assert.True(t, RestartOnExit(redis, 1))
+	waitRestarted("redis")
+	assert.True(t, RestartOnExit(redis, 1))
+	waitRestarted("redis")
+	assert.False(t, RestartOnExit(redis, 1), "service should fail once max retries are exhausted")
+
+	assert.True(t, RestartOnExit(job, 0), "always policy should restart service exited with 0")
+	waitRestarted("job")
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.ContainerRestarts.WithLabelValues("redis")))
+
+	assert.False(t, RestartOnExit(types.SvcContainer{ServiceName: "fake"}, 1), "service without policy shouldn't restart")
+
+	f.containers["id1"] = types.ContainerStatusDetails{ExitCode: 1}
+	MonitorContainerList = []types.SvcContainer{redis}
+	details, err := InspectContainerDetails("id1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, details.RestartCount)
+	assert.Equal(t, 2, details.MaxRetryCount)
+
+	status, err := CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_FAILED, status)
+
+	f.containers["id2"] = types.ContainerStatusDetails{}
+	MonitorContainerList = []types.SvcContainer{job}
+	status, err = CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_EMPTY, status, "restarting service should keep pod running")
+	assert.Equal(t, []types.SvcContainer{job}, MonitorContainerList)
+	waitRestarted("job")
+}
+
+func TestRestartBackoff(t *testing.T) {
+	config.GetConfig().Set(config.RESTART_BACKOFF, "1s")
+	config.GetConfig().Set(config.MAX_RESTART_BACKOFF, "5s")
+	assert.Equal(t, time.Second, restartBackoff(1))
+	assert.Equal(t, 2*time.Second, restartBackoff(2))
+	assert.Equal(t, 4*time.Second, restartBackoff(3))
+	assert.Equal(t, 5*time.Second, restartBackoff(4))
+	assert.Equal(t, 5*time.Second, restartBackoff(100))
+}
+
+func TestRestartOnExitKilled(t *testing.T) {
+	f := useFakeRuntime(t)
+	config.GetConfig().Set(config.RESTART_BACKOFF, "50ms")
+	defer func() {
+		MonitorContainerList = nil
+		SetRestartPolicy("web", types.RestartPolicy{Condition: types.RESTART_NO})
+		SetPodStatus(types.POD_STAGING)
+	}()
+
+	web := types.SvcContainer{ServiceName: "web", ContainerId: "id1"}
+	SetRestartPolicy("web", types.RestartPolicy{Condition: types.RESTART_ALWAYS})
+	SetPodStatus(types.POD_RUNNING)
+	ctx := NewMonitorContext(context.Background())
+	assert.True(t, RestartOnExit(web, 1))
+
+	// Task is killed during backoff of restart
+	SetPodStatus(types.POD_KILLED)
+	StopMonitor()
+	assert.Error(t, ctx.Err(), "monitor should be stopped")
+	select {
+	case s := <-f.restarted:
+		t.Fatalf("service %s shouldn't be restarted once pod is killed", s)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	assert.False(t, RestartOnExit(web, 143), "service being stopped shouldn't be restarted")
+
+	f.containers["id1"] = types.ContainerStatusDetails{ExitCode: 143}
+	MonitorContainerList = []types.SvcContainer{web}
+	status, err := CheckPodStatus("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POD_KILLED, status, "containers being stopped shouldn't fail pod")
+	assert.Equal(t, []types.SvcContainer{web}, MonitorContainerList)
+}
+
+func TestHealthCheckInspectError(t *testing.T) {
+	f := useFakeRuntime(t)
+	config.GetConfig().Set(config.RESTART_BACKOFF, "1ms")
+	interval := config.GetConfig().Get(config.POD_MONITOR_INTERVAL)
+	config.GetConfig().Set(config.POD_MONITOR_INTERVAL, "1ms")
+	defer func() {
+		config.GetConfig().Set(config.POD_MONITOR_INTERVAL, interval)
+		MonitorContainerList = nil
+		SetRestartPolicy("web", types.RestartPolicy{Condition: types.RESTART_NO})
+	}()
+
+	f.services["web"] = "id1"
+	f.containers["id1"] = types.ContainerStatusDetails{IsRunning: true}
+	// container is inspected for its pid before health check
+	f.inspectErrAfter = map[string]int{"id1": 1}
+	SetRestartPolicy("web", types.RestartPolicy{Condition: types.RESTART_ALWAYS})
+	SetPodStatus(types.POD_STARTING)
+
+	out := make(chan string, 1)
+	go HealthCheck(nil, map[string]bool{"web": true}, out)
+	select {
+	case <-out:
+	case s := <-f.restarted:
+		t.Fatalf("service %s shouldn't be restarted if its container fails to be inspected", s)
+	case <-time.After(time.Second):
+		t.Fatal("health check should be done")
+	}
+	select {
+	case s := <-f.restarted:
+		t.Fatalf("service %s shouldn't be restarted if its container fails to be inspected", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,501 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	waitUtil "github.com/paypal/dce-go/utils/wait"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const CLI_RUNTIME = "cli"
+
+// cliRuntime runs pods by shelling out to compose and docker binaries
+type cliRuntime struct {
+	// composeBinary is the compose binary of the runtime, compose detected at launch is used if it's empty
+	composeBinary   string
+	containerBinary string
+	// noCompatibility is true if compose binary doesn't support --compatibility, deploy section is applied anyway
+	noCompatibility bool
+}
+
+// dockerEvent is the event message streamed by docker events, both from cli and engine api
+type dockerEvent struct {
+	Type   string
+	Action string
+	Actor  struct {
+		ID         string
+		Attributes map[string]string
+	}
+	Time int64 `json:"time"`
+}
+
+func (e *dockerEvent) toContainerEvent() types.ContainerEvent {
+	event := types.ContainerEvent{
+		ContainerId: e.Actor.ID,
+		Action:      e.Action,
+		Attributes:  e.Actor.Attributes,
+		Time:        e.Time,
+	}
+	// health status is part of action, e.g. "health_status: unhealthy"
+	if parts := strings.SplitN(e.Action, ":", 2); len(parts) == 2 {
+		event.Action = strings.TrimSpace(parts[0])
+		event.HealthStatus = strings.TrimSpace(parts[1])
+	}
+	if exitCode, ok := e.Actor.Attributes["exitCode"]; ok {
+		event.ExitCode, _ = strconv.Atoi(exitCode)
+	}
+	return event
+}
+
+func init() {
+	plugin.ContainerRuntimes.Register(&cliRuntime{
+		containerBinary: "docker",
+	}, CLI_RUNTIME)
+}
+
+// GetRuntime returns the container runtime set in config,
+// docker-compose cli runtime is returned if the configured runtime isn't registered
+func GetRuntime() plugin.ContainerRuntime {
+	name := config.GetContainerRuntime()
+	if name == "" {
+		name = CLI_RUNTIME
+	}
+	runtime := plugin.ContainerRuntimes.Lookup(name)
+	if runtime == nil {
+		log.Warnf("container runtime %s doesn't exist, using %s runtime", name, CLI_RUNTIME)
+		runtime = plugin.ContainerRuntimes.Lookup(CLI_RUNTIME)
+	}
+	return runtime
+}
+
+func (r *cliRuntime) Name() string {
+	return CLI_RUNTIME
+}
+
+// compose returns the compose cli used by the runtime
+func (r *cliRuntime) compose() *Compose {
+	if r.composeBinary != "" {
+		return &Compose{Command: []string{r.composeBinary}}
+	}
+	return GetCompose()
+}
+
+// composeDetector is implemented by runtimes which run pods by compose cli
+type composeDetector interface {
+	detectCompose() *Compose
+}
+
+// DetectRuntimeCompose detects compose cli of runtime and its version, it's nil if runtime doesn't run pods by
+// compose cli
+func DetectRuntimeCompose(runtime plugin.ContainerRuntime) *Compose {
+	if detector, ok := runtime.(composeDetector); ok {
+		return detector.detectCompose()
+	}
+	return nil
+}
+
+// detectCompose detects compose cli of the runtime and its version, docker compose is only detected if the runtime
+// doesn't have its own compose binary
+func (r *cliRuntime) detectCompose() *Compose {
+	if r.composeBinary == "" {
+		return DetectCompose()
+	}
+	compose := r.compose()
+	version, err := composeVersion(compose.Command)
+	if err != nil {
+		log.Warnf("Compose : unable to detect version of %s : %v", r.composeBinary, err)
+		return compose
+	}
+	compose.Version = strings.TrimPrefix(version, "v")
+	return compose
+}
+
+// cmdParts generates compose cmd parts with the flags supported by compose binary
+func (r *cliRuntime) cmdParts(files []string, cmd string) ([]string, error) {
+	parts, err := GenerateCmdParts(files, cmd)
+	if err != nil || !r.noCompatibility {
+		return parts, err
+	}
+	supported := parts[:0]
+	for _, part := range parts {
+		if part != "--compatibility" {
+			supported = append(supported, part)
+		}
+	}
+	return supported, nil
+}
+
+// docker-compose up -d
+func (r *cliRuntime) Up(files []string) error {
+	parts, err := r.cmdParts(files, " up -d")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	log.Printf("Launch Pod : Command to launch task : %v", cmd.Args)
+
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	cmd.Env = dockerConfigEnv(os.Environ())
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", types.COMPOSE_HTTP_TIMEOUT, config.GetComposeHttpTimeout()))
+
+	return cmd.Run()
+}
+
+// docker-compose restart service
+func (r *cliRuntime) Restart(files []string, service string) error {
+	parts, err := r.cmdParts(files, " restart "+service)
+	if err != nil {
+		log.Errorf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Restart Service : Command to restart service : %s", cmd.Args)
+
+	return cmd.Run()
+}
+
+// docker-compose stop -t
+func (r *cliRuntime) Stop(files []string, timeout int, services ...string) error {
+	subCmd := " stop -t " + strconv.Itoa(timeout)
+	if len(services) > 0 {
+		subCmd += " " + strings.Join(services, " ")
+	}
+	parts, err := r.cmdParts(files, subCmd)
+	if err != nil {
+		log.Errorf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Stop Pod : Command to stop task : %s", cmd.Args)
+
+	return cmd.Run()
+}
+
+// docker-compose down -v --rmi all
+func (r *cliRuntime) Down(files []string, removeVolumes bool, removeImages bool) error {
+	subCmd := " down"
+	if removeVolumes {
+		subCmd += " -v"
+	}
+	if removeImages {
+		subCmd += " --rmi all"
+	}
+	parts, err := r.cmdParts(files, subCmd)
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Down Pod : Command to remove pod : %s", cmd.Args)
+
+	return cmd.Run()
+}
+
+// docker-compose pull
+func (r *cliRuntime) Pull(files []string) error {
+	parts, err := r.cmdParts(files, " pull")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	cmd.Env = dockerConfigEnv(os.Environ())
+	log.Println("Pull Image : Command to pull images : ", cmd.Args)
+
+	err = cmd.Start()
+	if err != nil {
+		log.Printf("POD_PULL_IMAGE_FAIL	-- %v ", err)
+		return err
+	}
+
+	return waitUtil.WaitCmd(config.GetLaunchTimeout(), &types.CmdResult{
+		Command: cmd,
+	})
+}
+
+// docker pull
+func (r *cliRuntime) PullImage(ctx context.Context, image string) error {
+	cmd := exec.CommandContext(ctx, r.containerBinary, "pull", image)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	cmd.Env = dockerConfigEnv(os.Environ())
+	log.Printf("Pull Image : Command to pull image : %v", cmd.Args)
+	return cmd.Run()
+}
+
+// docker image inspect --format '{{json .RepoDigests}}'
+func (r *cliRuntime) ImageDigest(image string) (string, bool, error) {
+	out, err := exec.Command(r.containerBinary, "image", "inspect", "--format", "{{json .RepoDigests}}", image).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && isImageNotFound(string(exitErr.Stderr)) {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "failed to inspect image %s", image)
+	}
+	var digests []string
+	if err = json.Unmarshal(out, &digests); err != nil {
+		return "", true, errors.Wrapf(err, "failed to parse repo digests of image %s", image)
+	}
+	return RepoDigest(image, digests), true, nil
+}
+
+// isImageNotFound checks whether image inspect failed because image isn't present, by either docker or podman
+func isImageNotFound(stderr string) bool {
+	return strings.Contains(stderr, "No such image") || strings.Contains(stderr, "image not known")
+}
+
+// docker-compose config -q
+func (r *cliRuntime) Validate(files []string) error {
+	parts, err := r.cmdParts(files, " config -q")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Println("Validate compose : Command to validate manifest : ", cmd.Args)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	return waitUtil.WaitCmd(config.GetLaunchTimeout(), &types.CmdResult{
+		Command: cmd,
+	})
+}
+
+// docker-compose ps -q [service]
+// docker compose ps -a -q [service], stopped containers are listed by compose v2 only with -a
+func (r *cliRuntime) Ps(files []string, service string) ([]string, error) {
+	subCmd := " ps -q "
+	if r.compose().IsV2() {
+		subCmd = " ps -a -q "
+	}
+	parts, err := r.cmdParts(files, subCmd+service)
+	if err != nil {
+		log.Errorf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return nil, err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	log.Debugf("Command to get container ids: %s", cmd.Args)
+
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// docker-compose ps
+// docker compose ps -a --format json
+func (r *cliRuntime) Status(files []string) (string, error) {
+	compose := r.compose()
+	subCmd := " ps"
+	if compose.IsV2() {
+		subCmd = " ps -a --format json"
+	}
+	parts, err := r.cmdParts(files, subCmd)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), compose.Cmd(parts))
+	if err != nil || !compose.IsV2() {
+		return string(out), err
+	}
+	containers, err := ParseComposePs(out)
+	if err != nil {
+		return string(out), err
+	}
+	return formatComposePs(containers), nil
+}
+
+// docker inspect --format
+func (r *cliRuntime) Inspect(containerId string, healthcheck bool) (types.ContainerStatusDetails, error) {
+	format := "--format='{{.State.Pid}},{{.State.Running}},{{.State.ExitCode}},{{.RestartCount}},{{.HostConfig.RestartPolicy.MaximumRetryCount}},{{.Name}}'"
+	if healthcheck {
+		format = "--format='{{.State.Pid}},{{.State.Running}},{{.State.ExitCode}},{{.State.Health.Status}},{{.RestartCount}},{{.HostConfig.RestartPolicy.MaximumRetryCount}},{{.Name}}'"
+	}
+
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command(r.containerBinary, "inspect", format, containerId))
+	if err != nil {
+		return types.ContainerStatusDetails{}, err
+	}
+
+	return ParseToContainerDetail(strings.Trim(strings.TrimSpace(string(out[:])), "'"), healthcheck)
+}
+
+// docker inspect
+func (r *cliRuntime) InspectRaw(containerId string) ([]byte, error) {
+	return waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command(r.containerBinary, "inspect", containerId))
+}
+
+// docker inspect --format='{{if .State.Health }}{{.State.Health.Status}}{{ end }}'
+func (r *cliRuntime) HasHealthCheck(containerId string) (bool, error) {
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command(r.containerBinary, "inspect",
+		"--format='{{if .State.Health }}{{.State.Health.Status}}{{ end }}'", containerId))
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Replace(strings.TrimSuffix(string(out[:]), "\n"), "'", "", -1) != "", nil
+}
+
+// docker kill --signal
+func (r *cliRuntime) Kill(containerId string, sig string) error {
+	cmd := exec.Command(r.containerBinary, "kill", containerId)
+	if sig != "" {
+		cmd = exec.Command(r.containerBinary, "kill", fmt.Sprintf("--signal=%s", sig), containerId)
+	}
+	log.Printf("Command to kill container: %v", cmd.Args)
+
+	_, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
+	return err
+}
+
+// docker-compose logs -t --follow --no-color
+func (r *cliRuntime) Logs(files []string, retry bool) error {
+	parts, err := r.cmdParts(files, " logs -t --follow --no-color")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+	}
+
+	cmd := r.compose().Cmd(parts)
+	log.Printf("Command to print container log: %v", cmd.Args)
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	_, err = waitUtil.RetryCmdLogs(cmd, retry)
+	return err
+}
+
+// docker port
+func (r *cliRuntime) Port(containerId string, privatePort string) (string, error) {
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), exec.Command(r.containerBinary, "port", containerId, privatePort))
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Get Container Dynamic Port : %s", string(out))
+	if ports := strings.Split(string(out), PORT_SEPARATOR); len(ports) > 1 {
+		return strings.TrimSuffix(ports[1], "\n"), nil
+	}
+	return "", nil
+}
+
+// docker inspect --format='{{.HostConfig.NetworkMode}}'
+func (r *cliRuntime) ContainerNetwork(containerId string) (string, error) {
+	out, err := exec.Command(r.containerBinary, "inspect", "--format='{{.HostConfig.NetworkMode}}'", containerId).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(strings.TrimSuffix(string(out[:]), "\n"), "'", "", -1), nil
+}
+
+// docker network rm
+func (r *cliRuntime) RemoveNetwork(name string) error {
+	cmd := exec.Command(r.containerBinary, "network", "rm", name)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	return cmd.Run()
+}
+
+// docker events --format {{json .}} --filter
+func (r *cliRuntime) Events(ctx context.Context, labels map[string]string, actions []string) (<-chan types.ContainerEvent, <-chan error) {
+	events := make(chan types.ContainerEvent)
+	errs := make(chan error, 1)
+
+	args := []string{"events", "--format", "{{json .}}", "--filter", "type=container"}
+	for k, v := range labels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+	for _, action := range actions {
+		args = append(args, "--filter", "event="+action)
+	}
+	cmd := exec.CommandContext(ctx, r.containerBinary, args...)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Command to stream container events: %v", cmd.Args)
+
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		close(events)
+		errs <- err
+		return events, errs
+	}
+
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			var e dockerEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				log.Warnf("Error parsing container event %s: %v", scanner.Text(), err)
+				continue
+			}
+			select {
+			case events <- e.toContainerEvent():
+			case <-ctx.Done():
+			}
+		}
+		err := cmd.Wait()
+		if err == nil {
+			err = errors.New("container event stream ended")
+		}
+		errs <- err
+	}()
+	return events, errs
+}
@@ -0,0 +1,274 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	httpUtil "github.com/paypal/dce-go/utils/http"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DOCKER_API_RUNTIME = "docker-api"
+	// host part of request url is ignored since requests are always sent to the unix socket
+	dockerAPIHost = "http://docker"
+)
+
+// dockerAPIRuntime inspects and manages containers through docker engine api on the local unix socket,
+// instead of forking a docker process per request. Compose operations are still done by docker-compose cli.
+type dockerAPIRuntime struct {
+	*cliRuntime
+
+	sync.Mutex
+	socket    string
+	transport *http.Transport
+}
+
+// dockerContainer is the subset of docker engine api container inspect response used by executor
+type dockerContainer struct {
+	Name         string
+	RestartCount int
+	State        struct {
+		Pid      int
+		Running  bool
+		ExitCode int
+		Health   *struct {
+			Status string
+		}
+	}
+	HostConfig struct {
+		NetworkMode   string
+		RestartPolicy struct {
+			MaximumRetryCount int
+		}
+	}
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+	}
+}
+
+func init() {
+	plugin.ContainerRuntimes.Register(&dockerAPIRuntime{
+		cliRuntime: &cliRuntime{
+			containerBinary: "docker",
+		},
+	}, DOCKER_API_RUNTIME)
+}
+
+func (r *dockerAPIRuntime) Name() string {
+	return DOCKER_API_RUNTIME
+}
+
+// getTransport returns the transport bound to the docker socket in config,
+// transport is re-created if the socket is changed, e.g. config is overridden by task labels
+func (r *dockerAPIRuntime) getTransport() *http.Transport {
+	r.Lock()
+	defer r.Unlock()
+
+	socket := config.GetDockerSocket()
+	if r.transport == nil || r.socket != socket {
+		if r.transport != nil {
+			r.transport.CloseIdleConnections()
+		}
+		r.socket = socket
+		r.transport = httpUtil.UnixSocketTransport(socket)
+	}
+	return r.transport
+}
+
+// request sends a request to docker engine api, error is returned if response status isn't 2xx
+func (r *dockerAPIRuntime) request(method, path string) ([]byte, error) {
+	status, body, err := httpUtil.DoRequest(context.Background(), r.getTransport(), method, dockerAPIHost+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &apiErr)
+		return nil, errors.Errorf("docker api %s %s returned %d: %s", method, path, status, apiErr.Message)
+	}
+	return body, nil
+}
+
+func (r *dockerAPIRuntime) inspect(containerId string) (*dockerContainer, error) {
+	if containerId == "" {
+		return nil, errors.New("container ID can't be empty")
+	}
+	body, err := r.request(http.MethodGet, fmt.Sprintf("/containers/%s/json", url.PathEscape(containerId)))
+	if err != nil {
+		return nil, err
+	}
+	var c dockerContainer
+	if err = json.Unmarshal(body, &c); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal container inspect response")
+	}
+	return &c, nil
+}
+
+// GET /containers/{id}/json
+func (r *dockerAPIRuntime) Inspect(containerId string, healthcheck bool) (types.ContainerStatusDetails, error) {
+	c, err := r.inspect(containerId)
+	if err != nil {
+		return types.ContainerStatusDetails{}, err
+	}
+
+	details := types.ContainerStatusDetails{
+		Pid:           c.State.Pid,
+		IsRunning:     c.State.Running,
+		ExitCode:      c.State.ExitCode,
+		RestartCount:  c.RestartCount,
+		MaxRetryCount: c.HostConfig.RestartPolicy.MaximumRetryCount,
+		Name:          c.Name,
+	}
+	if healthcheck && c.State.Health != nil {
+		details.HealthStatus = c.State.Health.Status
+	}
+	return details, nil
+}
+
+// GET /events
+func (r *dockerAPIRuntime) Events(ctx context.Context, labels map[string]string, actions []string) (<-chan types.ContainerEvent, <-chan error) {
+	events := make(chan types.ContainerEvent)
+	errs := make(chan error, 1)
+
+	filters := map[string][]string{
+		"type":  {"container"},
+		"event": actions,
+	}
+	for k, v := range labels {
+		filters["label"] = append(filters["label"], fmt.Sprintf("%s=%s", k, v))
+	}
+	filtersJSON, _ := json.Marshal(filters)
+
+	// No client timeout since event stream is expected to be kept open
+	client := &http.Client{Transport: r.getTransport()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		dockerAPIHost+"/events?filters="+url.QueryEscape(string(filtersJSON)), nil)
+	if err != nil {
+		close(events)
+		errs <- err
+		return events, errs
+	}
+	log.Printf("Docker api to stream container events: GET %s", req.URL.Path)
+
+	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = errors.Errorf("docker api GET /events returned %d", resp.StatusCode)
+	}
+	if err != nil {
+		close(events)
+		errs <- err
+		return events, errs
+	}
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var e dockerEvent
+			if err := decoder.Decode(&e); err != nil {
+				if err == io.EOF {
+					err = errors.New("container event stream ended")
+				}
+				errs <- err
+				return
+			}
+			select {
+			case events <- e.toContainerEvent():
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return events, errs
+}
+
+// GET /containers/{id}/json
+func (r *dockerAPIRuntime) InspectRaw(containerId string) ([]byte, error) {
+	if containerId == "" {
+		return nil, errors.New("container ID can't be empty")
+	}
+	return r.request(http.MethodGet, fmt.Sprintf("/containers/%s/json", url.PathEscape(containerId)))
+}
+
+func (r *dockerAPIRuntime) HasHealthCheck(containerId string) (bool, error) {
+	c, err := r.inspect(containerId)
+	if err != nil {
+		return false, err
+	}
+	return c.State.Health != nil && c.State.Health.Status != "", nil
+}
+
+// POST /containers/{id}/kill
+func (r *dockerAPIRuntime) Kill(containerId string, sig string) error {
+	path := fmt.Sprintf("/containers/%s/kill", url.PathEscape(containerId))
+	if sig != "" {
+		path += "?signal=" + url.QueryEscape(sig)
+	}
+	log.Printf("Docker api to kill container: POST %s", path)
+	_, err := r.request(http.MethodPost, path)
+	return err
+}
+
+func (r *dockerAPIRuntime) Port(containerId string, privatePort string) (string, error) {
+	c, err := r.inspect(containerId)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(privatePort, "/") {
+		privatePort += "/tcp"
+	}
+	for _, binding := range c.NetworkSettings.Ports[privatePort] {
+		if binding.HostPort != "" {
+			log.Printf("Get Container Dynamic Port : %s", binding.HostPort)
+			return binding.HostPort, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *dockerAPIRuntime) ContainerNetwork(containerId string) (string, error) {
+	c, err := r.inspect(containerId)
+	if err != nil {
+		return "", err
+	}
+	return c.HostConfig.NetworkMode, nil
+}
+
+// DELETE /networks/{id}
+func (r *dockerAPIRuntime) RemoveNetwork(name string) error {
+	_, err := r.request(http.MethodDelete, fmt.Sprintf("/networks/%s", url.PathEscape(name)))
+	return err
+}
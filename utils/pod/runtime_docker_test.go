@@ -0,0 +1,177 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const inspectResponse = `{
+  "Name": "/taskId_redis",
+  "RestartCount": 2,
+  "State": {"Pid": 1234, "Running": true, "ExitCode": 0, "Health": {"Status": "healthy"}},
+  "HostConfig": {"NetworkMode": "taskId_default", "RestartPolicy": {"MaximumRetryCount": 3}},
+  "NetworkSettings": {"Ports": {"6379/tcp": [{"HostIp": "0.0.0.0", "HostPort": "31000"}]}}
+}`
+
+const eventsResponse = `{"Type":"container","Action":"health_status: unhealthy","Actor":{"ID":"redis","Attributes":{"taskId":"task1"}},"time":1}
+{"Type":"container","Action":"die","Actor":{"ID":"redis","Attributes":{"exitCode":"137","taskId":"task1"}},"time":2}
+`
+
+// startFakeDockerd serves a minimal docker engine api on a unix socket
+func startFakeDockerd(t *testing.T) map[string]string {
+	requests := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/redis/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(inspectResponse))
+	})
+	mux.HandleFunc("/containers/redis/kill", func(w http.ResponseWriter, r *http.Request) {
+		requests["kill"] = r.URL.Query().Get("signal")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/networks/taskId_default", func(w http.ResponseWriter, r *http.Request) {
+		requests["network"] = r.Method
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		requests["events"] = r.URL.Query().Get("filters")
+		w.Write([]byte(eventsResponse))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "No such container"}`))
+	})
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on unix socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = l
+	server.Start()
+
+	config.GetConfig().Set(config.DOCKER_SOCKET, socket)
+	config.GetConfig().Set(config.CONTAINER_RUNTIME, DOCKER_API_RUNTIME)
+	t.Cleanup(func() {
+		server.Close()
+		config.GetConfig().Set(config.CONTAINER_RUNTIME, CLI_RUNTIME)
+	})
+	return requests
+}
+
+func TestDockerAPIRuntime(t *testing.T) {
+	requests := startFakeDockerd(t)
+	r := plugin.ContainerRuntimes.Lookup(DOCKER_API_RUNTIME)
+	assert.Equal(t, DOCKER_API_RUNTIME, GetRuntime().Name())
+
+	t.Run("inspect", func(t *testing.T) {
+		details, err := r.Inspect("redis", true)
+		assert.NoError(t, err)
+		assert.Equal(t, types.ContainerStatusDetails{
+			Pid:           1234,
+			IsRunning:     true,
+			HealthStatus:  "healthy",
+			RestartCount:  2,
+			MaxRetryCount: 3,
+			Name:          "/taskId_redis",
+		}, details)
+
+		details, err = r.Inspect("redis", false)
+		assert.NoError(t, err)
+		assert.Equal(t, "", details.HealthStatus)
+
+		_, err = r.Inspect("fake", false)
+		assert.Error(t, err)
+
+		hc, err := r.HasHealthCheck("redis")
+		assert.NoError(t, err)
+		assert.True(t, hc)
+	})
+
+	t.Run("check container", func(t *testing.T) {
+		healthy, running, exitCode, err := CheckContainer("redis", true)
+		assert.NoError(t, err)
+		assert.Equal(t, types.HEALTHY, healthy)
+		assert.True(t, running)
+		assert.Equal(t, 0, exitCode)
+
+		pid, err := GetContainerPid("redis")
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", pid)
+	})
+
+	t.Run("network and ports", func(t *testing.T) {
+		network, err := r.ContainerNetwork("redis")
+		assert.NoError(t, err)
+		assert.Equal(t, "taskId_default", network)
+
+		port, err := r.Port("redis", "6379")
+		assert.NoError(t, err)
+		assert.Equal(t, "31000", port)
+
+		assert.NoError(t, r.RemoveNetwork("taskId_default"))
+		assert.Equal(t, http.MethodDelete, requests["network"])
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		assert.NoError(t, r.Kill("redis", "SIGTERM"))
+		assert.Equal(t, "SIGTERM", requests["kill"])
+		assert.Error(t, r.Kill("fake", "SIGTERM"))
+	})
+}
+
+func TestDockerAPIRuntimeEvents(t *testing.T) {
+	requests := startFakeDockerd(t)
+	source, ok := plugin.ContainerRuntimes.Lookup(DOCKER_API_RUNTIME).(plugin.ContainerEventSource)
+	assert.True(t, ok, "docker api runtime should support events")
+
+	events, errs := source.Events(context.Background(), map[string]string{types.TASK_ID_LABEL: "task1"},
+		[]string{types.CONTAINER_DIE, types.CONTAINER_HEALTH_STATUS})
+	var received []types.ContainerEvent
+	for e := range events {
+		received = append(received, e)
+	}
+	assert.Error(t, <-errs, "closed stream should be reported")
+	assert.JSONEq(t, `{"type":["container"],"event":["die","health_status"],"label":["taskId=task1"]}`,
+		requests["events"])
+
+	assert.Equal(t, []types.ContainerEvent{
+		{
+			ContainerId:  "redis",
+			Action:       types.CONTAINER_HEALTH_STATUS,
+			HealthStatus: "unhealthy",
+			Attributes:   map[string]string{"taskId": "task1"},
+			Time:         1,
+		},
+		{
+			ContainerId: "redis",
+			Action:      types.CONTAINER_DIE,
+			ExitCode:    137,
+			Attributes:  map[string]string{"exitCode": "137", "taskId": "task1"},
+			Time:        2,
+		},
+	}, received)
+}
@@ -0,0 +1,264 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	waitUtil "github.com/paypal/dce-go/utils/wait"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PODMAN_RUNTIME = "podman"
+	// COMPOSE_SERVICE_LABEL is the label of service name set by both docker-compose and podman-compose
+	COMPOSE_SERVICE_LABEL = "com.docker.compose.service"
+	PODMAN_DIED           = "died"
+)
+
+// podmanRuntime runs pods without docker daemon by shelling out to podman-compose and podman, which could be
+// rootless. Containers are discovered by labels of task, since ps of podman-compose doesn't list container ids.
+type podmanRuntime struct {
+	*cliRuntime
+}
+
+// podmanEvent is the event message streamed by podman events
+type podmanEvent struct {
+	ID                string
+	Status            string
+	Type              string
+	Attributes        map[string]string
+	ContainerExitCode int
+	HealthStatus      string
+	// Time is either a timestamp string or unix seconds depending on podman version
+	Time     json.RawMessage
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (e *podmanEvent) toContainerEvent() types.ContainerEvent {
+	event := types.ContainerEvent{
+		ContainerId:  e.ID,
+		Action:       e.Status,
+		Attributes:   e.Attributes,
+		HealthStatus: e.HealthStatus,
+		ExitCode:     e.ContainerExitCode,
+	}
+	// podman reports die of container as died
+	if event.Action == PODMAN_DIED {
+		event.Action = types.CONTAINER_DIE
+	}
+
+	var t time.Time
+	switch {
+	case e.TimeNano > 0:
+		event.Time = e.TimeNano / int64(time.Second)
+	case json.Unmarshal(e.Time, &event.Time) == nil:
+	case json.Unmarshal(e.Time, &t) == nil:
+		event.Time = t.Unix()
+	}
+	return event
+}
+
+func init() {
+	plugin.ContainerRuntimes.Register(&podmanRuntime{
+		cliRuntime: &cliRuntime{
+			composeBinary:   config.GetPodmanCompose(),
+			containerBinary: "podman",
+			noCompatibility: true,
+		},
+	}, PODMAN_RUNTIME)
+}
+
+func (r *podmanRuntime) Name() string {
+	return PODMAN_RUNTIME
+}
+
+// podman-compose down [-v], images are removed by podman since podman-compose doesn't support --rmi
+func (r *podmanRuntime) Down(files []string, removeVolumes bool, removeImages bool) error {
+	if err := r.cliRuntime.Down(files, removeVolumes, false); err != nil || !removeImages {
+		return err
+	}
+
+	images := composeImages(GetServiceDetail(), files)
+	if len(images) == 0 {
+		return nil
+	}
+	cmd := exec.Command(r.containerBinary, append([]string{"rmi", "--force"}, images...)...)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Down Pod : Command to remove images : %s", cmd.Args)
+	return cmd.Run()
+}
+
+// podman-compose config
+func (r *podmanRuntime) Validate(files []string) error {
+	parts, err := r.cmdParts(files, " config")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+		return err
+	}
+
+	cmd := r.compose().Cmd(parts)
+	cmd.Stdout = config.CreateFileAppendMode(types.DCE_OUT)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Println("Validate compose : Command to validate manifest : ", cmd.Args)
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	return waitUtil.WaitCmd(config.GetLaunchTimeout(), &types.CmdResult{
+		Command: cmd,
+	})
+}
+
+// podman ps -a -q --filter label=taskId=<task> [--filter label=com.docker.compose.service=<service>]
+// It falls back to podman-compose ps if task id isn't known yet.
+func (r *podmanRuntime) Ps(files []string, service string) ([]string, error) {
+	taskId := ComposeTaskInfo.GetTaskId().GetValue()
+	if taskId == "" {
+		return r.cliRuntime.Ps(files, service)
+	}
+
+	args := []string{"ps", "-a", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", types.TASK_ID_LABEL, taskId)}
+	if service != "" {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", COMPOSE_SERVICE_LABEL, service))
+	}
+	cmd := exec.Command(r.containerBinary, args...)
+	log.Debugf("Command to get container ids: %s", cmd.Args)
+
+	out, err := waitUtil.RetryCmd(config.GetMaxRetry(), cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(strings.NewReader(string(out[:])))
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// podman-compose logs -t --follow
+func (r *podmanRuntime) Logs(files []string, retry bool) error {
+	parts, err := r.cmdParts(files, " logs -t --follow")
+	if err != nil {
+		log.Printf("POD_GENERATE_COMPOSE_PARTS_FAIL -- %v", err)
+	}
+
+	cmd := r.compose().Cmd(parts)
+	log.Printf("Command to print container log: %v", cmd.Args)
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	_, err = waitUtil.RetryCmdLogs(cmd, retry)
+	return err
+}
+
+// podman events --format {{json .}} --filter, actions are filtered by executor since podman names them differently
+func (r *podmanRuntime) Events(ctx context.Context, labels map[string]string, actions []string) (<-chan types.ContainerEvent, <-chan error) {
+	events := make(chan types.ContainerEvent)
+	errs := make(chan error, 1)
+
+	args := []string{"events", "--format", "{{json .}}", "--filter", "type=container"}
+	for k, v := range labels {
+		args = append(args, "--filter", fmt.Sprintf("label=%s=%s", k, v))
+	}
+	wanted := make(map[string]bool)
+	for _, action := range actions {
+		wanted[action] = true
+	}
+	cmd := exec.CommandContext(ctx, r.containerBinary, args...)
+	cmd.Stderr = config.CreateFileAppendMode(types.DCE_ERR)
+	log.Printf("Command to stream container events: %v", cmd.Args)
+
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		close(events)
+		errs <- err
+		return events, errs
+	}
+
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			var e podmanEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				log.Warnf("Error parsing container event %s: %v", scanner.Text(), err)
+				continue
+			}
+			event := e.toContainerEvent()
+			if len(wanted) > 0 && !wanted[event.Action] {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+		err := cmd.Wait()
+		if err == nil {
+			err = errors.New("container event stream ended")
+		}
+		errs <- err
+	}()
+	return events, errs
+}
+
+// composeImages returns images of all the services in compose files, including images built by compose
+func composeImages(filesMap types.ServiceDetail, files []string) []string {
+	found := make(map[string]bool)
+	for _, file := range files {
+		servMap, ok := filesMap[file][types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for _, detail := range servMap {
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			if image, ok := containerDetails[types.IMAGE].(string); ok && image != "" {
+				found[image] = true
+			}
+		}
+	}
+	images := make([]string, 0, len(found))
+	for image := range found {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
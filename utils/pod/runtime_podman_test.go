@@ -0,0 +1,141 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePodman writes a script which records its args and prints output as podman does
+func fakePodman(t *testing.T, output string) (*podmanRuntime, string) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + args + "\ncat <<'EOF'\n" + output + "\nEOF\n"
+	binary := filepath.Join(dir, "podman")
+	assert.NoError(t, ioutil.WriteFile(binary, []byte(script), 0755))
+	return &podmanRuntime{cliRuntime: &cliRuntime{
+		composeBinary:   binary,
+		containerBinary: binary,
+		noCompatibility: true,
+	}}, args
+}
+
+func TestPodmanRuntimePs(t *testing.T) {
+	r, args := fakePodman(t, "abc\ndef")
+	taskId := "task-1"
+	ComposeTaskInfo = &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: &taskId}}
+	defer func() { ComposeTaskInfo = nil }()
+
+	ids, err := r.Ps(nil, "web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc", "def"}, ids)
+	out, err := ioutil.ReadFile(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "ps -a -q --no-trunc --filter label=taskId=task-1 --filter label=com.docker.compose.service=web\n",
+		string(out), "containers should be discovered by labels")
+}
+
+func TestPodmanRuntimeCmdParts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "docker-compose.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("services: {}"), 0644))
+	config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, true)
+	defer config.GetConfig().Set(types.COMPOSE_COMPATIBILITY, false)
+
+	r, _ := fakePodman(t, "")
+	parts, err := r.cmdParts([]string{file}, " up -d")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-f", file, "up", "-d"}, parts, "podman-compose doesn't support --compatibility")
+
+	parts, err = (&cliRuntime{}).cmdParts([]string{file}, " up -d")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-f", file, "--compatibility", "up", "-d"}, parts)
+}
+
+func TestPodmanRuntimeEvents(t *testing.T) {
+	r, args := fakePodman(t, `{"ID":"abc","Status":"start","Type":"container","Time":"2021-06-10T15:06:57.96+02:00"}
+{"ID":"abc","Status":"died","Type":"container","ContainerExitCode":137,"timeNano":1623330418000000000}
+{"ID":"abc","Status":"health_status","Type":"container","HealthStatus":"unhealthy","Time":1623330419}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := r.Events(ctx, map[string]string{types.TASK_ID_LABEL: "task-1"},
+		[]string{types.CONTAINER_DIE, types.CONTAINER_HEALTH_STATUS})
+
+	var received []types.ContainerEvent
+	for e := range events {
+		received = append(received, e)
+	}
+	assert.Error(t, <-errs, "event stream should end once podman exits")
+	assert.Equal(t, []types.ContainerEvent{
+		{ContainerId: "abc", Action: types.CONTAINER_DIE, ExitCode: 137, Time: 1623330418},
+		{ContainerId: "abc", Action: types.CONTAINER_HEALTH_STATUS, HealthStatus: "unhealthy", Time: 1623330419},
+	}, received, "died should be reported as die, and start should be filtered out")
+
+	out, err := ioutil.ReadFile(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "events --format {{json .}} --filter type=container --filter label=taskId=task-1\n", string(out))
+
+	e := podmanEvent{Status: "start", Time: []byte(`"2021-06-10T15:06:57.96+02:00"`)}
+	assert.Equal(t, int64(1623330417), e.toContainerEvent().Time)
+}
+
+func TestPodmanRuntimeDown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "docker-compose.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("services: {}"), 0644))
+	SetServiceDetail(types.ServiceDetail{file: {types.SERVICES: map[interface{}]interface{}{
+		"web": map[interface{}]interface{}{types.IMAGE: "web:1.0"},
+		"db":  map[interface{}]interface{}{types.IMAGE: "postgres"},
+		"app": map[interface{}]interface{}{"build": "."},
+	}}})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	r, args := fakePodman(t, "")
+	assert.NoError(t, r.Down([]string{file}, true, true))
+	out, err := ioutil.ReadFile(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "-f "+file+" down -v\nrmi --force postgres web:1.0\n", string(out),
+		"images should be removed by podman")
+}
+
+func TestDetectRuntimeCompose(t *testing.T) {
+	defer func(f func([]string) (string, error)) { composeVersion = f }(composeVersion)
+	detectedCompose = nil
+	defer func() { detectedCompose = nil }()
+
+	var detected []string
+	composeVersion = func(command []string) (string, error) {
+		detected = append(detected, strings.Join(command, " "))
+		return "1.0.6", nil
+	}
+
+	r := &podmanRuntime{cliRuntime: &cliRuntime{composeBinary: "podman-compose", containerBinary: "podman"}}
+	assert.Equal(t, "podman-compose (1.0.6)", DetectRuntimeCompose(r).String())
+	assert.Equal(t, []string{"podman-compose"}, detected, "docker compose shouldn't be detected with podman")
+	assert.Nil(t, detectedCompose)
+
+	detected = nil
+	assert.Equal(t, []string{"docker", "compose"}, DetectRuntimeCompose(&cliRuntime{}).Command)
+	assert.Equal(t, []string{"docker compose"}, detected)
+	assert.Nil(t, DetectRuntimeCompose(&fakeRuntime{}), "runtime without compose cli doesn't have compose")
+}
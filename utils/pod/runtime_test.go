@@ -0,0 +1,203 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/plugin"
+	"github.com/paypal/dce-go/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRuntime is an in-memory container runtime for unit test
+type fakeRuntime struct {
+	sync.Mutex
+	services   map[string]string
+	containers map[string]types.ContainerStatusDetails
+	killed     map[string]string
+	restarted  chan string
+	raw        map[string]string
+	stopped    []string
+	// inspectErrAfter fails inspecting a container once it's inspected the given times
+	inspectErrAfter map[string]int
+	inspects        map[string]int
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		services:   make(map[string]string),
+		containers: make(map[string]types.ContainerStatusDetails),
+		killed:     make(map[string]string),
+		restarted:  make(chan string, 10),
+		raw:        make(map[string]string),
+		inspects:   make(map[string]int),
+	}
+}
+
+func (f *fakeRuntime) Name() string                                                { return "fake" }
+func (f *fakeRuntime) Up(files []string) error                                     { return nil }
+func (f *fakeRuntime) Down(files []string, removeVolumes, removeImages bool) error { return nil }
+func (f *fakeRuntime) Pull(files []string) error                                   { return nil }
+func (f *fakeRuntime) Validate(files []string) error                               { return nil }
+func (f *fakeRuntime) Status(files []string) (string, error)                       { return "", nil }
+func (f *fakeRuntime) Logs(files []string, retry bool) error                       { return nil }
+func (f *fakeRuntime) Port(containerId, privatePort string) (string, error)        { return "", nil }
+func (f *fakeRuntime) ContainerNetwork(containerId string) (string, error)         { return "", nil }
+func (f *fakeRuntime) RemoveNetwork(name string) error                             { return nil }
+
+func (f *fakeRuntime) InspectRaw(containerId string) ([]byte, error) {
+	if raw, ok := f.raw[containerId]; ok {
+		return []byte(raw), nil
+	}
+	return []byte("{}"), nil
+}
+
+// Stop records services with timeout as service:timeout, in the order they are stopped
+func (f *fakeRuntime) Stop(files []string, timeout int, services ...string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.stopped = append(f.stopped, fmt.Sprintf("%s:%d", strings.Join(services, ","), timeout))
+	return nil
+}
+
+func (f *fakeRuntime) Restart(files []string, service string) error {
+	f.restarted <- service
+	return nil
+}
+
+func (f *fakeRuntime) Ps(files []string, service string) ([]string, error) {
+	if service != "" {
+		if id, ok := f.services[service]; ok {
+			return []string{id}, nil
+		}
+		return nil, nil
+	}
+	var ids []string
+	for _, id := range f.services {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (f *fakeRuntime) Inspect(containerId string, healthcheck bool) (types.ContainerStatusDetails, error) {
+	f.Lock()
+	f.inspects[containerId]++
+	inspects := f.inspects[containerId]
+	f.Unlock()
+	if n, ok := f.inspectErrAfter[containerId]; ok && inspects > n {
+		return types.ContainerStatusDetails{}, errors.Errorf("failed to inspect container %s", containerId)
+	}
+	detail, ok := f.containers[containerId]
+	if !ok {
+		return detail, errors.Errorf("no such container %s", containerId)
+	}
+	if !healthcheck {
+		detail.HealthStatus = ""
+	}
+	return detail, nil
+}
+
+func (f *fakeRuntime) HasHealthCheck(containerId string) (bool, error) {
+	return f.containers[containerId].HealthStatus != "", nil
+}
+
+func (f *fakeRuntime) Kill(containerId string, sig string) error {
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.containers[containerId]; !ok {
+		return errors.Errorf("no such container %s", containerId)
+	}
+	f.killed[containerId] = sig
+	return nil
+}
+
+func useFakeRuntime(t *testing.T) *fakeRuntime {
+	f := newFakeRuntime()
+	plugin.ContainerRuntimes.Unregister("fake")
+	plugin.ContainerRuntimes.Register(f, "fake")
+	config.GetConfig().Set(config.CONTAINER_RUNTIME, "fake")
+	t.Cleanup(func() {
+		config.GetConfig().Set(config.CONTAINER_RUNTIME, CLI_RUNTIME)
+	})
+	return f
+}
+
+func TestGetRuntime(t *testing.T) {
+	useFakeRuntime(t)
+	assert.Equal(t, "fake", GetRuntime().Name())
+
+	config.GetConfig().Set(config.CONTAINER_RUNTIME, "unknown")
+	assert.Equal(t, CLI_RUNTIME, GetRuntime().Name(), "unknown runtime should fall back to cli runtime")
+}
+
+func TestCheckContainerWithRuntime(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.containers["running"] = types.ContainerStatusDetails{IsRunning: true}
+	f.containers["healthy"] = types.ContainerStatusDetails{IsRunning: true, HealthStatus: "healthy"}
+	f.containers["failed"] = types.ContainerStatusDetails{ExitCode: 1}
+
+	healthy, running, exitCode, err := CheckContainer("running", false)
+	assert.NoError(t, err)
+	assert.Equal(t, types.HEALTHY, healthy)
+	assert.True(t, running)
+	assert.Equal(t, 0, exitCode)
+
+	healthy, _, _, err = CheckContainer("healthy", true)
+	assert.NoError(t, err)
+	assert.Equal(t, types.HEALTHY, healthy)
+
+	healthy, running, exitCode, err = CheckContainer("failed", false)
+	assert.NoError(t, err)
+	assert.Equal(t, types.UNHEALTHY, healthy)
+	assert.False(t, running)
+	assert.Equal(t, 1, exitCode)
+
+	healthy, _, _, err = CheckContainer("fake", false)
+	assert.Error(t, err)
+	assert.Equal(t, types.UNHEALTHY, healthy)
+}
+
+func TestGetServiceContainersWithRuntime(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.services["redis"] = "id1"
+	f.containers["id1"] = types.ContainerStatusDetails{Pid: 123, IsRunning: true}
+
+	containers, err := GetServiceContainers(nil, []string{"redis"})
+	assert.NoError(t, err)
+	assert.Equal(t, []types.SvcContainer{{ServiceName: "redis", ContainerId: "id1", Pid: "123"}}, containers)
+
+	_, err = GetServiceContainers(nil, []string{"fake"})
+	assert.Error(t, err, "service without container should fail")
+
+	hc, err := isHealthCheckConfigured("id1")
+	assert.NoError(t, err)
+	assert.False(t, hc)
+}
+
+func TestKillContainerWithRuntime(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.containers["id1"] = types.ContainerStatusDetails{IsRunning: true}
+
+	assert.NoError(t, KillContainer("SIGTERM", types.SvcContainer{ContainerId: "id1"}))
+	assert.Equal(t, "SIGTERM", f.killed["id1"], "runtime kill should be used if pid isn't cached")
+
+	assert.Error(t, KillContainer("SIGTERM", types.SvcContainer{ContainerId: "id2"}))
+}
@@ -0,0 +1,326 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/wait"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// field numbers of TaskInfo.kill_policy and KillPolicy.grace_period in mesos.proto
+	killPolicyField  = 12
+	gracePeriodField = 1
+)
+
+// ServiceStop describes how a service is stopped
+type ServiceStop struct {
+	Service string
+	// Signal is sent to the container before it's stopped, stop signal of compose is used if it's empty
+	Signal string
+	// Timeout is the seconds to wait before the container is killed
+	Timeout int
+}
+
+// GetKillGracePeriod returns grace period of kill policy in task info.
+// Kill policy isn't defined in TaskInfo of mesos-go v0, so it's decoded from unrecognized fields.
+func GetKillGracePeriod(taskInfo *mesos.TaskInfo) (time.Duration, bool) {
+	if taskInfo == nil {
+		return 0, false
+	}
+	killPolicy, ok := findField(taskInfo.XXX_unrecognized, killPolicyField)
+	if !ok {
+		return 0, false
+	}
+	gracePeriod, ok := findField(killPolicy, gracePeriodField)
+	if !ok {
+		return 0, false
+	}
+	var duration mesos.DurationInfo
+	if err := duration.Unmarshal(gracePeriod); err != nil {
+		log.Warnf("failed to decode grace period of kill policy: %v", err)
+		return 0, false
+	}
+	return time.Duration(duration.GetNanoseconds()), true
+}
+
+// findField returns the value of a length-delimited field in protobuf encoded data
+func findField(data []byte, field uint64) ([]byte, bool) {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, false
+		}
+		data = data[n:]
+
+		var size uint64
+		switch key & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return nil, false
+			}
+			size = uint64(n)
+		case 1: // 64-bit
+			size = 8
+		case 2: // length-delimited
+			l, n := binary.Uvarint(data)
+			if n <= 0 || l > uint64(len(data)-n) {
+				return nil, false
+			}
+			data = data[n:]
+			if key>>3 == field {
+				return data[:l], true
+			}
+			size = l
+		case 5: // 32-bit
+			size = 4
+		default:
+			return nil, false
+		}
+		if size > uint64(len(data)) {
+			return nil, false
+		}
+		data = data[size:]
+	}
+	return nil, false
+}
+
+// GetStopGracePeriod returns the seconds to wait for pod to stop.
+// Grace period of kill policy from scheduler takes priority over cleanpod.timeout.
+func GetStopGracePeriod() int {
+	if gracePeriod, ok := GetKillGracePeriod(ComposeTaskInfo); ok {
+		log.Printf("Use grace period %v from kill policy to stop pod", gracePeriod)
+		return int(gracePeriod.Seconds())
+	}
+	return config.GetStopTimeout()
+}
+
+// GetStopOrder groups services in compose files by the order they are stopped. A service is stopped before the
+// services it depends on, including the service whose network it joins, so infra container is stopped last.
+// Services in the same group are stopped together. Stop signal and timeout of a service could be overridden by
+// labels dce.stop.signal and dce.stop.timeout.
+func GetStopOrder(filesMap types.ServiceDetail, timeout int) ([][]ServiceStop, error) {
+	stops := make(map[string]*ServiceStop)
+	dependencies := make(map[string]map[string]bool)
+
+	for file, composeMap := range filesMap {
+		services, ok := composeMap[types.SERVICES].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for name, detail := range services {
+			service := fmt.Sprint(name)
+			if _, ok := stops[service]; !ok {
+				stops[service] = &ServiceStop{Service: service, Timeout: timeout}
+				dependencies[service] = make(map[string]bool)
+			}
+			containerDetails, ok := detail.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, dep := range serviceDependencies(containerDetails) {
+				dependencies[service][dep] = true
+			}
+
+			labels := ServiceLabels(containerDetails)
+			if sig, ok := labels[types.STOP_SIGNAL_LABEL]; ok {
+				stops[service].Signal = sig
+			}
+			if t, ok := labels[types.STOP_TIMEOUT_LABEL]; ok {
+				d, err := time.ParseDuration(t)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid label %s of service %s in %s",
+						types.STOP_TIMEOUT_LABEL, service, file)
+				}
+				stops[service].Timeout = int(d.Seconds())
+			}
+		}
+	}
+
+	// level of a service is the length of the longest path from the services depending on it
+	levels := make(map[string]int)
+	visiting := make(map[string]bool)
+	var visit func(service string) error
+	visit = func(service string) error {
+		if visiting[service] {
+			return errors.Errorf("circular dependency found on service %s", service)
+		}
+		visiting[service] = true
+		defer delete(visiting, service)
+
+		for dep := range dependencies[service] {
+			if _, ok := stops[dep]; !ok {
+				continue
+			}
+			if levels[dep] <= levels[service] {
+				levels[dep] = levels[service] + 1
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(stops))
+	for service := range stops {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+	for _, service := range names {
+		if err := visit(service); err != nil {
+			return nil, err
+		}
+	}
+
+	var order [][]ServiceStop
+	for _, service := range names {
+		level := levels[service]
+		for len(order) <= level {
+			order = append(order, nil)
+		}
+		order[level] = append(order[level], *stops[service])
+	}
+	return order, nil
+}
+
+// serviceDependencies returns the services in depends_on, and the service in network_mode as service:name
+func serviceDependencies(containerDetails map[interface{}]interface{}) []string {
+	var deps []string
+	switch dependsOn := containerDetails[types.DEPENDS_ON].(type) {
+	case []interface{}:
+		for _, dep := range dependsOn {
+			deps = append(deps, fmt.Sprint(dep))
+		}
+	case map[interface{}]interface{}:
+		for dep := range dependsOn {
+			deps = append(deps, fmt.Sprint(dep))
+		}
+	}
+	if networkMode, ok := containerDetails[types.NETWORK_MODE].(string); ok && strings.HasPrefix(networkMode, "service:") {
+		deps = append(deps, strings.TrimPrefix(networkMode, "service:"))
+	}
+	return deps
+}
+
+// ServiceLabels returns labels of a service, which are either a map or a list of key=value
+func ServiceLabels(containerDetails map[interface{}]interface{}) map[string]string {
+	labels := make(map[string]string)
+	switch l := containerDetails[types.LABELS].(type) {
+	case map[interface{}]interface{}:
+		for k, v := range l {
+			labels[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+	case []interface{}:
+		for _, label := range l {
+			kv := strings.SplitN(fmt.Sprint(label), "=", 2)
+			if len(kv) == 2 {
+				labels[kv[0]] = kv[1]
+			}
+		}
+	}
+	return labels
+}
+
+// stopServices stops services group by group in stop order, all the services are stopped at once
+// if stop order isn't available. Groups share one deadline of timeout seconds, each group waits at most
+// the time left.
+func stopServices(files []string, timeout int) error {
+	order, err := GetStopOrder(GetServiceDetail(), timeout)
+	if err != nil || len(order) == 0 {
+		if err != nil {
+			log.Warnf("Stop Pod : failed to get stop order, stopping all services: %v", err)
+		}
+		return GetRuntime().Stop(files, timeout)
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	var errs error
+	for _, group := range order {
+		remaining := int(time.Until(deadline).Round(time.Second).Seconds())
+		if remaining < 0 {
+			remaining = 0
+		}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for _, s := range group {
+			if s.Timeout > remaining {
+				s.Timeout = remaining
+			}
+			wg.Add(1)
+			go func(s ServiceStop) {
+				defer wg.Done()
+				if err := stopService(files, s); err != nil {
+					mu.Lock()
+					if errs == nil {
+						errs = err
+					} else {
+						errs = errors.Wrapf(errs, "%v", err)
+					}
+					mu.Unlock()
+				}
+			}(s)
+		}
+		wg.Wait()
+	}
+	return errs
+}
+
+// stopService sends stop signal of the service and waits for its container to exit before stopping it
+func stopService(files []string, s ServiceStop) error {
+	logger := log.WithFields(log.Fields{
+		"service": s.Service,
+		"func":    "pod.stopService",
+	})
+
+	timeout := s.Timeout
+	if s.Signal != "" {
+		id, err := GetContainerIdByService(files, s.Service)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			logger.Printf("Stop Service : send %s and wait %ds for container to exit", s.Signal, s.Timeout)
+			if err = GetRuntime().Kill(id, s.Signal); err != nil {
+				logger.Warnf("failed to send %s to container %s: %v", s.Signal, id, err)
+			}
+			exited := func() (string, error) {
+				details, err := InspectContainerDetails(id, false)
+				if err != nil || !details.IsRunning {
+					return "exited", nil
+				}
+				return "", nil
+			}
+			if res, _ := exited(); res == "" && s.Timeout > 0 {
+				wait.PollUntil(time.Second, nil, time.Duration(s.Timeout)*time.Second, exited)
+			}
+			// Grace period is used up by the stop signal
+			timeout = 0
+		}
+	}
+	return GetRuntime().Stop(files, timeout, s.Service)
+}
@@ -0,0 +1,186 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pod
+
+import (
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/api/v0/mesosproto"
+	"github.com/paypal/dce-go/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// killPolicy encodes TaskInfo.kill_policy field with grace period, which isn't defined in mesos-go v0
+func killPolicy(gracePeriod time.Duration) []byte {
+	nanoseconds := int64(gracePeriod)
+	duration, _ := (&mesos.DurationInfo{Nanoseconds: &nanoseconds}).Marshal()
+	policy := append([]byte{gracePeriodField<<3 | 2, byte(len(duration))}, duration...)
+	return append([]byte{killPolicyField<<3 | 2, byte(len(policy))}, policy...)
+}
+
+func TestGetKillGracePeriod(t *testing.T) {
+	_, ok := GetKillGracePeriod(nil)
+	assert.False(t, ok)
+
+	name, key, value := "task", "k", "v"
+	taskInfo := &mesos.TaskInfo{
+		Name:    &name,
+		TaskId:  &mesos.TaskID{Value: &name},
+		SlaveId: &mesos.SlaveID{Value: &name},
+		Labels:  &mesos.Labels{Labels: []*mesos.Label{{Key: &key, Value: &value}}},
+	}
+	_, ok = GetKillGracePeriod(taskInfo)
+	assert.False(t, ok)
+
+	// kill policy sent by scheduler is kept in unrecognized fields once task info is decoded
+	data, err := taskInfo.Marshal()
+	assert.NoError(t, err)
+	data = append(data, killPolicy(45*time.Second)...)
+	decoded := &mesos.TaskInfo{}
+	assert.NoError(t, decoded.Unmarshal(data))
+
+	gracePeriod, ok := GetKillGracePeriod(decoded)
+	assert.True(t, ok)
+	assert.Equal(t, 45*time.Second, gracePeriod)
+
+	ComposeTaskInfo = decoded
+	defer func() { ComposeTaskInfo = nil }()
+	assert.Equal(t, 45, GetStopGracePeriod())
+}
+
+func TestGetStopOrder(t *testing.T) {
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  networkproxy:
+    image: dcego/networkproxy
+  db:
+    image: postgres
+    network_mode: service:networkproxy
+    labels:
+      dce.stop.signal: SIGINT
+      dce.stop.timeout: 30s
+  app:
+    image: app
+    network_mode: service:networkproxy
+    depends_on:
+      db:
+        condition: service_healthy
+  sidecar:
+    image: sidecar
+    network_mode: service:networkproxy
+    labels:
+      - dce.stop.timeout=2s
+`), &compose))
+	var override map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  sidecar:
+    depends_on:
+      - app
+`), &override))
+
+	order, err := GetStopOrder(types.ServiceDetail{"docker-compose.yml": compose, "override.yml": override}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]ServiceStop{
+		{{Service: "sidecar", Timeout: 2}},
+		{{Service: "app", Timeout: 10}},
+		{{Service: "db", Signal: "SIGINT", Timeout: 30}},
+		{{Service: "networkproxy", Timeout: 10}},
+	}, order)
+
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  networkproxy:
+    depends_on:
+      - sidecar
+`), &override))
+	_, err = GetStopOrder(types.ServiceDetail{"docker-compose.yml": compose, "override.yml": override}, 10)
+	assert.Error(t, err, "circular dependency should fail")
+
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  app:
+    labels:
+      dce.stop.timeout: soon
+`), &override))
+	_, err = GetStopOrder(types.ServiceDetail{"override.yml": override}, 10)
+	assert.Error(t, err, "invalid stop timeout should fail")
+}
+
+func TestStopServices(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.services["db"] = "db"
+	f.containers["db"] = types.ContainerStatusDetails{}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  networkproxy:
+    image: dcego/networkproxy
+  db:
+    network_mode: service:networkproxy
+    labels:
+      dce.stop.signal: SIGINT
+  app:
+    network_mode: service:networkproxy
+  web:
+    network_mode: service:networkproxy
+`), &compose))
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": compose})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	assert.NoError(t, stopServices(nil, 10))
+	assert.ElementsMatch(t, []string{"app:10", "db:0", "web:10"}, f.stopped[:3],
+		"app containers should be stopped together")
+	assert.Equal(t, []string{"networkproxy:10"}, f.stopped[3:], "infra container should be stopped last")
+	assert.Equal(t, "SIGINT", f.killed["db"], "stop signal in label should be sent")
+
+	f.stopped = nil
+	SetServiceDetail(make(types.ServiceDetail))
+	assert.NoError(t, stopServices(nil, 10))
+	assert.Equal(t, []string{":10"}, f.stopped, "all services should be stopped at once without stop order")
+}
+
+func TestStopServicesDeadline(t *testing.T) {
+	f := useFakeRuntime(t)
+	f.services["db"] = "db"
+	f.containers["db"] = types.ContainerStatusDetails{IsRunning: true}
+
+	var compose map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+services:
+  networkproxy:
+    image: dcego/networkproxy
+  db:
+    network_mode: service:networkproxy
+    labels:
+      dce.stop.signal: SIGINT
+  app:
+    network_mode: service:networkproxy
+    labels:
+      dce.stop.timeout: 1m
+`), &compose))
+	SetServiceDetail(types.ServiceDetail{"docker-compose.yml": compose})
+	defer SetServiceDetail(make(types.ServiceDetail))
+
+	assert.NoError(t, stopServices(nil, 2))
+	assert.ElementsMatch(t, []string{"app:2", "db:0"}, f.stopped[:2],
+		"stop timeout in label should be capped by the grace period of pod")
+	assert.Equal(t, []string{"networkproxy:0"}, f.stopped[2:],
+		"grace period used up by app containers shouldn't be waited again by infra container")
+}
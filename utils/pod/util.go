@@ -3,15 +3,20 @@ package pod
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/paypal/dce-go/types"
+	"github.com/paypal/dce-go/utils/metrics"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 type ConditionFunc func() (string, error)
 
+// stepLock guards step data, which could be read by status api while pod is launching
+var stepLock sync.RWMutex
+
 func PluginPanicHandler(condition ConditionFunc) (res string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -45,6 +50,8 @@ func ToPodStatus(s string) types.PodStatus {
 		return types.POD_PULL_FAILED
 	case "POD_COMPOSE_CHECK_FAILED":
 		return types.POD_COMPOSE_CHECK_FAILED
+	case "POD_ADMISSION_DENIED":
+		return types.POD_ADMISSION_DENIED
 	}
 
 	return types.POD_EMPTY
@@ -69,6 +76,9 @@ func StartStep(stepData map[string][]*types.StepData, stepName string) {
 	if len(stepName) == 0 {
 		log.Error("error while updating step data for Granular Metrics: step name can't be empty for stepData")
 	}
+	stepLock.Lock()
+	defer stepLock.Unlock()
+
 	var ok bool
 
 	stepValues, ok := stepData[stepName]
@@ -93,6 +103,9 @@ func EndStep(stepData map[string][]*types.StepData, stepName string, tag map[str
 		log.Error("error while updating step data for Granular Metrics: step name can't be empty for stepData")
 		return
 	}
+	stepLock.Lock()
+	defer stepLock.Unlock()
+
 	var ok bool
 
 	stepValues, ok := stepData[stepName]
@@ -117,9 +130,13 @@ func EndStep(stepData map[string][]*types.StepData, stepName string, tag map[str
 	} else {
 		step.Status = "Success"
 	}
+	metrics.StepDuration.WithLabelValues(stepName, step.Status).Observe(float64(step.ExecTimeMS) / 1000)
 }
 
 func UpdateHealthCheckStatus(stepData map[string][]*types.StepData) {
+	stepLock.Lock()
+	defer stepLock.Unlock()
+
 	for stepName, stepVals := range stepData {
 		if strings.HasPrefix(stepName, "HealthCheck-") &&
 			len(stepVals) > 0 &&
@@ -130,6 +147,20 @@ func UpdateHealthCheckStatus(stepData map[string][]*types.StepData) {
 	}
 }
 
+// GetStepMetrics returns a copy of StepMetrics
+func GetStepMetrics() map[string][]types.StepData {
+	stepLock.RLock()
+	defer stepLock.RUnlock()
+
+	steps := make(map[string][]types.StepData, len(StepMetrics))
+	for stepName, stepVals := range StepMetrics {
+		for _, step := range stepVals {
+			steps[stepName] = append(steps[stepName], *step)
+		}
+	}
+	return steps
+}
+
 func CopySvcContainers(to []types.SvcContainer, from []types.SvcContainer) []types.SvcContainer {
 	to = make([]types.SvcContainer, len(from))
 	for i, c := range from {
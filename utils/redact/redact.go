@@ -0,0 +1,241 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redact removes sensitive values, such as passwords and tokens, from task info, compose files,
+// container details and dumps before they are logged or written into sandbox.
+package redact
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paypal/dce-go/config"
+	"github.com/paypal/dce-go/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MASK            = "******"
+	ASSIGNMENT      = "="
+	MAX_LINE_LENGTH = 1024 * 1024
+)
+
+// urlPassword matches password of user info in urls, such as proxy urls in docker info
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+
+// values are sensitive values registered by plugins, such as resolved secrets, which are redacted wherever
+// they are found regardless of their keys
+var values = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: make(map[string]bool)}
+
+// AddValue registers a sensitive value to be redacted
+func AddValue(value string) {
+	if value == "" {
+		return
+	}
+	values.Lock()
+	defer values.Unlock()
+	values.values[value] = true
+}
+
+// redactor redacts values of keys matching patterns in config redact.keys, except the keys in redact.allowlist
+type redactor struct {
+	keys      *regexp.Regexp
+	text      *regexp.Regexp
+	allowlist map[string]bool
+}
+
+func newRedactor() *redactor {
+	r := &redactor{allowlist: make(map[string]bool)}
+	for _, key := range config.GetRedactAllowlist() {
+		r.allowlist[strings.ToLower(key)] = true
+	}
+
+	patterns := config.GetRedactKeys()
+	if len(patterns) == 0 {
+		return r
+	}
+	pattern := "(?:" + strings.Join(patterns, "|") + ")"
+	keys, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		log.Errorf("Invalid redact keys %v, redacting with default keys: %v", patterns, err)
+		pattern = "(?:PASSWORD|TOKEN|SECRET)"
+		keys = regexp.MustCompile("(?i)" + pattern)
+	}
+	r.keys = keys
+	// key=value or key: value in text, key and value could be quoted
+	r.text = regexp.MustCompile(`(?i)([\w.-]*` + pattern + `[\w.-]*)(["']?\s*[:=]\s*["']?)([^\s"',}]+)`)
+	return r
+}
+
+func (r *redactor) sensitive(key string) bool {
+	return r.keys != nil && !r.allowlist[strings.ToLower(key)] && r.keys.MatchString(key)
+}
+
+// scrub replaces registered sensitive values in s, longer values are replaced first
+// so that a value containing another one, e.g. a docker config, is redacted as a whole
+func (r *redactor) scrub(s string) string {
+	values.RLock()
+	sorted := make([]string, 0, len(values.values))
+	for value := range values.values {
+		sorted = append(sorted, value)
+	}
+	values.RUnlock()
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, value := range sorted {
+		s = strings.ReplaceAll(s, value, MASK)
+	}
+	return s
+}
+
+// assignment redacts env var in form of key=value
+func (r *redactor) assignment(s string) string {
+	kv := strings.SplitN(s, ASSIGNMENT, 2)
+	if len(kv) == 2 && kv[1] != "" && r.sensitive(kv[0]) {
+		return kv[0] + ASSIGNMENT + MASK
+	}
+	return r.scrub(s)
+}
+
+func (r *redactor) field(key string, value interface{}) interface{} {
+	if r.sensitive(key) {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				return MASK
+			}
+		case int, int64, uint64, float64, bool, json.Number:
+			return MASK
+		}
+	}
+	return r.redact(value)
+}
+
+// pair redacts value of an object in form of {key: k, value: v} or {name: k, value: v}, such as mesos labels
+// and environment variables in task info
+func (r *redactor) pair(name, value interface{}) (interface{}, bool) {
+	if key, ok := name.(string); ok && r.sensitive(key) {
+		if v, ok := value.(string); ok && v != "" {
+			return MASK, true
+		}
+	}
+	return value, false
+}
+
+func (r *redactor) redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case types.ServiceDetail:
+		m := make(types.ServiceDetail, len(t))
+		for file, composeMap := range t {
+			m[file] = r.redact(composeMap).(map[string]interface{})
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, value := range t {
+			m[k] = r.field(k, value)
+		}
+		for _, name := range []string{"key", "name"} {
+			if value, ok := r.pair(t[name], t["value"]); ok {
+				m["value"] = value
+			}
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(t))
+		for k, value := range t {
+			m[k] = r.field(fmt.Sprint(k), value)
+		}
+		for _, name := range []string{"key", "name"} {
+			if value, ok := r.pair(t[name], t["value"]); ok {
+				m["value"] = value
+			}
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			if s, ok := e.(string); ok {
+				l[i] = r.assignment(s)
+			} else {
+				l[i] = r.redact(e)
+			}
+		}
+		return l
+	case string:
+		return r.scrub(t)
+	}
+	return v
+}
+
+// Text redacts values of sensitive keys in form of key=value or key: value, and passwords in urls
+func (r *redactor) Text(s string) string {
+	if r.text != nil {
+		s = r.text.ReplaceAllStringFunc(s, func(match string) string {
+			groups := r.text.FindStringSubmatch(match)
+			if r.allowlist[strings.ToLower(groups[1])] {
+				return match
+			}
+			return groups[1] + groups[2] + MASK
+		})
+	}
+	s = urlPassword.ReplaceAllString(s, "${1}"+MASK+"@")
+	return r.scrub(s)
+}
+
+// Value returns a copy of a decoded json or yaml document with sensitive values redacted
+func Value(v interface{}) interface{} {
+	return newRedactor().redact(v)
+}
+
+// JSON redacts sensitive values in json document, which is redacted as text if it isn't valid json
+func JSON(data []byte) []byte {
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return []byte(Text(string(data)))
+	}
+	redacted, err := json.Marshal(Value(v))
+	if err != nil {
+		return []byte(Text(string(data)))
+	}
+	return redacted
+}
+
+// Text redacts sensitive values in free text, such as logs
+func Text(s string) string {
+	return newRedactor().Text(s)
+}
+
+// Copy copies text from src to dst line by line with sensitive values redacted
+func Copy(dst io.Writer, src io.Reader) error {
+	r := newRedactor()
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), MAX_LINE_LENGTH)
+	for scanner.Scan() {
+		if _, err := io.WriteString(dst, r.Text(scanner.Text())+"\n"); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}